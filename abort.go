@@ -0,0 +1,49 @@
+package layer
+
+import "net/http"
+
+// abort stores the abort state of a request.
+type abort struct {
+	// phase stores the phase running when the request was aborted, if any.
+	phase string
+}
+
+// Abort declares the request response as final, so the layer skips every
+// remaining middleware handler, including the final handler, even if the
+// aborting middleware calls its next handler. The aborting middleware is
+// responsible for writing the response.
+//
+// Aborting applies to every subsequent phase chain run for the request,
+// except the error phase, so panics and errors are still handled, and the
+// response phase, unless aborted by a response middleware, so the aborted
+// response is still processed.
+//
+// The abort state is stored in the request storage, so requests attached
+// outside of the layer must be attached beforehand, see Attach.
+func Abort(r *http.Request) {
+	var phase string
+	if pos := positionFor(r); pos.active {
+		phase = pos.phase
+	}
+	setLocal(r, "vinxi.aborted", &abort{phase: phase})
+}
+
+// Aborted reports whether the given request has been aborted via Abort.
+func Aborted(r *http.Request) bool {
+	return abortOf(r) != nil
+}
+
+// abortOf returns the request abort state, if aborted.
+func abortOf(r *http.Request) *abort {
+	state, _ := getValue(r, "vinxi.aborted").(*abort)
+	return state
+}
+
+// skips reports whether the given phase chain must be skipped
+// since the request has been aborted.
+func (a *abort) skips(phase string) bool {
+	if a == nil || phase == ErrorPhase {
+		return false
+	}
+	return phase != ResponsePhase || a.phase == ResponsePhase
+}
@@ -0,0 +1,86 @@
+package layer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func TestAbort(t *testing.T) {
+	mw := New()
+	mw.Use("request", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		st.Expect(t, Aborted(r), false)
+		Abort(r)
+		st.Expect(t, Aborted(r), true)
+		w.WriteHeader(403)
+		h.ServeHTTP(w, r)
+	})
+	mw.Use("request", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Header().Set("X-Reached", "true")
+		h.ServeHTTP(w, r)
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run("request", w, &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("final"))
+	}))
+	st.Expect(t, w.Code, 403)
+	st.Expect(t, w.Header().Get("X-Reached"), "")
+	st.Expect(t, w.Body.String(), "")
+
+	// Abort is request-scoped
+	w = httptest.NewRecorder()
+	mw.Run("response", w, &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("final"))
+	}))
+	st.Expect(t, w.Body.String(), "final")
+}
+
+func TestAbortErrorPhase(t *testing.T) {
+	mw := New()
+	mw.Use("request", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		Abort(r)
+		panic("boom")
+	})
+	mw.Use("error", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.WriteHeader(503)
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run("request", w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 503)
+}
+
+func TestAbortResponsePhase(t *testing.T) {
+	mw := New()
+	mw.Use("request", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		Abort(r)
+		w.WriteHeader(403)
+	})
+	mw.Use("response", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Header().Set("X-Response", "true")
+		h.ServeHTTP(w, r)
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run("request", w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 403)
+	st.Expect(t, w.Header().Get("X-Response"), "true")
+
+	// Aborting the response phase skips its remaining middleware
+	mw = New()
+	mw.Use("response", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		Abort(r)
+		h.ServeHTTP(w, r)
+	})
+	mw.Use("response", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Header().Set("X-Reached", "true")
+		h.ServeHTTP(w, r)
+	})
+
+	w = httptest.NewRecorder()
+	mw.Run("request", w, &http.Request{}, nil)
+	st.Expect(t, w.Header().Get("X-Reached"), "")
+}
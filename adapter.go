@@ -1,6 +1,10 @@
 package layer
 
-import "net/http"
+import (
+	"net/http"
+	"reflect"
+	"sync"
+)
 
 // Handler represents the vinxi specific supported interface
 // that can be implemented by middleware handlers.
@@ -21,6 +25,30 @@ type HandlerFunc func(http.ResponseWriter, *http.Request)
 // HandlerFuncNext represents a Negroni-like handler function notation.
 type HandlerFuncNext func(http.ResponseWriter, *http.Request, http.Handler)
 
+// NegroniHandler represents the negroni.Handler interface, so Negroni
+// handler types, including negroni.HandlerFunc, can be registered as is.
+type NegroniHandler interface {
+	ServeHTTP(http.ResponseWriter, *http.Request, http.HandlerFunc)
+}
+
+// HandlerFuncError represents a simple handler function returning an error.
+// A non-nil error triggers the error phase, exposing it via the "vinxi.error" context key.
+type HandlerFuncError func(http.ResponseWriter, *http.Request) error
+
+// HandlerFuncNextError represents a Negroni-like handler function returning an error.
+// A non-nil error triggers the error phase, exposing it via the "vinxi.error" context key.
+type HandlerFuncNextError func(http.ResponseWriter, *http.Request, http.Handler) error
+
+// HandlerFuncParams represents an httprouter-like handler function notation,
+// receiving the route parameters exposed via WithParams.
+// It also implements http.Handler, so it can be used as final handler.
+type HandlerFuncParams func(http.ResponseWriter, *http.Request, Params)
+
+// ServeHTTP calls the handler function with the request route parameters.
+func (fn HandlerFuncParams) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fn(w, r, ParamsOf(r))
+}
+
 // MiddlewareFunc represents the http.Handler -> http.Handler capable interface.
 type MiddlewareFunc func(http.Handler) http.Handler
 
@@ -46,16 +74,46 @@ type Registrable interface {
 	Register(Middleware)
 }
 
+// Adapter represents a custom handler adapter, which adapts the given handler
+// into a MiddlewareFunc, reporting whether the handler type is supported.
+type Adapter func(interface{}) (MiddlewareFunc, bool)
+
+var (
+	// adapters stores the custom handler adapters registered via RegisterAdapter.
+	adapters []Adapter
+	// adaptersMutex guards the custom adapters registry.
+	adaptersMutex sync.RWMutex
+)
+
+// RegisterAdapter registers a custom handler adapter, allowing the layers
+// to accept custom handler types. Custom adapters are used in registration
+// order if the handler doesn't implement any of the built-in interfaces.
+//
+// Adapters are global and are expected to be registered at init time.
+func RegisterAdapter(adapter Adapter) {
+	if adapter == nil {
+		return
+	}
+	adaptersMutex.Lock()
+	defer adaptersMutex.Unlock()
+	adapters = append(adapters, adapter)
+}
+
 // AdaptFunc adapts the given function polumorphic interface
 // casting into a MiddlewareFunc capable interface.
 //
-// Currently support five different interface notations,
-// wrapping it accordingly to make homogeneus.
+// Currently support nine different interface notations,
+// wrapping it accordingly to make homogeneus, including the named function
+// types based on them, plus the custom handler types supported by the adapters
+// registered via RegisterAdapter.
 func AdaptFunc(h interface{}) MiddlewareFunc {
 	// Vinxi/Alice interface
 	if mw, ok := h.(func(h http.Handler) http.Handler); ok {
 		return MiddlewareFunc(mw)
 	}
+	if mw, ok := h.(MiddlewareFunc); ok {
+		return mw
+	}
 
 	// http.Handler -> http.HandlerFunc interface
 	if mw, ok := h.(func(http.Handler) func(http.ResponseWriter, *http.Request)); ok {
@@ -67,11 +125,32 @@ func AdaptFunc(h interface{}) MiddlewareFunc {
 		return adaptHandlerFuncNext(mw)
 	}
 
+	// Negroni handler interface
+	if mw, ok := h.(func(http.ResponseWriter, *http.Request, http.HandlerFunc)); ok {
+		return adaptNegroniHandler(negroniHandlerFunc(mw))
+	}
+	if mw, ok := h.(NegroniHandler); ok {
+		return adaptNegroniHandler(mw)
+	}
+
 	// Standard net/http function handler interface
 	if mw, ok := h.(func(http.ResponseWriter, *http.Request)); ok {
 		return adaptHandlerFunc(mw)
 	}
 
+	// Route parameters handler interface
+	if mw, ok := h.(func(http.ResponseWriter, *http.Request, Params)); ok {
+		return adaptHandlerFuncParams(mw)
+	}
+
+	// Error returning handler interfaces
+	if mw, ok := h.(func(w http.ResponseWriter, r *http.Request, h http.Handler) error); ok {
+		return adaptHandlerFuncNextError(mw)
+	}
+	if mw, ok := h.(func(http.ResponseWriter, *http.Request) error); ok {
+		return adaptHandlerFuncError(mw)
+	}
+
 	// Standard net/http handler
 	if mw, ok := h.(http.Handler); ok {
 		return adaptNativeHandler(mw)
@@ -87,6 +166,50 @@ func AdaptFunc(h interface{}) MiddlewareFunc {
 		return adaptPartialHandler(mw)
 	}
 
+	// Named function types with a supported signature, e.g: alice.Constructor
+	if mw := adaptNamedFunc(h); mw != nil {
+		return mw
+	}
+
+	return adaptCustom(h)
+}
+
+// funcTypes stores the supported handler function signatures.
+var funcTypes = []reflect.Type{
+	reflect.TypeOf((func(http.Handler) http.Handler)(nil)),
+	reflect.TypeOf((func(http.Handler) func(http.ResponseWriter, *http.Request))(nil)),
+	reflect.TypeOf((func(http.ResponseWriter, *http.Request, http.Handler))(nil)),
+	reflect.TypeOf((func(http.ResponseWriter, *http.Request, http.HandlerFunc))(nil)),
+	reflect.TypeOf((func(http.ResponseWriter, *http.Request))(nil)),
+	reflect.TypeOf((func(http.ResponseWriter, *http.Request, Params))(nil)),
+	reflect.TypeOf((func(http.ResponseWriter, *http.Request, http.Handler) error)(nil)),
+	reflect.TypeOf((func(http.ResponseWriter, *http.Request) error)(nil)),
+}
+
+// adaptNamedFunc adapts the given named function type handler
+// converting it into the supported signature it's based on, if any.
+func adaptNamedFunc(h interface{}) MiddlewareFunc {
+	v := reflect.ValueOf(h)
+	if v.Kind() != reflect.Func || v.Type().Name() == "" {
+		return nil
+	}
+	for _, t := range funcTypes {
+		if v.Type().ConvertibleTo(t) {
+			return AdaptFunc(v.Convert(t).Interface())
+		}
+	}
+	return nil
+}
+
+// adaptCustom adapts the given handler using the custom adapters, if supported.
+func adaptCustom(h interface{}) MiddlewareFunc {
+	adaptersMutex.RLock()
+	defer adaptersMutex.RUnlock()
+	for _, adapter := range adapters {
+		if mw, ok := adapter(h); ok && mw != nil {
+			return mw
+		}
+	}
 	return nil
 }
 
@@ -110,6 +233,54 @@ func adaptHandlerFuncNext(fn HandlerFuncNext) MiddlewareFunc {
 	}
 }
 
+// negroniHandlerFunc adapts a Negroni handler function into a NegroniHandler.
+type negroniHandlerFunc func(http.ResponseWriter, *http.Request, http.HandlerFunc)
+
+func (fn negroniHandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	fn(w, r, next)
+}
+
+func adaptNegroniHandler(fn NegroniHandler) MiddlewareFunc {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fn.ServeHTTP(w, r, h.ServeHTTP)
+		})
+	}
+}
+
+func adaptHandlerFuncParams(fn HandlerFuncParams) MiddlewareFunc {
+	return func(h http.Handler) http.Handler {
+		return fn
+	}
+}
+
+func adaptHandlerFuncError(fn HandlerFuncError) MiddlewareFunc {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := fn(w, r); err != nil {
+				panic(returnedError{err})
+			}
+		})
+	}
+}
+
+func adaptHandlerFuncNextError(fn HandlerFuncNextError) MiddlewareFunc {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := fn(w, r, h); err != nil {
+				panic(returnedError{err})
+			}
+		})
+	}
+}
+
+// returnedError wraps an error returned by a middleware handler,
+// unwinding the middleware chain up to the layer running it,
+// which triggers the error phase without recording it as a panic.
+type returnedError struct {
+	err error
+}
+
 func adaptHandler(fn Handler) MiddlewareFunc {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
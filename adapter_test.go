@@ -1,6 +1,7 @@
 package layer
 
 import (
+	"errors"
 	"github.com/nbio/st"
 	"gopkg.in/vinxi/utils.v0"
 	"net/http"
@@ -30,6 +31,10 @@ func TestAdaptMiddlewareFunc(t *testing.T) {
 
 	st.Expect(t, w.Header().Get("foo"), "bar")
 	st.Expect(t, w.Code, 502)
+
+	w = utils.NewWriterStub()
+	AdaptFunc(MiddlewareFunc(middlewareFunc))(FinalHandler).ServeHTTP(w, req)
+	st.Expect(t, w.Header().Get("foo"), "bar")
 }
 
 func TestAdaptNegroniInterface(t *testing.T) {
@@ -90,3 +95,125 @@ func TestVinciHandler(t *testing.T) {
 	st.Expect(t, w.Header().Get("foo"), "bar")
 	st.Expect(t, w.Code, 502)
 }
+
+func TestAdaptErrorHandlers(t *testing.T) {
+	errFoo := errors.New("foo")
+	mw := New()
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) error {
+		w.Header().Set("foo", "bar")
+		h.ServeHTTP(w, r)
+		return nil
+	})
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request) error {
+		return errFoo
+	})
+	mw.Use(ErrorPhase, func(w http.ResponseWriter, r *http.Request) {
+		st.Expect(t, ErrorOf(r), errFoo)
+		w.WriteHeader(503)
+	})
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Header().Get("foo"), "bar")
+	st.Expect(t, w.Code, 503)
+	st.Expect(t, mw.Panics().Total, uint64(0))
+}
+
+type statusHandler func() int
+
+func TestRegisterAdapter(t *testing.T) {
+	defer func() {
+		adaptersMutex.Lock()
+		adapters = nil
+		adaptersMutex.Unlock()
+	}()
+
+	st.Expect(t, AdaptFunc(statusHandler(nil)) == nil, true)
+
+	RegisterAdapter(nil)
+	RegisterAdapter(func(h interface{}) (MiddlewareFunc, bool) {
+		fn, ok := h.(statusHandler)
+		if !ok {
+			return nil, false
+		}
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(fn())
+			})
+		}, true
+	})
+
+	mw := New()
+	mw.Use(RequestPhase, statusHandler(func() int { return 202 }))
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 202)
+}
+
+func TestAdaptParamsHandler(t *testing.T) {
+	mw := New()
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, ps Params) {
+		w.Header().Set("id", ps.ByName("id"))
+	})
+
+	w := utils.NewWriterStub()
+	req := WithParams(&http.Request{}, Params{{Key: "id", Value: "1"}})
+	mw.Run(RequestPhase, w, req, nil)
+	st.Expect(t, w.Header().Get("id"), "1")
+	st.Expect(t, ParamsOf(&http.Request{}) == nil, true)
+	st.Expect(t, ParamsOf(req).ByName("name"), "")
+
+	w = utils.NewWriterStub()
+	final := HandlerFuncParams(func(w http.ResponseWriter, r *http.Request, ps Params) {
+		w.WriteHeader(202)
+	})
+	mw = New()
+	mw.Run(RequestPhase, w, req, final)
+	st.Expect(t, w.Code, 202)
+}
+
+type negroniHandler struct{}
+
+func (negroniHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	w.Header().Add("negroni", "struct")
+	next(w, r)
+}
+
+func TestAdaptNegroniHandler(t *testing.T) {
+	mw := New()
+	mw.Use(RequestPhase, negroniHandler{})
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		w.Header().Add("negroni", "func")
+		next(w, r)
+	})
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	}))
+	st.Expect(t, w.Code, 204)
+	st.Expect(t, w.Header()["Negroni"], []string{"struct", "func"})
+}
+
+type constructor func(http.Handler) http.Handler
+
+type errorFunc func(http.ResponseWriter, *http.Request) error
+
+func TestAdaptNamedFunc(t *testing.T) {
+	mw := New()
+	mw.Use(RequestPhase, constructor(func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("foo", "bar")
+			h.ServeHTTP(w, r)
+		})
+	}))
+	mw.Use(RequestPhase, errorFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return errors.New("oops")
+	}))
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Header().Get("foo"), "bar")
+	st.Expect(t, w.Code, 500)
+	st.Expect(t, AdaptFunc(statusHandler(nil)) == nil, true)
+}
@@ -0,0 +1,30 @@
+// Package aliceadapter provides interoperability between Alice chains
+// and layer phases, in both directions.
+package aliceadapter
+
+import (
+	"net/http"
+
+	"github.com/justinas/alice"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+// FromAlice adapts the given Alice chain into a layer middleware function,
+// so it can be registered into any layer phase as a single middleware:
+//
+//	mw.Use("request", aliceadapter.FromAlice(alice.New(timeout, logger)))
+func FromAlice(chain alice.Chain) layer.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return chain.Then(next)
+	}
+}
+
+// ToAlice exports the given layer phase as an Alice chain, whose single
+// constructor runs the phase middleware chain with the next Alice handler
+// as final handler, including the layer error handling.
+// Middleware registered afterwards in the layer phase is also used.
+func ToAlice(mw *layer.Layer, phase string) alice.Chain {
+	return alice.New(func(next http.Handler) http.Handler {
+		return mw.Handler(phase, next)
+	})
+}
@@ -0,0 +1,59 @@
+package aliceadapter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/justinas/alice"
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+func orderConstructor(name string) alice.Constructor {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("order", name)
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+var final = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("order", "final")
+})
+
+func TestFromAlice(t *testing.T) {
+	mw := layer.New()
+	mw.Use(layer.RequestPhase, FromAlice(alice.New(orderConstructor("a"), orderConstructor("b"))))
+	mw.Use(layer.RequestPhase, orderConstructor("c"))
+
+	w := httptest.NewRecorder()
+	mw.Run(layer.RequestPhase, w, httptest.NewRequest("GET", "/", nil), final)
+	st.Expect(t, w.Header()["Order"], []string{"a", "b", "c", "final"})
+}
+
+func TestToAlice(t *testing.T) {
+	mw := layer.New()
+	mw.Use(layer.RequestPhase, orderConstructor("b"))
+	chain := alice.New(orderConstructor("a")).Append(ToAlice(mw, layer.RequestPhase).Then, orderConstructor("c"))
+	mw.Use(layer.RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Header().Add("order", "late")
+		h.ServeHTTP(w, r)
+	})
+
+	w := httptest.NewRecorder()
+	chain.Then(final).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Header()["Order"], []string{"a", "b", "late", "c", "final"})
+}
+
+func TestToAliceErrorHandling(t *testing.T) {
+	mw := layer.New()
+	mw.Use(layer.RequestPhase, func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+
+	w := httptest.NewRecorder()
+	ToAlice(mw, layer.RequestPhase).Then(final).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Code, 500)
+}
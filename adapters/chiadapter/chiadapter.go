@@ -0,0 +1,32 @@
+// Package chiadapter provides interoperability between chi middleware
+// stacks and layer phases, so chi users can adopt phases incrementally.
+package chiadapter
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+// Use registers the given chi middleware stack in the given layer phase
+// with the given priority, preserving the stack order:
+//
+//	chiadapter.Use(mw, "request", layer.Head, chi.Chain(middleware.RequestID, middleware.Logger))
+func Use(mw layer.Pluggable, phase string, priority layer.Priority, middlewares chi.Middlewares) {
+	handlers := make([]interface{}, len(middlewares))
+	for i, m := range middlewares {
+		handlers[i] = m
+	}
+	mw.UsePriority(phase, priority, handlers...)
+}
+
+// Middleware returns a chi router middleware running the given layer phase,
+// including its error handling, with the next chi handler as final handler:
+//
+//	router.Use(chiadapter.Middleware(mw, "request"))
+func Middleware(mw *layer.Layer, phase string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return mw.Handler(phase, next)
+	}
+}
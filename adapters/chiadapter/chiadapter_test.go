@@ -0,0 +1,45 @@
+package chiadapter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+func orderMiddleware(name string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("order", name)
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+var final = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("order", "final")
+})
+
+func TestUse(t *testing.T) {
+	mw := layer.New()
+	mw.Use(layer.RequestPhase, orderMiddleware("normal"))
+	Use(mw, layer.RequestPhase, layer.TopHead, chi.Chain(orderMiddleware("a"), orderMiddleware("b")))
+	Use(mw, layer.RequestPhase, layer.Tail, chi.Middlewares{orderMiddleware("c")})
+
+	w := httptest.NewRecorder()
+	mw.Run(layer.RequestPhase, w, httptest.NewRequest("GET", "/", nil), final)
+	st.Expect(t, w.Header()["Order"], []string{"a", "b", "normal", "c", "final"})
+}
+
+func TestMiddleware(t *testing.T) {
+	mw := layer.New()
+	mw.Use(layer.RequestPhase, orderMiddleware("layer"))
+
+	w := httptest.NewRecorder()
+	stack := chi.Chain(orderMiddleware("a"), Middleware(mw, layer.RequestPhase), orderMiddleware("b"))
+	stack.Handler(final).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Header()["Order"], []string{"a", "layer", "b", "final"})
+}
@@ -0,0 +1,82 @@
+// Package echoadapter adapts Echo middleware and handlers into layer
+// middleware and handlers, so the Echo middleware ecosystem can be
+// plugged into any layer phase.
+package echoadapter
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+// Adapter adapts Echo middleware and handlers using an Echo instance,
+// which creates the Echo contexts and handles the *echo.HTTPError errors.
+type Adapter struct {
+	echo *echo.Echo
+}
+
+// New creates a new adapter using the given Echo instance,
+// or a new default one if nil.
+func New(e *echo.Echo) *Adapter {
+	if e == nil {
+		e = echo.New()
+	}
+	return &Adapter{echo: e}
+}
+
+// defaultAdapter stores the adapter used by the package level functions.
+var defaultAdapter = New(nil)
+
+// Wrap adapts the given Echo middleware into a layer middleware function
+// using a default Echo instance. See Adapter.Wrap.
+func Wrap(mw ...echo.MiddlewareFunc) layer.MiddlewareFunc {
+	return defaultAdapter.Wrap(mw...)
+}
+
+// Handler adapts the given Echo handler into an http.Handler
+// using a default Echo instance. See Adapter.Handler.
+func Handler(h echo.HandlerFunc) http.Handler {
+	return defaultAdapter.Handler(h)
+}
+
+// Wrap adapts the given Echo middleware into a layer middleware function,
+// whose innermost Echo handler calls the next layer handler:
+//
+//	mw.Use("request", echoadapter.Wrap(middleware.Gzip(), middleware.Secure()))
+//
+// Returned *echo.HTTPError errors are replied by the Echo HTTPErrorHandler,
+// e.g: 401 Unauthorized, while any other error triggers the layer error phase.
+func (a *Adapter) Wrap(mw ...echo.MiddlewareFunc) layer.MiddlewareFunc {
+	return layer.AdaptFunc(func(w http.ResponseWriter, r *http.Request, next http.Handler) error {
+		h := func(c echo.Context) error {
+			next.ServeHTTP(c.Response(), c.Request())
+			return nil
+		}
+		for i := len(mw) - 1; i >= 0; i-- {
+			h = mw[i](h)
+		}
+		return a.serve(h, w, r)
+	})
+}
+
+// Handler adapts the given Echo handler into an http.Handler,
+// which can be registered as middleware handler or used as final handler.
+// Returned errors are handled as in Wrap, so the handler must be run by a layer.
+func (a *Adapter) Handler(h echo.HandlerFunc) http.Handler {
+	return layer.AdaptFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return a.serve(h, w, r)
+	})(nil)
+}
+
+// serve calls the given Echo handler with a new Echo context,
+// replying *echo.HTTPError errors via the Echo HTTPErrorHandler.
+func (a *Adapter) serve(h echo.HandlerFunc, w http.ResponseWriter, r *http.Request) error {
+	c := a.echo.NewContext(r, w)
+	err := h(c)
+	if he, ok := err.(*echo.HTTPError); ok {
+		a.echo.HTTPErrorHandler(he, c)
+		return nil
+	}
+	return err
+}
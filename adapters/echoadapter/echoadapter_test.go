@@ -0,0 +1,63 @@
+package echoadapter
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+func headerMiddleware(name string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Response().Header().Add("order", name)
+			return next(c)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	mw := layer.New()
+	mw.Use(layer.RequestPhase, Wrap(headerMiddleware("a"), headerMiddleware("b")))
+
+	w := httptest.NewRecorder()
+	mw.Run(layer.RequestPhase, w, httptest.NewRequest("GET", "/", nil), Handler(func(c echo.Context) error {
+		c.Response().Header().Add("order", "final")
+		c.Response().WriteHeader(204)
+		return nil
+	}))
+	st.Expect(t, w.Code, 204)
+	st.Expect(t, w.Header()["Order"], []string{"a", "b", "final"})
+}
+
+func TestWrapErrors(t *testing.T) {
+	unauthorized := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			return echo.NewHTTPError(401)
+		}
+	}
+	mw := layer.New()
+	mw.Use(layer.RequestPhase, Wrap(unauthorized))
+
+	w := httptest.NewRecorder()
+	mw.Run(layer.RequestPhase, w, httptest.NewRequest("GET", "/", nil), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("final handler must not be called")
+	}))
+	st.Expect(t, w.Code, 401)
+
+	errFailed := errors.New("failed")
+	mw = layer.New()
+	mw.UseFinalHandler(Handler(func(c echo.Context) error {
+		return errFailed
+	}))
+
+	w = httptest.NewRecorder()
+	req := layer.Attach(httptest.NewRequest("GET", "/", nil))
+	mw.Run(layer.RequestPhase, w, req, nil)
+	st.Expect(t, w.Code, 500)
+	st.Expect(t, layer.ErrorOf(req), errFailed)
+}
@@ -0,0 +1,51 @@
+// Package ginadapter adapts Gin middleware handlers into layer middleware,
+// so Gin middleware can be registered in any layer phase.
+package ginadapter
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+// nextKey represents the context.Context key used to store the next layer handler.
+type nextKey struct{}
+
+// Wrap adapts the given Gin handlers into a layer middleware function,
+// running them as a Gin handlers chain whose last handler calls the next
+// layer handler:
+//
+//	mw.Use("request", ginadapter.Wrap(gzip.Gzip(gzip.DefaultCompression)))
+//
+// Calling gin.Context.Next runs the rest of the layer chain, while aborting
+// the gin.Context short-circuits it. The handlers run in a dedicated Gin engine,
+// created once per call to Wrap, so Gin debug messages are printed unless
+// Gin runs in release mode.
+func Wrap(handlers ...gin.HandlerFunc) layer.MiddlewareFunc {
+	chain := append(append(gin.HandlersChain{}, handlers...), serveNext)
+	engine := gin.New()
+	engine.Any("/*path", chain...)
+	// Serve non-standard methods too
+	engine.NoRoute(chain...)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			engine.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), nextKey{}, next)))
+		})
+	}
+}
+
+// serveNext calls the next layer handler stored in the request context.
+func serveNext(c *gin.Context) {
+	next, ok := c.Request.Context().Value(nextKey{}).(http.Handler)
+	if !ok {
+		return
+	}
+	if !c.Writer.Written() {
+		// Reset the not found status used by Gin for unrouted requests
+		c.Status(http.StatusOK)
+	}
+	next.ServeHTTP(c.Writer, c.Request)
+}
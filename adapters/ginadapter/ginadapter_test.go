@@ -0,0 +1,48 @@
+package ginadapter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+func TestWrap(t *testing.T) {
+	var calls []string
+	mw := layer.New()
+	mw.Use(layer.RequestPhase, Wrap(func(c *gin.Context) {
+		calls = append(calls, "before")
+		c.Header("foo", "bar")
+		c.Next()
+		calls = append(calls, "after")
+	}))
+
+	for _, method := range []string{"GET", "PURGE"} {
+		calls = nil
+		w := httptest.NewRecorder()
+		mw.Run(layer.RequestPhase, w, httptest.NewRequest(method, "/foo", nil), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, "final")
+			w.Write([]byte("hello"))
+		}))
+		st.Expect(t, w.Code, 200)
+		st.Expect(t, w.Header().Get("foo"), "bar")
+		st.Expect(t, w.Body.String(), "hello")
+		st.Expect(t, calls, []string{"before", "final", "after"})
+	}
+}
+
+func TestWrapAbort(t *testing.T) {
+	mw := layer.New()
+	mw.Use(layer.RequestPhase, Wrap(func(c *gin.Context) {
+		c.AbortWithStatus(401)
+	}))
+
+	w := httptest.NewRecorder()
+	mw.Run(layer.RequestPhase, w, httptest.NewRequest("GET", "/", nil), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("final handler must not be called")
+	}))
+	st.Expect(t, w.Code, 401)
+}
@@ -0,0 +1,187 @@
+// Package gojaadapter implements JavaScript scriptable middleware handlers,
+// powered by the goja JavaScript engine, so small routing and header tweaks
+// can be deployed without recompiling the gateway.
+//
+// Scripts must define a handle function receiving the request and response APIs:
+//
+//	function handle(req, res) {
+//	  if (!req.header("Authorization")) {
+//	    res.setHeader("WWW-Authenticate", "Basic")
+//	    return res.send(401, "Unauthorized")
+//	  }
+//	  req.setHeader("X-Scripted", "true")
+//	}
+//
+// The request API exposes the method, path, host and url properties and
+// the header(name), setHeader(name, value), delHeader(name) and query(name)
+// functions. The response API exposes the setHeader(name, value) and
+// send(status, body) functions: once send is called, the rest of the chain is skipped.
+package gojaadapter
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+var (
+	// ErrNoHandle is returned when the script doesn't define a handle function.
+	ErrNoHandle = errors.New("gojaadapter: script must define a handle function")
+
+	// ErrTimeout is used to interrupt the scripts exceeding their timeout.
+	ErrTimeout = errors.New("gojaadapter: script timeout exceeded")
+)
+
+// Script represents a compiled JavaScript middleware script.
+// Scripts are safe for concurrent use: every concurrent request
+// runs the script in its own pooled JavaScript runtime.
+type Script struct {
+	// Timeout defines the maximum script execution time per request, if positive.
+	// Scripts exceeding it are interrupted, triggering the layer error phase.
+	Timeout time.Duration
+
+	program *goja.Program
+	pool    sync.Pool
+}
+
+// runtime represents a JavaScript runtime with the script loaded.
+type runtime struct {
+	vm     *goja.Runtime
+	handle goja.Callable
+}
+
+// Compile compiles the given script, identified by the given name in error traces.
+// Returns ErrNoHandle if the script doesn't define a handle function.
+func Compile(name, src string) (*Script, error) {
+	program, err := goja.Compile(name, src, true)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Script{program: program}
+	rt, err := s.runtime()
+	if err != nil {
+		return nil, err
+	}
+	s.pool.Put(rt)
+	return s, nil
+}
+
+// MustCompile is like Compile but panics if the script cannot be compiled.
+func MustCompile(name, src string) *Script {
+	s, err := Compile(name, src)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Handle runs the script for the given request, calling the next handler
+// unless the script replied. Script errors trigger the layer error phase.
+// It can be registered as is in any layer phase:
+//
+//	mw.Use("request", script.Handle)
+func (s *Script) Handle(w http.ResponseWriter, r *http.Request, next http.Handler) error {
+	rt, err := s.runtime()
+	if err != nil {
+		return err
+	}
+
+	stop := s.interrupt(rt.vm)
+	replied := false
+	_, err = rt.handle(goja.Undefined(), requestAPI(rt.vm, r), responseAPI(rt.vm, w, &replied))
+	stop()
+	if err != nil {
+		return err
+	}
+	s.pool.Put(rt)
+
+	if !replied {
+		next.ServeHTTP(w, r)
+	}
+	return nil
+}
+
+// interrupt interrupts the given runtime once the script timeout is exceeded,
+// if any, returning the function that must be called once the script returns.
+func (s *Script) interrupt(vm *goja.Runtime) func() {
+	if s.Timeout <= 0 {
+		return func() {}
+	}
+
+	var mutex sync.Mutex
+	finished := false
+	timer := time.AfterFunc(s.Timeout, func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if !finished {
+			vm.Interrupt(ErrTimeout)
+		}
+	})
+	return func() {
+		mutex.Lock()
+		finished = true
+		mutex.Unlock()
+		timer.Stop()
+		vm.ClearInterrupt()
+	}
+}
+
+// runtime returns a pooled runtime, or a new one with the script loaded.
+func (s *Script) runtime() (*runtime, error) {
+	if rt, ok := s.pool.Get().(*runtime); ok {
+		return rt, nil
+	}
+
+	vm := goja.New()
+	if _, err := vm.RunProgram(s.program); err != nil {
+		return nil, err
+	}
+	handle, ok := goja.AssertFunction(vm.Get("handle"))
+	if !ok {
+		return nil, ErrNoHandle
+	}
+	return &runtime{vm: vm, handle: handle}, nil
+}
+
+// requestAPI creates the script request API for the given request.
+func requestAPI(vm *goja.Runtime, r *http.Request) *goja.Object {
+	req := vm.NewObject()
+	req.Set("method", r.Method)
+	req.Set("path", r.URL.Path)
+	req.Set("host", r.Host)
+	req.Set("url", r.URL.String())
+	req.Set("header", func(name string) string {
+		return r.Header.Get(name)
+	})
+	req.Set("setHeader", func(name, value string) {
+		r.Header.Set(name, value)
+	})
+	req.Set("delHeader", func(name string) {
+		r.Header.Del(name)
+	})
+	req.Set("query", func(name string) string {
+		return r.URL.Query().Get(name)
+	})
+	return req
+}
+
+// responseAPI creates the script response API for the given response writer.
+func responseAPI(vm *goja.Runtime, w http.ResponseWriter, replied *bool) *goja.Object {
+	res := vm.NewObject()
+	res.Set("setHeader", func(name, value string) {
+		w.Header().Set(name, value)
+	})
+	res.Set("send", func(status int, body string) {
+		if *replied {
+			return
+		}
+		*replied = true
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	})
+	return res
+}
@@ -0,0 +1,62 @@
+package gojaadapter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+var final = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Scripted", r.Header.Get("X-Scripted"))
+	w.WriteHeader(204)
+})
+
+func TestScript(t *testing.T) {
+	script := MustCompile("auth.js", `
+		function handle(req, res) {
+			if (!req.header("Authorization")) {
+				res.setHeader("WWW-Authenticate", "Basic")
+				return res.send(401, "Unauthorized " + req.method + " " + req.path)
+			}
+			req.setHeader("X-Scripted", req.query("name"))
+		}
+	`)
+	mw := layer.New()
+	mw.Use(layer.RequestPhase, script.Handle)
+
+	w := httptest.NewRecorder()
+	mw.Run(layer.RequestPhase, w, httptest.NewRequest("GET", "/foo", nil), final)
+	st.Expect(t, w.Code, 401)
+	st.Expect(t, w.Header().Get("WWW-Authenticate"), "Basic")
+	st.Expect(t, w.Body.String(), "Unauthorized GET /foo")
+
+	req := httptest.NewRequest("GET", "/foo?name=vinxi", nil)
+	req.Header.Set("Authorization", "Basic Zm9vOmJhcg==")
+	w = httptest.NewRecorder()
+	mw.Run(layer.RequestPhase, w, req, final)
+	st.Expect(t, w.Code, 204)
+	st.Expect(t, w.Header().Get("Scripted"), "vinxi")
+}
+
+func TestScriptTimeout(t *testing.T) {
+	script := MustCompile("loop.js", `function handle(req, res) { for (;;) {} }`)
+	script.Timeout = 10 * time.Millisecond
+	mw := layer.New()
+	mw.Use(layer.RequestPhase, script.Handle)
+
+	w := httptest.NewRecorder()
+	mw.Run(layer.RequestPhase, w, httptest.NewRequest("GET", "/", nil), final)
+	st.Expect(t, w.Code, 500)
+}
+
+func TestCompileErrors(t *testing.T) {
+	_, err := Compile("empty.js", `var foo = 1`)
+	st.Expect(t, err, ErrNoHandle)
+
+	_, err = Compile("invalid.js", `function handle(`)
+	st.Expect(t, err != nil, true)
+}
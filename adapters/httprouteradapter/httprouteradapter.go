@@ -0,0 +1,52 @@
+// Package httprouteradapter adapts httprouter handlers into layer handlers,
+// and layer handlers into httprouter handlers, sharing the route parameters
+// via the request context.
+package httprouteradapter
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+// Handle adapts the given httprouter handle into a layer handler, which can be
+// registered as middleware handler or used as final handler. The route parameters
+// are read from layer.ParamsOf, falling back to the httprouter ones, if any.
+func Handle(h httprouter.Handle) layer.HandlerFuncParams {
+	return func(w http.ResponseWriter, r *http.Request, ps layer.Params) {
+		if ps == nil {
+			h(w, r, httprouter.ParamsFromContext(r.Context()))
+			return
+		}
+		h(w, r, toRouter(ps))
+	}
+}
+
+// Wrap adapts the given handler, such as a layer phase handler, into an httprouter
+// handle, exposing the route parameters via layer.ParamsOf:
+//
+//	router.GET("/users/:id", httprouteradapter.Wrap(mw.Handler("request", final)))
+func Wrap(h http.Handler) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		h.ServeHTTP(w, layer.WithParams(r, fromRouter(ps)))
+	}
+}
+
+// fromRouter converts the given httprouter parameters into layer parameters.
+func fromRouter(ps httprouter.Params) layer.Params {
+	params := make(layer.Params, len(ps))
+	for i, p := range ps {
+		params[i] = layer.Param{Key: p.Key, Value: p.Value}
+	}
+	return params
+}
+
+// toRouter converts the given layer parameters into httprouter parameters.
+func toRouter(ps layer.Params) httprouter.Params {
+	params := make(httprouter.Params, len(ps))
+	for i, p := range ps {
+		params[i] = httprouter.Param{Key: p.Key, Value: p.Value}
+	}
+	return params
+}
@@ -0,0 +1,41 @@
+package httprouteradapter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+func TestWrap(t *testing.T) {
+	mw := layer.New()
+	mw.Use(layer.RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Header().Set("id", layer.ParamsOf(r).ByName("id"))
+		h.ServeHTTP(w, r)
+	})
+	final := Handle(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		w.Write([]byte(ps.ByName("name")))
+	})
+
+	w := httptest.NewRecorder()
+	handle := Wrap(mw.Handler(layer.RequestPhase, final))
+	handle(w, httptest.NewRequest("GET", "/users/1/foo", nil), httprouter.Params{{Key: "id", Value: "1"}, {Key: "name", Value: "foo"}})
+	st.Expect(t, w.Header().Get("id"), "1")
+	st.Expect(t, w.Body.String(), "foo")
+}
+
+func TestHandleRouterParams(t *testing.T) {
+	mw := layer.New()
+	mw.Use(layer.RequestPhase, Handle(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		w.Write([]byte(ps.ByName("id")))
+	}))
+
+	ctx := context.WithValue(context.Background(), httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: "2"}})
+	w := httptest.NewRecorder()
+	mw.ServeHTTP(w, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+	st.Expect(t, w.Body.String(), "2")
+}
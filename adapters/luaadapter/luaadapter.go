@@ -0,0 +1,226 @@
+// Package luaadapter implements Lua scriptable middleware handlers, powered
+// by gopher-lua, following the nginx/OpenResty workflow.
+//
+// Scripts must define a handle function receiving the request and response APIs:
+//
+//	function handle(req, res)
+//	  if req.header("Authorization") == "" then
+//	    res.setHeader("WWW-Authenticate", "Basic")
+//	    return res.send(401, "Unauthorized")
+//	  end
+//	  req.setHeader("X-Scripted", "true")
+//	end
+//
+// The request API exposes the method, path, host and url fields and
+// the header(name), setHeader(name, value), delHeader(name) and query(name)
+// functions. The response API exposes the setHeader(name, value) and
+// send(status, body) functions: once send is called, the rest of the chain is skipped.
+//
+// Scripts are sandboxed: only the base, table, string and math libraries
+// are available, without the functions loading code or files, and their
+// call stack, registry size and execution time are limited.
+package luaadapter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+// DefaultTimeout defines the default maximum script execution time per request.
+var DefaultTimeout = 100 * time.Millisecond
+
+// ErrNoHandle is returned when the script doesn't define a handle function.
+var ErrNoHandle = errors.New("luaadapter: script must define a handle function")
+
+// options stores the sandboxed Lua states options.
+var options = lua.Options{
+	SkipOpenLibs:    true,
+	CallStackSize:   256,
+	RegistrySize:    1024,
+	RegistryMaxSize: 1 << 17,
+}
+
+// libs stores the Lua libraries available to the scripts.
+var libs = []struct {
+	name string
+	open lua.LGFunction
+}{
+	{lua.BaseLibName, lua.OpenBase},
+	{lua.TabLibName, lua.OpenTable},
+	{lua.StringLibName, lua.OpenString},
+	{lua.MathLibName, lua.OpenMath},
+}
+
+// unsafeFuncs stores the base library functions removed from the sandbox.
+var unsafeFuncs = []string{"dofile", "loadfile", "load", "loadstring", "require", "module", "collectgarbage"}
+
+// Script represents a compiled Lua middleware script.
+// Scripts are safe for concurrent use: every concurrent request
+// runs the script in its own pooled Lua state.
+type Script struct {
+	// Timeout defines the maximum script execution time per request, if positive.
+	// Scripts exceeding it are aborted, triggering the layer error phase.
+	// Defaults to DefaultTimeout.
+	Timeout time.Duration
+
+	proto *lua.FunctionProto
+	pool  sync.Pool
+}
+
+// state represents a sandboxed Lua state with the script loaded.
+type state struct {
+	L      *lua.LState
+	handle lua.LValue
+}
+
+// Lua compiles the given script into a middleware handler, which can be
+// registered in any layer phase, e.g: Use("request", luaadapter.Lua(script)).
+// It panics if the script cannot be compiled.
+func Lua(src string) layer.HandlerFuncNextError {
+	return MustCompile("script", src).Handle
+}
+
+// Compile compiles the given script, identified by the given name in error traces.
+// Returns ErrNoHandle if the script doesn't define a handle function.
+func Compile(name, src string) (*Script, error) {
+	chunk, err := parse.Parse(strings.NewReader(src), name)
+	if err != nil {
+		return nil, err
+	}
+	proto, err := lua.Compile(chunk, name)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Script{Timeout: DefaultTimeout, proto: proto}
+	st, err := s.state()
+	if err != nil {
+		return nil, err
+	}
+	s.pool.Put(st)
+	return s, nil
+}
+
+// MustCompile is like Compile but panics if the script cannot be compiled.
+func MustCompile(name, src string) *Script {
+	s, err := Compile(name, src)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Handle runs the script for the given request, calling the next handler
+// unless the script replied. Script errors trigger the layer error phase.
+func (s *Script) Handle(w http.ResponseWriter, r *http.Request, next http.Handler) error {
+	st, err := s.state()
+	if err != nil {
+		return err
+	}
+
+	ctx := r.Context()
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	replied := false
+	st.L.SetContext(ctx)
+	err = st.L.CallByParam(lua.P{Fn: st.handle, NRet: 0, Protect: true}, requestAPI(st.L, r), responseAPI(st.L, w, &replied))
+	st.L.RemoveContext()
+	if err != nil {
+		// Discard the state, which may be left inconsistent
+		st.L.Close()
+		return err
+	}
+	s.pool.Put(st)
+
+	if !replied {
+		next.ServeHTTP(w, r)
+	}
+	return nil
+}
+
+// state returns a pooled state, or a new sandboxed one with the script loaded.
+func (s *Script) state() (*state, error) {
+	if st, ok := s.pool.Get().(*state); ok {
+		return st, nil
+	}
+
+	L := lua.NewState(options)
+	for _, lib := range libs {
+		if err := L.CallByParam(lua.P{Fn: L.NewFunction(lib.open), NRet: 0, Protect: true}, lua.LString(lib.name)); err != nil {
+			L.Close()
+			return nil, err
+		}
+	}
+	for _, name := range unsafeFuncs {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	L.Push(L.NewFunctionFromProto(s.proto))
+	if err := L.PCall(0, lua.MultRet, nil); err != nil {
+		L.Close()
+		return nil, err
+	}
+	handle, ok := L.GetGlobal("handle").(*lua.LFunction)
+	if !ok {
+		L.Close()
+		return nil, ErrNoHandle
+	}
+	return &state{L: L, handle: handle}, nil
+}
+
+// requestAPI creates the script request API for the given request.
+func requestAPI(L *lua.LState, r *http.Request) *lua.LTable {
+	req := L.NewTable()
+	L.SetField(req, "method", lua.LString(r.Method))
+	L.SetField(req, "path", lua.LString(r.URL.Path))
+	L.SetField(req, "host", lua.LString(r.Host))
+	L.SetField(req, "url", lua.LString(r.URL.String()))
+	L.SetField(req, "header", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LString(r.Header.Get(L.CheckString(1))))
+		return 1
+	}))
+	L.SetField(req, "setHeader", L.NewFunction(func(L *lua.LState) int {
+		r.Header.Set(L.CheckString(1), L.CheckString(2))
+		return 0
+	}))
+	L.SetField(req, "delHeader", L.NewFunction(func(L *lua.LState) int {
+		r.Header.Del(L.CheckString(1))
+		return 0
+	}))
+	L.SetField(req, "query", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LString(r.URL.Query().Get(L.CheckString(1))))
+		return 1
+	}))
+	return req
+}
+
+// responseAPI creates the script response API for the given response writer.
+func responseAPI(L *lua.LState, w http.ResponseWriter, replied *bool) *lua.LTable {
+	res := L.NewTable()
+	L.SetField(res, "setHeader", L.NewFunction(func(L *lua.LState) int {
+		w.Header().Set(L.CheckString(1), L.CheckString(2))
+		return 0
+	}))
+	L.SetField(res, "send", L.NewFunction(func(L *lua.LState) int {
+		status, body := L.CheckInt(1), L.CheckString(2)
+		if !*replied {
+			*replied = true
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		}
+		return 0
+	}))
+	return res
+}
@@ -0,0 +1,70 @@
+package luaadapter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+var final = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Scripted", r.Header.Get("X-Scripted"))
+	w.WriteHeader(204)
+})
+
+func TestLua(t *testing.T) {
+	mw := layer.New()
+	mw.Use(layer.RequestPhase, Lua(`
+		function handle(req, res)
+			if req.header("Authorization") == "" then
+				res.setHeader("WWW-Authenticate", "Basic")
+				return res.send(401, "Unauthorized " .. req.method .. " " .. req.path)
+			end
+			req.setHeader("X-Scripted", req.query("name"))
+		end
+	`))
+
+	w := httptest.NewRecorder()
+	mw.Run(layer.RequestPhase, w, httptest.NewRequest("GET", "/foo", nil), final)
+	st.Expect(t, w.Code, 401)
+	st.Expect(t, w.Header().Get("WWW-Authenticate"), "Basic")
+	st.Expect(t, w.Body.String(), "Unauthorized GET /foo")
+
+	req := httptest.NewRequest("GET", "/foo?name=vinxi", nil)
+	req.Header.Set("Authorization", "Basic Zm9vOmJhcg==")
+	w = httptest.NewRecorder()
+	mw.Run(layer.RequestPhase, w, req, final)
+	st.Expect(t, w.Code, 204)
+	st.Expect(t, w.Header().Get("Scripted"), "vinxi")
+}
+
+func TestLuaTimeout(t *testing.T) {
+	script := MustCompile("loop.lua", `function handle(req, res) while true do end end`)
+	script.Timeout = 10 * time.Millisecond
+	mw := layer.New()
+	mw.Use(layer.RequestPhase, script.Handle)
+
+	w := httptest.NewRecorder()
+	mw.Run(layer.RequestPhase, w, httptest.NewRequest("GET", "/", nil), final)
+	st.Expect(t, w.Code, 500)
+}
+
+func TestLuaSandbox(t *testing.T) {
+	mw := layer.New()
+	mw.Use(layer.RequestPhase, Lua(`function handle(req, res) dofile("/etc/passwd") end`))
+
+	w := httptest.NewRecorder()
+	mw.Run(layer.RequestPhase, w, httptest.NewRequest("GET", "/", nil), final)
+	st.Expect(t, w.Code, 500)
+}
+
+func TestCompileErrors(t *testing.T) {
+	_, err := Compile("empty.lua", `local foo = 1`)
+	st.Expect(t, err, ErrNoHandle)
+
+	_, err = Compile("invalid.lua", `function handle(`)
+	st.Expect(t, err != nil, true)
+}
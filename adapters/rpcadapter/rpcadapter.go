@@ -0,0 +1,244 @@
+// Package rpcadapter implements out-of-process middleware handlers, powered
+// by hashicorp/go-plugin, isolating untrusted or crash-prone middleware
+// from the gateway process.
+//
+// Plugins are standalone binaries receiving the request metadata over RPC
+// and returning a verdict: continue the chain, optionally modifying the
+// request and response headers, or reply the request on their own:
+//
+//	type auth struct{}
+//
+//	func (auth) Handle(req *rpcadapter.Request) (*rpcadapter.Verdict, error) {
+//	  if req.Header.Get("Authorization") == "" {
+//	    return &rpcadapter.Verdict{Action: rpcadapter.Respond, Status: 401}, nil
+//	  }
+//	  return &rpcadapter.Verdict{Action: rpcadapter.Continue}, nil
+//	}
+//
+//	func main() {
+//	  rpcadapter.Serve(auth{})
+//	}
+//
+// The gateway launches the plugin binary and registers it as a handler:
+//
+//	client, err := rpcadapter.NewClient(exec.Command("./auth-plugin"))
+//	if err != nil {
+//	  log.Fatal(err)
+//	}
+//	defer client.Close()
+//	mw.Use(layer.RequestPhase, client.Handle)
+//
+// RPC failures, including plugin crashes, trigger the layer error phase
+// instead of taking the gateway process down.
+package rpcadapter
+
+import (
+	"errors"
+	"net/http"
+	"net/rpc"
+	"os/exec"
+
+	"github.com/hashicorp/go-plugin"
+)
+
+// PluginName defines the name the middleware plugin is dispensed by.
+const PluginName = "middleware"
+
+var (
+	// ErrExited is returned when the plugin process has exited.
+	ErrExited = errors.New("rpcadapter: plugin process exited")
+
+	// ErrInvalidVerdict is returned when the plugin returns an unknown verdict action.
+	ErrInvalidVerdict = errors.New("rpcadapter: invalid plugin verdict")
+)
+
+// Handshake defines the handshake shared by the gateway and the plugins,
+// preventing the plugin binaries from being executed directly.
+var Handshake = plugin.HandshakeConfig{
+	ProtocolVersion:  1,
+	MagicCookieKey:   "VINXI_LAYER_PLUGIN",
+	MagicCookieValue: "middleware",
+}
+
+// Action represents the action to perform by the gateway after a plugin call.
+type Action int
+
+const (
+	// Continue continues the middleware chain.
+	Continue Action = iota
+	// Respond replies the request with the verdict status, headers and body,
+	// skipping the rest of the chain.
+	Respond
+)
+
+// Request represents the request metadata sent to the plugins.
+type Request struct {
+	Method     string
+	URL        string
+	Proto      string
+	Host       string
+	RemoteAddr string
+	Header     http.Header
+}
+
+// NewRequest creates a new plugin request from the given HTTP request.
+func NewRequest(r *http.Request) *Request {
+	return &Request{
+		Method:     r.Method,
+		URL:        r.URL.String(),
+		Proto:      r.Proto,
+		Host:       r.Host,
+		RemoteAddr: r.RemoteAddr,
+		Header:     r.Header,
+	}
+}
+
+// Verdict represents the plugin decision about a request.
+type Verdict struct {
+	// Action defines the action to perform.
+	Action Action
+	// Header defines the response headers to set.
+	Header http.Header
+	// RequestHeader defines the request headers to set when continuing the chain.
+	RequestHeader http.Header
+	// RemoveHeader defines the request headers to remove when continuing the chain.
+	RemoveHeader []string
+	// Status defines the response status code when responding. Defaults to 200.
+	Status int
+	// Body defines the response body when responding.
+	Body []byte
+}
+
+// Middleware represents the interface implemented by the plugins.
+type Middleware interface {
+	// Handle returns the verdict for the given request.
+	Handle(*Request) (*Verdict, error)
+}
+
+// Plugin implements the go-plugin Plugin interface for middleware plugins.
+type Plugin struct {
+	// Impl stores the plugin implementation, only needed by the plugin process.
+	Impl Middleware
+}
+
+// Server returns the RPC server serving the plugin implementation.
+func (p *Plugin) Server(*plugin.MuxBroker) (interface{}, error) {
+	return &RPCServer{Impl: p.Impl}, nil
+}
+
+// Client returns the plugin implementation communicating with the given RPC client.
+func (p *Plugin) Client(b *plugin.MuxBroker, c *rpc.Client) (interface{}, error) {
+	return &RPCClient{client: c}, nil
+}
+
+// RPCServer implements the RPC server side of the plugin.
+type RPCServer struct {
+	Impl Middleware
+}
+
+// Handle handles the given request RPC call.
+func (s *RPCServer) Handle(req *Request, verdict *Verdict) error {
+	v, err := s.Impl.Handle(req)
+	if err != nil {
+		return err
+	}
+	if v != nil {
+		*verdict = *v
+	}
+	return nil
+}
+
+// RPCClient implements the Middleware interface calling the plugin via RPC.
+type RPCClient struct {
+	client *rpc.Client
+}
+
+// Handle calls the plugin with the given request.
+func (c *RPCClient) Handle(req *Request) (*Verdict, error) {
+	verdict := &Verdict{}
+	err := c.client.Call("Plugin.Handle", req, verdict)
+	return verdict, err
+}
+
+// Serve serves the given middleware implementation as a plugin.
+// It's designed to be called from the plugin binary main function.
+func Serve(impl Middleware) {
+	plugin.Serve(&plugin.ServeConfig{
+		HandshakeConfig: Handshake,
+		Plugins:         plugin.PluginSet{PluginName: &Plugin{Impl: impl}},
+	})
+}
+
+// Client represents a running middleware plugin process.
+type Client struct {
+	client *plugin.Client
+	impl   Middleware
+}
+
+// NewClient launches the plugin binary via the given command,
+// returning the client to register as layer handler.
+func NewClient(cmd *exec.Cmd) (*Client, error) {
+	client := plugin.NewClient(&plugin.ClientConfig{
+		HandshakeConfig:  Handshake,
+		Plugins:          plugin.PluginSet{PluginName: &Plugin{}},
+		Cmd:              cmd,
+		AllowedProtocols: []plugin.Protocol{plugin.ProtocolNetRPC},
+	})
+
+	rpcClient, err := client.Client()
+	if err != nil {
+		client.Kill()
+		return nil, err
+	}
+	raw, err := rpcClient.Dispense(PluginName)
+	if err != nil {
+		client.Kill()
+		return nil, err
+	}
+	return &Client{client: client, impl: raw.(Middleware)}, nil
+}
+
+// Handle calls the plugin with the request metadata and applies its verdict,
+// either continuing the chain or replying the request.
+// Failed calls trigger the layer error phase.
+func (c *Client) Handle(w http.ResponseWriter, r *http.Request, h http.Handler) error {
+	if c.client != nil && c.client.Exited() {
+		return ErrExited
+	}
+
+	v, err := c.impl.Handle(NewRequest(r))
+	if err != nil {
+		return err
+	}
+
+	for key, values := range v.Header {
+		w.Header()[http.CanonicalHeaderKey(key)] = values
+	}
+
+	switch v.Action {
+	case Continue:
+		for key, values := range v.RequestHeader {
+			r.Header[http.CanonicalHeaderKey(key)] = values
+		}
+		for _, key := range v.RemoveHeader {
+			r.Header.Del(key)
+		}
+		h.ServeHTTP(w, r)
+	case Respond:
+		status := v.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		w.WriteHeader(status)
+		w.Write(v.Body)
+	default:
+		return ErrInvalidVerdict
+	}
+	return nil
+}
+
+// Close kills the plugin process.
+func (c *Client) Close() error {
+	c.client.Kill()
+	return nil
+}
@@ -0,0 +1,111 @@
+package rpcadapter
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/rpc"
+	"testing"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+type middlewareFunc func(*Request) (*Verdict, error)
+
+func (fn middlewareFunc) Handle(req *Request) (*Verdict, error) {
+	return fn(req)
+}
+
+var final = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Plugin", r.Header.Get("X-Plugin"))
+	w.Header().Set("Removed", r.Header.Get("X-Remove"))
+	w.WriteHeader(204)
+})
+
+// newClient serves the given implementation over an in-memory RPC connection.
+func newClient(t *testing.T, impl Middleware) *Client {
+	p := &Plugin{Impl: impl}
+	srv, err := p.Server(nil)
+	st.Expect(t, err, nil)
+
+	server := rpc.NewServer()
+	st.Expect(t, server.RegisterName("Plugin", srv), nil)
+	conn, peer := net.Pipe()
+	go server.ServeConn(peer)
+
+	c := rpc.NewClient(conn)
+	raw, err := p.Client(nil, c)
+	st.Expect(t, err, nil)
+	return &Client{impl: raw.(Middleware)}
+}
+
+func TestClientContinue(t *testing.T) {
+	client := newClient(t, middlewareFunc(func(req *Request) (*Verdict, error) {
+		st.Expect(t, req.Method, "GET")
+		st.Expect(t, req.URL, "/foo?bar=baz")
+		return &Verdict{
+			Action:        Continue,
+			Header:        http.Header{"Server": {"vinxi"}},
+			RequestHeader: http.Header{"X-Plugin": {req.Header.Get("Token")}},
+			RemoveHeader:  []string{"X-Remove"},
+		}, nil
+	}))
+
+	mw := layer.New()
+	mw.Use(layer.RequestPhase, client.Handle)
+
+	req := httptest.NewRequest("GET", "/foo?bar=baz", nil)
+	req.Header.Set("Token", "secret")
+	req.Header.Set("X-Remove", "foo")
+	w := httptest.NewRecorder()
+	mw.Run(layer.RequestPhase, w, req, final)
+	st.Expect(t, w.Code, 204)
+	st.Expect(t, w.Header().Get("Server"), "vinxi")
+	st.Expect(t, w.Header().Get("Plugin"), "secret")
+	st.Expect(t, w.Header().Get("Removed"), "")
+}
+
+func TestClientRespond(t *testing.T) {
+	client := newClient(t, middlewareFunc(func(req *Request) (*Verdict, error) {
+		return &Verdict{
+			Action: Respond,
+			Status: 401,
+			Header: http.Header{"WWW-Authenticate": {"Basic"}},
+			Body:   []byte("Unauthorized"),
+		}, nil
+	}))
+
+	mw := layer.New()
+	mw.Use(layer.RequestPhase, client.Handle)
+
+	w := httptest.NewRecorder()
+	mw.Run(layer.RequestPhase, w, httptest.NewRequest("GET", "/", nil), final)
+	st.Expect(t, w.Code, 401)
+	st.Expect(t, w.Header().Get("WWW-Authenticate"), "Basic")
+	st.Expect(t, w.Body.String(), "Unauthorized")
+}
+
+func TestClientError(t *testing.T) {
+	client := newClient(t, middlewareFunc(func(req *Request) (*Verdict, error) {
+		return nil, errors.New("boom")
+	}))
+
+	mw := layer.New()
+	mw.Use(layer.RequestPhase, client.Handle)
+
+	w := httptest.NewRecorder()
+	mw.Run(layer.RequestPhase, w, httptest.NewRequest("GET", "/", nil), final)
+	st.Expect(t, w.Code, 500)
+}
+
+func TestClientInvalidVerdict(t *testing.T) {
+	client := newClient(t, middlewareFunc(func(req *Request) (*Verdict, error) {
+		return &Verdict{Action: Action(10)}, nil
+	}))
+
+	w := httptest.NewRecorder()
+	err := client.Handle(w, httptest.NewRequest("GET", "/", nil), final)
+	st.Expect(t, err, ErrInvalidVerdict)
+}
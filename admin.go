@@ -0,0 +1,165 @@
+package layer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// adminError represents an admin API error response.
+type adminError struct {
+	Error string `json:"error"`
+}
+
+// adminMove represents an admin API middleware move request.
+type adminMove struct {
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// AdminHandler returns an http.Handler exposing a small REST API to inspect
+// and mutate the given layer at runtime, designed to be mounted under a path
+// prefix via http.StripPrefix:
+//
+//	GET    /                                   the pipeline description, see Describe
+//	GET    /stats                              the layer statistics, see Stats
+//	POST   /middleware/{name}/disable          disables the named middleware, see Disable
+//	POST   /middleware/{name}/enable           enables the named middleware, see Enable
+//	DELETE /phases/{phase}                     removes every phase middleware, see FlushPhase
+//	DELETE /phases/{phase}/middleware/{name}   removes the named middleware
+//	POST   /phases/{phase}/middleware/{name}/move
+//	       {"before": "target"} or {"after": "target"}, see MoveBefore and MoveAfter
+//
+// Path segments are URL-unescaped, e.g: the wildcard phase is "%2A".
+// Mutations of frozen layers are replied with 409 Conflict, see Freeze.
+// Enable WithMiddlewareStats to expose the per-middleware call counters.
+//
+// The handler doesn't implement any authentication, so it must never
+// be exposed without protecting it first.
+func AdminHandler(l *Layer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(r.URL.EscapedPath(), "/")
+		var segments []string
+		if path != "" {
+			segments = strings.Split(path, "/")
+		}
+		for i, segment := range segments {
+			unescaped, err := url.PathUnescape(segment)
+			if err != nil {
+				writeAdminError(w, http.StatusBadRequest, err)
+				return
+			}
+			segments[i] = unescaped
+		}
+
+		// Unknown phases panic in strict phases mode
+		if len(segments) > 1 && segments[0] == "phases" {
+			if phase := l.normalizePhase(segments[1]); l.strict && !l.isValidPhase(phase) {
+				writeAdminError(w, http.StatusNotFound, &PhaseError{Phase: phase, Err: ErrUnknownPhase})
+				return
+			}
+		}
+
+		// Frozen layers cannot be mutated
+		if r.Method != "GET" && l.Frozen() {
+			writeAdminError(w, http.StatusConflict, ErrFrozen)
+			return
+		}
+
+		switch {
+		case len(segments) == 0 || (len(segments) == 1 && segments[0] == "pipeline"):
+			if allowMethod(w, r, "GET") {
+				writeAdminJSON(w, http.StatusOK, l.Describe())
+			}
+		case len(segments) == 1 && segments[0] == "stats":
+			if allowMethod(w, r, "GET") {
+				writeAdminJSON(w, http.StatusOK, l.Stats())
+			}
+		case len(segments) == 3 && segments[0] == "middleware" && (segments[2] == "disable" || segments[2] == "enable"):
+			if !allowMethod(w, r, "POST") {
+				return
+			}
+			toggle := l.Disable
+			if segments[2] == "enable" {
+				toggle = l.Enable
+			}
+			matched := toggle(segments[1])
+			if matched == 0 {
+				writeAdminError(w, http.StatusNotFound, fmt.Errorf("%s: %q", ErrUnknownMiddleware, segments[1]))
+				return
+			}
+			writeAdminJSON(w, http.StatusOK, map[string]int{"matched": matched})
+		case len(segments) == 2 && segments[0] == "phases":
+			if allowMethod(w, r, "DELETE") {
+				writeAdminJSON(w, http.StatusOK, map[string]int{"removed": l.FlushPhase(segments[1])})
+			}
+		case len(segments) == 4 && segments[0] == "phases" && segments[2] == "middleware":
+			if !allowMethod(w, r, "DELETE") {
+				return
+			}
+			removed := l.Remove(segments[1], segments[3])
+			if removed == 0 {
+				writeAdminError(w, http.StatusNotFound, &NameError{Phase: segments[1], Name: segments[3], Err: ErrUnknownMiddleware})
+				return
+			}
+			writeAdminJSON(w, http.StatusOK, map[string]int{"removed": removed})
+		case len(segments) == 5 && segments[0] == "phases" && segments[2] == "middleware" && segments[4] == "move":
+			if allowMethod(w, r, "POST") {
+				adminMoveMiddleware(l, w, r, segments[1], segments[3])
+			}
+		default:
+			writeAdminError(w, http.StatusNotFound, errors.New("vinxi: unknown admin resource"))
+		}
+	})
+}
+
+// adminMoveMiddleware moves the named middleware accordingly to the request body.
+func adminMoveMiddleware(l *Layer, w http.ResponseWriter, r *http.Request, phase, name string) {
+	move := adminMove{}
+	if err := json.NewDecoder(r.Body).Decode(&move); err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var err error
+	switch {
+	case move.Before != "" && move.After == "":
+		err = l.MoveBefore(phase, name, move.Before)
+	case move.After != "" && move.Before == "":
+		err = l.MoveAfter(phase, name, move.After)
+	default:
+		writeAdminError(w, http.StatusBadRequest, errors.New("vinxi: either before or after target is required"))
+		return
+	}
+	if err != nil {
+		writeAdminError(w, http.StatusNotFound, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, l.Describe())
+}
+
+// allowMethod replies with a method not allowed error if the request method
+// doesn't match the given one, reporting whether it matches.
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeAdminError(w, http.StatusMethodNotAllowed, errors.New("vinxi: method not allowed"))
+	return false
+}
+
+// writeAdminError replies with the given error as JSON.
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	writeAdminJSON(w, status, adminError{Error: err.Error()})
+}
+
+// writeAdminJSON replies with the given value encoded as JSON.
+func writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,101 @@
+package layer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func adminFoo(w http.ResponseWriter, r *http.Request) {}
+
+func adminBar(w http.ResponseWriter, r *http.Request) {}
+
+func adminRequest(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return w
+}
+
+func TestAdminHandlerDescribe(t *testing.T) {
+	mw := New(WithMiddlewareStats(true))
+	mw.Use("request", adminFoo)
+	mw.Run("request", httptest.NewRecorder(), &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := adminRequest(AdminHandler(mw), "GET", "/", "")
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, w.Header().Get("Content-Type"), "application/json")
+
+	desc := &Description{}
+	st.Expect(t, json.Unmarshal(w.Body.Bytes(), desc), nil)
+	st.Expect(t, desc.Phases[0].Middleware[0].Name, "layer.adminFoo")
+	st.Expect(t, desc.Phases[0].Middleware[0].Calls, uint64(1))
+
+	w = adminRequest(AdminHandler(mw), "GET", "/stats", "")
+	st.Expect(t, w.Code, 200)
+	stats := Stats{}
+	st.Expect(t, json.Unmarshal(w.Body.Bytes(), &stats), nil)
+	st.Expect(t, stats.Runs["request"], uint64(1))
+}
+
+func TestAdminHandlerMutations(t *testing.T) {
+	mw := New()
+	mw.Use("request", adminFoo, adminBar)
+	mw.Use("response", adminFoo)
+	h := AdminHandler(mw)
+
+	w := adminRequest(h, "POST", "/phases/request/middleware/layer.adminBar/move", `{"before": "layer.adminFoo"}`)
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, mw.Pool["request"].Names(), []string{"layer.adminBar", "layer.adminFoo"})
+
+	w = adminRequest(h, "POST", "/phases/request/middleware/layer.adminBar/move", `{"after": "missing"}`)
+	st.Expect(t, w.Code, 404)
+	w = adminRequest(h, "POST", "/phases/request/middleware/layer.adminBar/move", `{}`)
+	st.Expect(t, w.Code, 400)
+
+	w = adminRequest(h, "DELETE", "/phases/request/middleware/layer.adminFoo", "")
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, mw.Pool["request"].Names(), []string{"layer.adminBar"})
+	w = adminRequest(h, "DELETE", "/phases/request/middleware/layer.adminFoo", "")
+	st.Expect(t, w.Code, 404)
+
+	w = adminRequest(h, "DELETE", "/phases/response", "")
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, strings.TrimSpace(w.Body.String()), `{"removed":1}`)
+	st.Expect(t, mw.Phases(), []string{"request"})
+}
+
+func TestAdminHandlerErrors(t *testing.T) {
+	mw := New(WithStrictPhases(true))
+	h := AdminHandler(mw)
+	st.Expect(t, adminRequest(h, "POST", "/", "").Code, 405)
+	st.Expect(t, adminRequest(h, "GET", "/unknown", "").Code, 404)
+	st.Expect(t, adminRequest(h, "DELETE", "/phases/unknown", "").Code, 404)
+}
+
+func TestMoveAfter(t *testing.T) {
+	mw := New()
+	mw.UsePriority("request", Head, adminFoo)
+	mw.Use("request", adminBar)
+	st.Expect(t, mw.MoveAfter("request", "layer.adminFoo", "layer.adminBar"), nil)
+	st.Expect(t, mw.Pool["request"].Names(), []string{"layer.adminBar", "layer.adminFoo"})
+	st.Expect(t, mw.Pool["request"].Levels(), []int{NormalLevel, NormalLevel})
+	st.Expect(t, mw.MoveAfter("request", "missing", "layer.adminBar"), &NameError{Phase: "request", Name: "missing", Err: ErrUnknownMiddleware})
+}
+
+func TestAdminHandlerDisable(t *testing.T) {
+	mw := New()
+	mw.Use("request", adminFoo)
+	h := AdminHandler(mw)
+
+	w := adminRequest(h, "POST", "/middleware/layer.adminFoo/disable", "")
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, mw.Describe().Phases[0].Middleware[0].Disabled, true)
+	w = adminRequest(h, "POST", "/middleware/layer.adminFoo/enable", "")
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, mw.Describe().Phases[0].Middleware[0].Disabled, false)
+	st.Expect(t, adminRequest(h, "POST", "/middleware/missing/disable", "").Code, 404)
+}
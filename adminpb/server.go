@@ -0,0 +1,225 @@
+// Package adminpb implements the layer admin gRPC API, mirroring the HTTP
+// admin API exposed by layer.AdminHandler, kept apart from the layer package
+// so its gRPC dependencies are only required when used:
+//
+//	server := grpc.NewServer()
+//	adminpb.RegisterAdminServer(server, adminpb.NewServer(mw))
+//
+// The service is defined in admin.proto, allowing automation written in
+// any language to generate its own typed client. The Watch method streams
+// the pipeline description every time the layer changes, see Layer.Changes.
+//
+// Unknown phases and middleware are replied with NotFound, invalid requests
+// with InvalidArgument and mutations of frozen layers with FailedPrecondition.
+//
+// The server doesn't implement any authentication, so it must never
+// be exposed without protecting it first, e.g: via interceptors.
+package adminpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative admin.proto
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+// Server implements the AdminServer interface for a given layer.
+type Server struct {
+	UnimplementedAdminServer
+	// layer stores the managed layer.
+	layer *layer.Layer
+}
+
+// NewServer creates a new admin server managing the given layer.
+func NewServer(l *layer.Layer) *Server {
+	return &Server{layer: l}
+}
+
+// Describe returns the layer pipeline description.
+func (s *Server) Describe(ctx context.Context, req *DescribeRequest) (*Pipeline, error) {
+	return pipeline(s.layer.Describe()), nil
+}
+
+// Stats returns the layer statistics.
+func (s *Server) Stats(ctx context.Context, req *StatsRequest) (*LayerStats, error) {
+	stats := s.layer.Stats()
+	return &LayerStats{
+		Runs:                stats.Runs,
+		DefaultFinalHandler: stats.DefaultFinalHandler,
+		CustomFinalHandler:  stats.CustomFinalHandler,
+		ErrorPhase:          stats.ErrorPhase,
+		MemoRebuilds:        stats.MemoRebuilds,
+		SkippedRuns:         stats.SkippedRuns,
+		Latency: &Latency{
+			Count: stats.Latency.Count,
+			Mean:  durationpb.New(stats.Latency.Mean),
+			Max:   durationpb.New(stats.Latency.Max),
+			P50:   durationpb.New(stats.Latency.P50),
+			P90:   durationpb.New(stats.Latency.P90),
+			P99:   durationpb.New(stats.Latency.P99),
+		},
+		Panics: &Panics{
+			Total:      stats.Panics.Total,
+			Phases:     stats.Panics.Phases,
+			Middleware: stats.Panics.Middleware,
+		},
+	}, nil
+}
+
+// Enable enables the named middleware in every phase.
+func (s *Server) Enable(ctx context.Context, req *ToggleRequest) (*ToggleResponse, error) {
+	return s.toggle(req.GetName(), s.layer.Enable)
+}
+
+// Disable disables the named middleware in every phase.
+func (s *Server) Disable(ctx context.Context, req *ToggleRequest) (*ToggleResponse, error) {
+	return s.toggle(req.GetName(), s.layer.Disable)
+}
+
+// toggle enables or disables the named middleware via the given layer method.
+func (s *Server) toggle(name string, toggle func(string) int) (res *ToggleResponse, err error) {
+	defer recoverError(&err)
+	matched := toggle(name)
+	if matched == 0 {
+		return nil, status.Errorf(codes.NotFound, "%s: %q", layer.ErrUnknownMiddleware, name)
+	}
+	return &ToggleResponse{Matched: int64(matched)}, nil
+}
+
+// FlushPhase removes every middleware registered in the given phase.
+func (s *Server) FlushPhase(ctx context.Context, req *FlushPhaseRequest) (res *FlushPhaseResponse, err error) {
+	defer recoverError(&err)
+	return &FlushPhaseResponse{Removed: int64(s.layer.FlushPhase(req.GetPhase()))}, nil
+}
+
+// Remove removes the named middleware from the given phase.
+func (s *Server) Remove(ctx context.Context, req *RemoveRequest) (res *RemoveResponse, err error) {
+	defer recoverError(&err)
+	removed := s.layer.Remove(req.GetPhase(), req.GetName())
+	if removed == 0 {
+		return nil, statusError(&layer.NameError{Phase: req.GetPhase(), Name: req.GetName(), Err: layer.ErrUnknownMiddleware})
+	}
+	return &RemoveResponse{Removed: int64(removed)}, nil
+}
+
+// Move moves the named middleware before or after the target one.
+func (s *Server) Move(ctx context.Context, req *MoveRequest) (res *Pipeline, err error) {
+	defer recoverError(&err)
+	switch target := req.GetTarget().(type) {
+	case *MoveRequest_Before:
+		err = s.layer.MoveBefore(req.GetPhase(), req.GetName(), target.Before)
+	case *MoveRequest_After:
+		err = s.layer.MoveAfter(req.GetPhase(), req.GetName(), target.After)
+	default:
+		return nil, status.Error(codes.InvalidArgument, "vinxi: either before or after target is required")
+	}
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return pipeline(s.layer.Describe()), nil
+}
+
+// Reload replaces the layer middleware with the given configuration, see Layer.Reload.
+func (s *Server) Reload(ctx context.Context, req *ReloadRequest) (*Pipeline, error) {
+	if req.GetConfig() == nil {
+		return nil, status.Error(codes.InvalidArgument, "vinxi: missing config")
+	}
+	if err := s.layer.Reload(req.GetConfig().Layer()); err != nil {
+		return nil, statusError(err)
+	}
+	return pipeline(s.layer.Describe()), nil
+}
+
+// Watch streams the current pipeline description, and then a new one
+// every time the layer changes, until the client cancels the stream.
+// Changes happening while a description is sent are coalesced.
+func (s *Server) Watch(req *WatchRequest, stream grpc.ServerStreamingServer[Pipeline]) error {
+	for {
+		changes := s.layer.Changes()
+		if err := stream.Send(pipeline(s.layer.Describe())); err != nil {
+			return err
+		}
+		select {
+		case <-changes:
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// Layer returns the layer configuration document represented by the config.
+func (c *Config) Layer() *layer.Config {
+	config := &layer.Config{Phases: c.GetPhases()}
+	for _, mc := range c.GetMiddleware() {
+		middleware := layer.MiddlewareConfig{
+			Name:     mc.GetName(),
+			ID:       mc.GetId(),
+			Phase:    mc.GetPhase(),
+			Priority: mc.GetPriority(),
+			Options:  mc.GetOptions().AsMap(),
+		}
+		if mc.Level != nil {
+			level := int(mc.GetLevel())
+			middleware.Level = &level
+		}
+		config.Middleware = append(config.Middleware, middleware)
+	}
+	return config
+}
+
+// pipeline converts the given layer description.
+func pipeline(desc *layer.Description) *Pipeline {
+	p := &Pipeline{Generation: desc.Generation, Phases: make([]*Phase, len(desc.Phases))}
+	for i, phase := range desc.Phases {
+		middleware := make([]*Middleware, len(phase.Middleware))
+		for j, m := range phase.Middleware {
+			middleware[j] = &Middleware{
+				Name:     m.Name,
+				Priority: m.Priority,
+				Level:    int64(m.Level),
+				Source:   m.Source,
+				Disabled: m.Disabled,
+				Calls:    m.Calls,
+			}
+		}
+		p.Phases[i] = &Phase{Name: phase.Name, Middleware: middleware}
+	}
+	return p
+}
+
+// statusError converts the given layer error into a gRPC status error.
+func statusError(err error) error {
+	code := codes.Internal
+	var phaseErr *layer.PhaseError
+	var nameErr *layer.NameError
+	var configErr *layer.ConfigError
+	switch {
+	case errors.Is(err, layer.ErrFrozen):
+		code = codes.FailedPrecondition
+	case errors.As(err, &configErr):
+		code = codes.InvalidArgument
+	case errors.As(err, &phaseErr), errors.As(err, &nameErr):
+		code = codes.NotFound
+	}
+	return status.Error(code, err.Error())
+}
+
+// recoverError recovers the layer errors the mutators panic with, e.g:
+// frozen layers or unknown phases in strict phases mode, into gRPC status errors.
+func recoverError(err *error) {
+	re := recover()
+	if re == nil {
+		return
+	}
+	e, ok := re.(error)
+	if !ok {
+		panic(re)
+	}
+	*err = statusError(e)
+}
@@ -0,0 +1,197 @@
+package adminpb
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+func init() {
+	layer.RegisterFactory("adminpb-header", func(options map[string]interface{}) (interface{}, error) {
+		name, _ := options["name"].(string)
+		return func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+			w.Header().Add("X-Name", name)
+			h.ServeHTTP(w, r)
+		}, nil
+	})
+}
+
+func passthrough(w http.ResponseWriter, r *http.Request, h http.Handler) {
+	h.ServeHTTP(w, r)
+}
+
+// dial serves the admin API for the given layer, returning a connected client.
+func dial(t *testing.T, l *layer.Layer) AdminClient {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	RegisterAdminServer(server, NewServer(l))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	st.Expect(t, err, nil)
+	t.Cleanup(func() { conn.Close() })
+	return NewAdminClient(conn)
+}
+
+func TestDescribe(t *testing.T) {
+	mw := layer.New()
+	mw.UseNamed("request", "foo", passthrough)
+	client := dial(t, mw)
+
+	pipeline, err := client.Describe(context.Background(), &DescribeRequest{})
+	st.Expect(t, err, nil)
+	st.Expect(t, pipeline.Generation, mw.Generation())
+	st.Expect(t, len(pipeline.Phases), 1)
+	st.Expect(t, pipeline.Phases[0].Name, "request")
+	st.Expect(t, pipeline.Phases[0].Middleware[0].Name, "foo")
+	st.Expect(t, pipeline.Phases[0].Middleware[0].Priority, "normal")
+}
+
+func TestStats(t *testing.T) {
+	mw := layer.New()
+	mw.Run("request", httptest.NewRecorder(), &http.Request{}, nil)
+	client := dial(t, mw)
+
+	stats, err := client.Stats(context.Background(), &StatsRequest{})
+	st.Expect(t, err, nil)
+	st.Expect(t, stats.Runs["request"], uint64(1))
+	st.Expect(t, stats.DefaultFinalHandler, uint64(1))
+	st.Expect(t, stats.Latency.Count, uint64(1))
+}
+
+func TestToggle(t *testing.T) {
+	mw := layer.New()
+	mw.UseNamed("request", "foo", passthrough)
+	client := dial(t, mw)
+
+	res, err := client.Disable(context.Background(), &ToggleRequest{Name: "foo"})
+	st.Expect(t, err, nil)
+	st.Expect(t, res.Matched, int64(1))
+	st.Expect(t, mw.Describe().Phases[0].Middleware[0].Disabled, true)
+
+	_, err = client.Enable(context.Background(), &ToggleRequest{Name: "foo"})
+	st.Expect(t, err, nil)
+	st.Expect(t, mw.Describe().Phases[0].Middleware[0].Disabled, false)
+
+	_, err = client.Enable(context.Background(), &ToggleRequest{Name: "bar"})
+	st.Expect(t, status.Code(err), codes.NotFound)
+}
+
+func TestRemoveAndFlush(t *testing.T) {
+	mw := layer.New(layer.WithStrictPhases(true))
+	mw.DefinePhases("request")
+	mw.UseNamed("request", "foo", passthrough)
+	mw.UseNamed("request", "bar", passthrough)
+	client := dial(t, mw)
+
+	removed, err := client.Remove(context.Background(), &RemoveRequest{Phase: "request", Name: "foo"})
+	st.Expect(t, err, nil)
+	st.Expect(t, removed.Removed, int64(1))
+
+	_, err = client.Remove(context.Background(), &RemoveRequest{Phase: "request", Name: "foo"})
+	st.Expect(t, status.Code(err), codes.NotFound)
+
+	// Unknown phases panic in strict phases mode
+	_, err = client.FlushPhase(context.Background(), &FlushPhaseRequest{Phase: "response"})
+	st.Expect(t, status.Code(err), codes.NotFound)
+
+	flushed, err := client.FlushPhase(context.Background(), &FlushPhaseRequest{Phase: "request"})
+	st.Expect(t, err, nil)
+	st.Expect(t, flushed.Removed, int64(1))
+}
+
+func TestMove(t *testing.T) {
+	mw := layer.New()
+	mw.UseNamed("request", "foo", passthrough)
+	mw.UseNamed("request", "bar", passthrough)
+	client := dial(t, mw)
+
+	pipeline, err := client.Move(context.Background(), &MoveRequest{Phase: "request", Name: "bar", Target: &MoveRequest_Before{Before: "foo"}})
+	st.Expect(t, err, nil)
+	st.Expect(t, pipeline.Phases[0].Middleware[0].Name, "bar")
+
+	_, err = client.Move(context.Background(), &MoveRequest{Phase: "request", Name: "bar"})
+	st.Expect(t, status.Code(err), codes.InvalidArgument)
+
+	_, err = client.Move(context.Background(), &MoveRequest{Phase: "request", Name: "bar", Target: &MoveRequest_After{After: "baz"}})
+	st.Expect(t, status.Code(err), codes.NotFound)
+}
+
+func TestReload(t *testing.T) {
+	mw := layer.New()
+	mw.UseNamed("request", "foo", passthrough)
+	client := dial(t, mw)
+
+	options, err := structpb.NewStruct(map[string]interface{}{"name": "bar"})
+	st.Expect(t, err, nil)
+	config := &Config{Middleware: []*MiddlewareConfig{{Name: "adminpb-header", Id: "bar", Phase: "request", Options: options}}}
+	pipeline, err := client.Reload(context.Background(), &ReloadRequest{Config: config})
+	st.Expect(t, err, nil)
+	st.Expect(t, len(pipeline.Phases[0].Middleware), 1)
+	st.Expect(t, pipeline.Phases[0].Middleware[0].Name, "bar")
+
+	w := httptest.NewRecorder()
+	mw.Run("request", w, &http.Request{}, nil)
+	st.Expect(t, w.Header().Get("X-Name"), "bar")
+
+	config.Middleware[0].Name = "missing"
+	_, err = client.Reload(context.Background(), &ReloadRequest{Config: config})
+	st.Expect(t, status.Code(err), codes.InvalidArgument)
+
+	_, err = client.Reload(context.Background(), &ReloadRequest{})
+	st.Expect(t, status.Code(err), codes.InvalidArgument)
+}
+
+func TestFrozen(t *testing.T) {
+	mw := layer.New()
+	mw.UseNamed("request", "foo", passthrough)
+	mw.Freeze()
+	client := dial(t, mw)
+
+	_, err := client.Disable(context.Background(), &ToggleRequest{Name: "foo"})
+	st.Expect(t, status.Code(err), codes.FailedPrecondition)
+	_, err = client.Reload(context.Background(), &ReloadRequest{Config: &Config{}})
+	st.Expect(t, status.Code(err), codes.FailedPrecondition)
+	_, err = client.Describe(context.Background(), &DescribeRequest{})
+	st.Expect(t, err, nil)
+}
+
+func TestWatch(t *testing.T) {
+	mw := layer.New()
+	client := dial(t, mw)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.Watch(ctx, &WatchRequest{})
+	st.Expect(t, err, nil)
+
+	pipeline, err := stream.Recv()
+	st.Expect(t, err, nil)
+	st.Expect(t, len(pipeline.Phases), 0)
+
+	mw.UseNamed("request", "foo", passthrough)
+	pipeline, err = stream.Recv()
+	st.Expect(t, err, nil)
+	st.Expect(t, pipeline.Generation, mw.Generation())
+	st.Expect(t, pipeline.Phases[0].Middleware[0].Name, "foo")
+
+	cancel()
+	_, err = stream.Recv()
+	st.Expect(t, status.Code(err), codes.Canceled)
+}
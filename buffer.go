@@ -0,0 +1,114 @@
+package layer
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+)
+
+// WithResponseBuffering enables or disables buffering the response written
+// by the request phase handlers, which is only written to the client once
+// the response phase is completed, allowing response phase middleware
+// to read and rewrite it via BufferOf.
+//
+// If the request or response phases fail, the buffered response is discarded
+// and the error phase replies to the client instead.
+// Buffered responses cannot be flushed, hijacked or pushed.
+func WithResponseBuffering(enabled bool) Option {
+	return func(s *Layer) {
+		s.bufferResponses = enabled
+	}
+}
+
+// ResponseBuffer implements an http.ResponseWriter buffering the response in memory,
+// allowing to read and replace its status code and body before it's written.
+type ResponseBuffer struct {
+	code   int
+	header http.Header
+	body   bytes.Buffer
+}
+
+// NewResponseBuffer creates a new response buffer.
+func NewResponseBuffer() *ResponseBuffer {
+	return &ResponseBuffer{header: make(http.Header)}
+}
+
+// BufferOf returns the response buffer used by the given response writer, if any.
+// Response phase middleware can use it to rewrite the buffered response
+// when response buffering is enabled.
+func BufferOf(w http.ResponseWriter) *ResponseBuffer {
+	for w != nil {
+		if b, ok := w.(*ResponseBuffer); ok {
+			return b
+		}
+		u, ok := w.(wrapper)
+		if !ok {
+			return nil
+		}
+		w = u.Unwrap()
+	}
+	return nil
+}
+
+// Header returns the buffered response headers.
+func (b *ResponseBuffer) Header() http.Header {
+	return b.header
+}
+
+// WriteHeader stores the response status code, if not already written.
+func (b *ResponseBuffer) WriteHeader(code int) {
+	if b.code == 0 {
+		b.code = code
+	}
+}
+
+// Write buffers the given response body data.
+func (b *ResponseBuffer) Write(data []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(data)
+}
+
+// Status returns the buffered response status code, or 0 if not written yet.
+func (b *ResponseBuffer) Status() int {
+	return b.code
+}
+
+// SetStatus replaces the buffered response status code.
+func (b *ResponseBuffer) SetStatus(code int) {
+	b.code = code
+}
+
+// Body returns the buffered response body.
+// The returned slice is only valid until the next buffer modification.
+func (b *ResponseBuffer) Body() []byte {
+	return b.body.Bytes()
+}
+
+// SetBody replaces the buffered response body.
+func (b *ResponseBuffer) SetBody(data []byte) {
+	b.body.Reset()
+	b.Write(data)
+}
+
+// reset discards the buffered response.
+func (b *ResponseBuffer) reset() {
+	b.code = 0
+	b.header = make(http.Header)
+	b.body.Reset()
+}
+
+// writeTo writes a copy of the buffered response to the given writer,
+// updating the Content-Length header if present.
+func (b *ResponseBuffer) writeTo(w http.ResponseWriter) {
+	header := w.Header()
+	for k, v := range b.header {
+		header[k] = append([]string(nil), v...)
+	}
+	if header.Get("Content-Length") != "" {
+		header.Set("Content-Length", strconv.Itoa(b.body.Len()))
+	}
+	if b.code != 0 {
+		w.WriteHeader(b.code)
+	}
+	w.Write(b.body.Bytes())
+}
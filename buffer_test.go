@@ -0,0 +1,49 @@
+package layer
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func TestResponseBuffering(t *testing.T) {
+	mw := New(WithResponseBuffering(true))
+	mw.Use(ResponsePhase, func(w http.ResponseWriter, r *http.Request) {
+		buf := BufferOf(w)
+		st.Expect(t, buf.Status(), 200)
+		buf.SetBody(bytes.Replace(buf.Body(), []byte("world"), []byte("vinxi"), 1))
+		buf.Header().Set("X-Rewritten", "true")
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run(RequestPhase, w, httptest.NewRequest("GET", "/", nil), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "11")
+		w.Write([]byte("hello world"))
+		st.Expect(t, w.(ResponseWriter).BytesWritten(), 11)
+	}))
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, w.Body.String(), "hello vinxi")
+	st.Expect(t, w.Header().Get("Content-Length"), "11")
+	st.Expect(t, w.Header().Get("X-Rewritten"), "true")
+}
+
+func TestResponseBufferingDiscardedOnError(t *testing.T) {
+	mw := New(WithResponseBuffering(true))
+	mw.Use(ResponsePhase, func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run(RequestPhase, w, httptest.NewRequest("GET", "/", nil), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	}))
+	st.Expect(t, w.Code, 500)
+	st.Expect(t, w.Body.String(), "Proxy Error")
+}
+
+func TestBufferOfUnbuffered(t *testing.T) {
+	st.Expect(t, BufferOf(NewResponseWriter(httptest.NewRecorder())) == nil, true)
+}
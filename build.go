@@ -0,0 +1,107 @@
+package layer
+
+import (
+	"context"
+	"net/http"
+)
+
+// Pipeline represents an immutable compiled layer configuration.
+// See Layer.Build.
+type Pipeline struct {
+	// layer stores the frozen layer copy serving the requests.
+	layer *Layer
+}
+
+// Build compiles the current layer configuration into a standalone
+// immutable Pipeline, fully decoupled from subsequent mutations of the layer,
+// separating the configuration time from the serving time.
+//
+// The pipeline serves requests without locking and keeps its own statistics.
+// Inherited layers are built as well, while the parent layer, if any,
+// is still run as is. Staged layers and loaded plugins are not part
+// of the pipeline, although the handlers registered by plugins are.
+func (s *Layer) Build() *Pipeline {
+	s.mutex.RLock()
+	l := &Layer{
+		skipCommitted:     s.skipCommitted,
+		keepWrittenFinal:  s.keepWrittenFinal,
+		normalize:         s.normalize,
+		foldCase:          s.foldCase,
+		strict:            s.strict,
+		strictTransitions: s.strictTransitions,
+		noRecover:         s.noRecover,
+		recoverFunc:       s.recoverFunc,
+		panicFilter:       s.panicFilter,
+		statusErrors:      s.statusErrors,
+		bufferResponses:   s.bufferResponses,
+		canary:            s.canary,
+		splitKey:          s.splitKey,
+		middlewareStats:   s.middlewareStats,
+		profilerLabels:    s.profilerLabels,
+		requestTrace:      s.requestTrace,
+		logger:            s.logger,
+		observers:         s.observers,
+		injector:          s.injector,
+		order:             s.phases(),
+		stackFactory:      s.stackFactory,
+		defined:           s.defined,
+		timeouts:          s.timeouts,
+		finalTimeout:      s.finalTimeout,
+		generation:        s.generation,
+		finalHandler:      s.finalHandler,
+		finalErrorHandler: s.finalErrorHandler,
+		parent:            s.parent,
+		inherit:           s.inherit,
+		childFirst:        s.childFirst,
+		Pool:              make(Pool, len(s.Pool)),
+	}
+	for phase, stack := range s.Pool {
+		if stack != nil {
+			l.Pool[phase] = stack.clone()
+		}
+	}
+	s.mutex.RUnlock()
+
+	s.statsMutex.Lock()
+	l.panicHooks = append([]PanicHook(nil), s.panicHooks...)
+	s.statsMutex.Unlock()
+
+	if l.inherit != nil {
+		l.inherit = l.inherit.Build().layer
+	}
+	l.Freeze()
+	return &Pipeline{layer: l}
+}
+
+// Run triggers the pipeline middleware call chain for the given phase.
+// See Layer.Run.
+func (p *Pipeline) Run(phase string, w http.ResponseWriter, r *http.Request, h http.Handler) {
+	p.layer.Run(phase, w, r, h)
+}
+
+// RunContext triggers the pipeline middleware call chain for the given phase,
+// propagating the given context onto the request. See Layer.RunContext.
+func (p *Pipeline) RunContext(ctx context.Context, phase string, w http.ResponseWriter, r *http.Request, h http.Handler) {
+	p.layer.RunContext(ctx, phase, w, r, h)
+}
+
+// ServeHTTP implements the http.Handler interface, running
+// the request phase middleware chain with the pipeline final handler.
+func (p *Pipeline) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.layer.ServeHTTP(w, r)
+}
+
+// Generation returns the layer configuration generation the pipeline was built from.
+func (p *Pipeline) Generation() uint64 {
+	return p.layer.generation
+}
+
+// Describe returns a point-in-time description of the pipeline. See Layer.Describe.
+func (p *Pipeline) Describe() *Description {
+	return p.layer.Describe()
+}
+
+// Stats returns the pipeline statistics. See Layer.Stats.
+func (p *Pipeline) Stats() Stats {
+	return p.layer.Stats()
+}
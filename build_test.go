@@ -0,0 +1,53 @@
+package layer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func TestBuild(t *testing.T) {
+	mw := New()
+	mw.Use("request", orderHandler("foo"))
+	mw.UseFinalHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Order", "final")
+	}))
+
+	p := mw.Build()
+	st.Expect(t, p.Generation(), mw.Generation())
+
+	// Subsequent layer mutations don't affect the pipeline
+	mw.Use("request", orderHandler("bar"))
+	mw.UseFinalHandler(http.NotFoundHandler())
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, w.Header()["X-Order"], []string{"foo", "final"})
+	st.Expect(t, p.Stats().Runs["request"], uint64(1))
+	st.Expect(t, mw.Stats().Runs["request"], uint64(0))
+	st.Expect(t, mw.Frozen(), false)
+
+	w = httptest.NewRecorder()
+	mw.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Code, 404)
+	st.Expect(t, w.Header()["X-Order"], []string{"foo", "bar"})
+}
+
+func TestBuildInherited(t *testing.T) {
+	parent := New()
+	parent.Use("request", orderHandler("parent"))
+	child := NewChild(parent)
+	child.Use("request", orderHandler("child"))
+
+	p := child.Build()
+	parent.Use("request", orderHandler("late"))
+
+	w := httptest.NewRecorder()
+	p.Run("request", w, &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Order", "final")
+	}))
+	st.Expect(t, w.Header()["X-Order"], []string{"parent", "child", "final"})
+}
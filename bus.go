@@ -0,0 +1,120 @@
+package layer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+var (
+	// ErrUnknownCommand is used when a layer command type is unknown.
+	ErrUnknownCommand = errors.New("vinxi: unknown command")
+
+	// ErrStaleCommand is used when a layer command version is not greater than the last applied one.
+	ErrStaleCommand = errors.New("vinxi: stale command")
+)
+
+// Command types applied via Apply.
+const (
+	// CommandReload replaces the layer middleware with the command configuration document.
+	CommandReload = "reload"
+	// CommandDisable disables the command named middleware, e.g: as kill switch.
+	CommandDisable = "disable"
+	// CommandEnable enables the command named middleware.
+	CommandEnable = "enable"
+)
+
+// Command represents a layer configuration command, designed to be published
+// as JSON on a message bus so many layer replicas converge to the same pipeline:
+//
+//	{"type": "reload", "version": 42, "config": {"middleware": [{"name": "cors", "phase": "request"}]}}
+//	{"type": "disable", "version": 43, "name": "auth"}
+type Command struct {
+	// Type defines the command type: reload, disable or enable.
+	Type string `json:"type"`
+	// Version defines the command version, if any. Versioned commands not greater
+	// than the last applied one are ignored, so redelivered or reordered commands
+	// never roll the layer back.
+	Version uint64 `json:"version,omitempty"`
+	// Config defines the configuration document applied by reload commands.
+	Config *Config `json:"config,omitempty"`
+	// Name defines the middleware name toggled by disable and enable commands.
+	Name string `json:"name,omitempty"`
+}
+
+// Transport represents a message bus subscription delivering layer commands,
+// e.g: a NATS subject or a Kafka topic, implemented by the transports packages.
+type Transport interface {
+	// Receive blocks until the next message is delivered, returning its payload,
+	// or until the given context is done, returning its error.
+	Receive(ctx context.Context) ([]byte, error)
+}
+
+// Apply applies the given command to the layer as a single transaction:
+// reload commands are applied via Reload, while disable and enable commands
+// are applied via Disable and Enable, returning ErrUnknownMiddleware if no
+// middleware matches the name. Commands are applied one at a time.
+//
+// It returns ErrStaleCommand if the command version is not greater than the
+// last applied one, ErrUnknownCommand if the command type is unknown, and
+// ErrFrozen if the layer is frozen. Failed commands don't update the version.
+func (s *Layer) Apply(cmd *Command) error {
+	s.commandMutex.Lock()
+	defer s.commandMutex.Unlock()
+	if cmd.Version != 0 && cmd.Version <= s.commandVersion {
+		return ErrStaleCommand
+	}
+	if s.Frozen() {
+		return ErrFrozen
+	}
+
+	switch cmd.Type {
+	case CommandReload:
+		if cmd.Config == nil {
+			return errors.New("vinxi: missing reload command config")
+		}
+		if err := s.Reload(cmd.Config); err != nil {
+			return err
+		}
+	case CommandDisable, CommandEnable:
+		toggle := s.Disable
+		if cmd.Type == CommandEnable {
+			toggle = s.Enable
+		}
+		if toggle(cmd.Name) == 0 {
+			return fmt.Errorf("%w: %q", ErrUnknownMiddleware, cmd.Name)
+		}
+	default:
+		return ErrUnknownCommand
+	}
+
+	if cmd.Version != 0 {
+		s.commandVersion = cmd.Version
+	}
+	return nil
+}
+
+// Subscribe applies the commands received from the given transport, see Apply,
+// until the context is done or the transport fails, returning the error.
+//
+// Messages are decoded as JSON commands. Invalid, stale or failing commands
+// don't stop the subscription: they're logged as warnings, see WithLogger.
+func (s *Layer) Subscribe(ctx context.Context, transport Transport) error {
+	for {
+		data, err := transport.Receive(ctx)
+		if err != nil {
+			return err
+		}
+
+		cmd := &Command{}
+		if err := json.Unmarshal(data, cmd); err != nil {
+			s.log(ctx, slog.LevelWarn, "vinxi: invalid command", "error", err)
+			continue
+		}
+		if err := s.Apply(cmd); err != nil {
+			s.log(ctx, slog.LevelWarn, "vinxi: command failed", "type", cmd.Type, "version", cmd.Version, "error", err)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package layer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+// chanTransport implements a Transport delivering the messages sent to its channel.
+type chanTransport chan []byte
+
+func (t chanTransport) Receive(ctx context.Context) ([]byte, error) {
+	select {
+	case data := <-t:
+		return data, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestApply(t *testing.T) {
+	mw := New()
+	config := &Config{Middleware: []MiddlewareConfig{
+		{Name: "test-header", ID: "foo", Phase: "request", Options: map[string]interface{}{"name": "foo"}},
+	}}
+
+	st.Expect(t, mw.Apply(&Command{Type: CommandReload, Version: 2, Config: config}), nil)
+	st.Expect(t, mw.Pool["request"].Names(), []string{"foo"})
+
+	st.Expect(t, mw.Apply(&Command{Type: CommandDisable, Version: 3, Name: "foo"}), nil)
+	st.Expect(t, mw.Describe().Phases[0].Middleware[0].Disabled, true)
+
+	// Redelivered and reordered commands are ignored
+	st.Expect(t, mw.Apply(&Command{Type: CommandEnable, Version: 3, Name: "foo"}), ErrStaleCommand)
+	st.Expect(t, mw.Apply(&Command{Type: CommandReload, Version: 1, Config: config}), ErrStaleCommand)
+	st.Expect(t, mw.Describe().Phases[0].Middleware[0].Disabled, true)
+
+	// Failed commands don't update the version
+	err := mw.Apply(&Command{Type: CommandEnable, Version: 4, Name: "bar"})
+	st.Expect(t, errors.Is(err, ErrUnknownMiddleware), true)
+	st.Expect(t, mw.Apply(&Command{Type: "restart", Version: 4}), ErrUnknownCommand)
+	st.Expect(t, mw.Apply(&Command{Type: CommandReload, Version: 4}) != nil, true)
+	st.Expect(t, mw.Apply(&Command{Type: CommandEnable, Version: 4, Name: "foo"}), nil)
+	st.Expect(t, mw.Describe().Phases[0].Middleware[0].Disabled, false)
+
+	// Unversioned commands are always applied
+	st.Expect(t, mw.Apply(&Command{Type: CommandDisable, Name: "foo"}), nil)
+	st.Expect(t, mw.Describe().Phases[0].Middleware[0].Disabled, true)
+
+	mw.Freeze()
+	st.Expect(t, mw.Apply(&Command{Type: CommandEnable, Version: 5, Name: "foo"}), ErrFrozen)
+}
+
+func TestSubscribe(t *testing.T) {
+	buf := &bytes.Buffer{}
+	mw := New(WithLogger(newTestLogger(buf)))
+	mw.UseNamed("request", "foo", func(w http.ResponseWriter, r *http.Request, h http.Handler) {})
+
+	transport := make(chanTransport)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- mw.Subscribe(ctx, transport)
+	}()
+
+	transport <- []byte(`{"type": "disable", "version": 1, "name": "foo"}`)
+	transport <- []byte(`invalid`)
+	transport <- []byte(`{"type": "enable", "version": 1, "name": "foo"}`)
+	transport <- []byte(`{"type": "reload", "version": 2, "config": {"middleware": [
+		{"name": "test-header", "id": "bar", "phase": "request", "options": {"name": "bar"}}
+	]}}`)
+	cancel()
+	st.Expect(t, <-done, context.Canceled)
+
+	st.Expect(t, mw.Pool["request"].Names(), []string{"bar"})
+	logs := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	st.Expect(t, len(logs), 2)
+	st.Expect(t, strings.HasPrefix(logs[0], `level=WARN msg="vinxi: invalid command"`), true)
+	st.Expect(t, logs[1], `level=WARN msg="vinxi: command failed" type=enable version=1 error="vinxi: stale command"`)
+}
@@ -0,0 +1,363 @@
+package layer
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CachedResponse represents a cached HTTP response.
+type CachedResponse struct {
+	// StatusCode stores the response status code.
+	StatusCode int
+	// Header stores the response headers.
+	Header http.Header
+	// Body stores the response body.
+	Body []byte
+	// Vary stores the request header values the response varies on, if any.
+	Vary http.Header
+}
+
+// CacheStore represents the required interface implemented by response cache stores.
+type CacheStore interface {
+	// Get returns the cached response for the given key, if present and not expired.
+	Get(key string) (*CachedResponse, bool)
+	// Set stores the given response for the given key during the given TTL.
+	Set(key string, res *CachedResponse, ttl time.Duration)
+}
+
+// memoryItem represents a memory store cache entry.
+type memoryItem struct {
+	res     *CachedResponse
+	expires time.Time
+}
+
+// MemoryStore implements an in-memory CacheStore.
+// Expired entries are evicted lazily on lookup.
+type MemoryStore struct {
+	mutex sync.RWMutex
+	items map[string]memoryItem
+}
+
+// NewMemoryStore creates a new in-memory cache store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{items: make(map[string]memoryItem)}
+}
+
+// Get returns the cached response for the given key, if present and not expired.
+func (m *MemoryStore) Get(key string) (*CachedResponse, bool) {
+	m.mutex.RLock()
+	item, ok := m.items[key]
+	m.mutex.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(item.expires) {
+		m.mutex.Lock()
+		delete(m.items, key)
+		m.mutex.Unlock()
+		return nil, false
+	}
+	return item.res, true
+}
+
+// Set stores the given response for the given key during the given TTL.
+func (m *MemoryStore) Set(key string, res *CachedResponse, ttl time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.items[key] = memoryItem{res: res, expires: time.Now().Add(ttl)}
+}
+
+// CacheStats stores the cache hit and miss counters.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// HitRatio returns the cache hit ratio, between 0 and 1.
+func (s CacheStats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// Cache implements a response caching middleware backed by a pluggable store.
+//
+// Cache hits are replied directly in the request phase, before the rest
+// of the phase chain and the final handler are reached, while the responses
+// of cache misses are recorded as they're written and stored by the response
+// phase, once completed. If response buffering is enabled, the response
+// rewritten by the response phase is stored instead, see WithResponseBuffering.
+//
+// Only GET requests and 200 responses are cached, using the TTL defined by
+// the response Cache-Control header. Responses marked as private or no-store,
+// setting cookies or varying on every request ("Vary: *") are never cached,
+// while the ones varying on request headers are only served to requests
+// with the same header values. Requests with credentials, i.e: Authorization
+// or Cookie headers, are never cached unless Credentials is enabled.
+//
+// Cache implements the Registrable interface, registering itself in the
+// request and response phases with Head priority:
+//
+//	mw.Use("request", layer.NewCache(layer.NewMemoryStore()))
+type Cache struct {
+	// hits and misses store the cache counters, accessed atomically.
+	hits, misses uint64
+	// Store stores the cache store used to store responses.
+	Store CacheStore
+	// Key stores the function used to compute the request cache key.
+	Key func(*http.Request) string
+	// Credentials enables caching requests with credentials, which are
+	// otherwise served by the next handler. The Key function must tell
+	// apart the responses of every user, otherwise they're served across users.
+	Credentials bool
+}
+
+// NewCache creates a new response cache middleware using the given store.
+func NewCache(store CacheStore) *Cache {
+	return &Cache{Store: store, Key: DefaultCacheKey}
+}
+
+// DefaultCacheKey returns the request method, host and URL as cache key.
+func DefaultCacheKey(r *http.Request) string {
+	return r.Method + " " + r.Host + r.URL.String()
+}
+
+// Stats returns the cache hit and miss counters.
+func (c *Cache) Stats() CacheStats {
+	return CacheStats{Hits: atomic.LoadUint64(&c.hits), Misses: atomic.LoadUint64(&c.misses)}
+}
+
+// Register registers the cache middleware in the request phase, serving
+// the cached responses, and in the response phase, storing them.
+func (c *Cache) Register(mw Middleware) {
+	mw.UsePriority(RequestPhase, Head, c.HandleHTTP)
+	mw.UsePriority(ResponsePhase, Head, c.save)
+}
+
+// HandleHTTP serves cached responses or records the downstream response,
+// which is stored by the response phase.
+func (c *Cache) HandleHTTP(w http.ResponseWriter, r *http.Request, h http.Handler) {
+	if r.Method != "GET" || noCache(r.Header.Get("Cache-Control")) || (!c.Credentials && credentials(r)) {
+		h.ServeHTTP(w, r)
+		return
+	}
+
+	key := c.Key(r)
+	if res, ok := c.Store.Get(key); ok && res.varies(r) {
+		atomic.AddUint64(&c.hits, 1)
+		header := w.Header()
+		for k, v := range res.Header {
+			header[k] = append([]string(nil), v...)
+		}
+		header.Set("X-Cache", "HIT")
+		w.WriteHeader(res.StatusCode)
+		w.Write(res.Body)
+		return
+	}
+
+	atomic.AddUint64(&c.misses, 1)
+	rec := &cacheRecorder{ResponseWriter: w}
+	setLocal(r, "vinxi.cache", &cacheMiss{cache: c, key: key, recorder: rec})
+	w.Header().Set("X-Cache", "MISS")
+	h.ServeHTTP(NewResponseWriter(rec), r)
+}
+
+// save stores the response of the request cache miss, if any and cacheable,
+// once the rest of the response phase is completed.
+func (c *Cache) save(w http.ResponseWriter, r *http.Request, h http.Handler) {
+	h.ServeHTTP(w, r)
+
+	miss, ok := getValue(r, "vinxi.cache").(*cacheMiss)
+	if !ok || miss == nil || miss.cache != c {
+		return
+	}
+	setLocal(r, "vinxi.cache", nil)
+	if miss.recorder.hijacked {
+		return
+	}
+
+	code, header, body := miss.recorder.code, miss.recorder.header, miss.recorder.body.Bytes()
+	if buf := BufferOf(w); buf != nil {
+		code, header, body = buf.Status(), buf.Header(), buf.Body()
+	}
+	if code == 0 {
+		code = http.StatusOK
+	}
+	ttl := cacheTTL(header.Get("Cache-Control"))
+	if code != http.StatusOK || ttl <= 0 || header.Get("Set-Cookie") != "" {
+		return
+	}
+	vary, ok := varyHeaders(header, r)
+	if !ok {
+		return
+	}
+
+	res := &CachedResponse{StatusCode: code, Header: cloneHeader(header), Body: append([]byte(nil), body...), Vary: vary}
+	res.Header.Del("X-Cache")
+	c.Store.Set(miss.key, res, ttl)
+}
+
+// cacheMiss stores a cache miss response pending to be stored by the response phase.
+type cacheMiss struct {
+	cache    *Cache
+	key      string
+	recorder *cacheRecorder
+}
+
+// cacheRecorder records the response written by the downstream handlers.
+type cacheRecorder struct {
+	http.ResponseWriter
+	code     int
+	header   http.Header
+	body     bytes.Buffer
+	hijacked bool
+}
+
+// WriteHeader records and writes the response status code and headers.
+func (w *cacheRecorder) WriteHeader(code int) {
+	w.record(code)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write records and writes the response body.
+func (w *cacheRecorder) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.body.Write(b[:n])
+	return n, err
+}
+
+// Flush sends any buffered data to the client, if supported by the underlying writer.
+func (w *cacheRecorder) Flush() {
+	if w.code == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	flush(w.ResponseWriter)
+}
+
+// Hijack lets the caller take over the connection, if supported by the underlying writer.
+// Hijacked responses are never cached.
+func (w *cacheRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := hijack(w.ResponseWriter)
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Push initiates an HTTP/2 server push, if supported by the underlying writer.
+func (w *cacheRecorder) Push(target string, opts *http.PushOptions) error {
+	return push(w.ResponseWriter, target, opts)
+}
+
+// CloseNotify returns a channel notifying when the client connection has gone away,
+// if supported by the underlying writer.
+func (w *cacheRecorder) CloseNotify() <-chan bool {
+	return closeNotify(w.ResponseWriter)
+}
+
+// ReadFrom reads data from the given reader and writes it to the response body,
+// recording it.
+func (w *cacheRecorder) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(writerOnly{w}, r)
+}
+
+// Unwrap returns the wrapped response writer.
+func (w *cacheRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// record records the response status code and headers, if not recorded yet.
+func (w *cacheRecorder) record(code int) {
+	if w.code == 0 {
+		w.code, w.header = code, cloneHeader(w.ResponseWriter.Header())
+	}
+}
+
+// varies reports whether the cached response can be served to the given request,
+// matching the request header values the response varies on.
+func (res *CachedResponse) varies(r *http.Request) bool {
+	for name, values := range res.Vary {
+		if strings.Join(r.Header[name], ",") != strings.Join(values, ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// varyHeaders returns the given request header values the given response
+// headers vary on, reporting false if the response varies on every request.
+func varyHeaders(header http.Header, r *http.Request) (http.Header, bool) {
+	vary := make(http.Header)
+	for _, value := range header["Vary"] {
+		for _, name := range strings.Split(value, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "*" {
+				return nil, false
+			}
+			if name != "" {
+				vary[name] = append([]string(nil), r.Header[name]...)
+			}
+		}
+	}
+	return vary, true
+}
+
+// credentials reports whether the given request carries credentials.
+func credentials(r *http.Request) bool {
+	return r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != ""
+}
+
+// cloneHeader returns a deep copy of the given headers.
+func cloneHeader(header http.Header) http.Header {
+	clone := make(http.Header, len(header))
+	for k, v := range header {
+		clone[k] = append([]string(nil), v...)
+	}
+	return clone
+}
+
+// noCache reports whether the given request Cache-Control header
+// disables serving cached responses.
+func noCache(header string) bool {
+	for _, directive := range strings.Split(header, ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "no-cache", "no-store":
+			return true
+		}
+	}
+	return false
+}
+
+// cacheTTL returns the cache TTL defined by the given response Cache-Control header,
+// preferring s-maxage over max-age. Returns zero if the response is not cacheable.
+func cacheTTL(header string) time.Duration {
+	var maxAge, sMaxAge int
+	for _, directive := range strings.Split(header, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-store", directive == "no-cache", directive == "private":
+			return 0
+		case strings.HasPrefix(directive, "s-maxage="):
+			sMaxAge, _ = strconv.Atoi(strings.TrimPrefix(directive, "s-maxage="))
+		case strings.HasPrefix(directive, "max-age="):
+			maxAge, _ = strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+		}
+	}
+	if sMaxAge > 0 {
+		return time.Duration(sMaxAge) * time.Second
+	}
+	return time.Duration(maxAge) * time.Second
+}
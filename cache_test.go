@@ -0,0 +1,183 @@
+package layer
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/utils.v0"
+)
+
+func TestCache(t *testing.T) {
+	cache := NewCache(NewMemoryStore())
+	mw := New()
+	mw.UsePriority(RequestPhase, Head, cache)
+
+	calls := 0
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		w.Write([]byte("hello world"))
+	})
+
+	for i := 0; i < 3; i++ {
+		w := utils.NewWriterStub()
+		mw.Run(RequestPhase, w, &http.Request{Method: "GET", URL: &url.URL{Path: "/foo"}}, final)
+		st.Expect(t, w.Code, 200)
+		st.Expect(t, string(w.Body), "hello world")
+	}
+
+	st.Expect(t, calls, 1)
+	st.Expect(t, cache.Stats(), CacheStats{Hits: 2, Misses: 1})
+	st.Expect(t, cache.Stats().HitRatio(), 2.0/3.0)
+}
+
+func TestCacheNotCacheable(t *testing.T) {
+	cache := NewCache(NewMemoryStore())
+
+	calls := 0
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "private, max-age=60")
+	})
+
+	for i := 0; i < 2; i++ {
+		w := utils.NewWriterStub()
+		cache.HandleHTTP(w, &http.Request{Method: "GET", URL: &url.URL{Path: "/foo"}}, h)
+		st.Expect(t, w.Header().Get("X-Cache"), "MISS")
+	}
+	cache.HandleHTTP(utils.NewWriterStub(), &http.Request{Method: "POST", URL: &url.URL{Path: "/foo"}}, h)
+
+	st.Expect(t, calls, 3)
+	st.Expect(t, cache.Stats(), CacheStats{Misses: 2})
+}
+
+func TestCacheMissFlusher(t *testing.T) {
+	cache := NewCache(NewMemoryStore())
+	mw := New()
+	mw.UsePriority(RequestPhase, Head, cache)
+
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		w.Write([]byte("hello"))
+		flusher, ok := w.(http.Flusher)
+		st.Expect(t, ok, true)
+		flusher.Flush()
+		io.WriteString(w, " world")
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run(RequestPhase, w, &http.Request{Method: "GET", URL: &url.URL{Path: "/foo"}}, final)
+	st.Expect(t, w.Flushed, true)
+	st.Expect(t, w.Header().Get("X-Cache"), "MISS")
+
+	w = httptest.NewRecorder()
+	mw.Run(RequestPhase, w, &http.Request{Method: "GET", URL: &url.URL{Path: "/foo"}}, final)
+	st.Expect(t, w.Header().Get("X-Cache"), "HIT")
+	st.Expect(t, w.Body.String(), "hello world")
+}
+
+func cacheRequest(header http.Header) *http.Request {
+	return &http.Request{Method: "GET", URL: &url.URL{Path: "/foo"}, Header: header}
+}
+
+func TestCacheCredentials(t *testing.T) {
+	cache := NewCache(NewMemoryStore())
+	mw := New()
+	mw.Use(RequestPhase, cache)
+
+	calls := 0
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(r.Header.Get("Authorization")))
+	})
+
+	for _, user := range []string{"foo", "bar"} {
+		w := utils.NewWriterStub()
+		mw.Run(RequestPhase, w, cacheRequest(http.Header{"Authorization": {user}}), final)
+		st.Expect(t, string(w.Body), user)
+	}
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, cacheRequest(http.Header{"Cookie": {"session=foo"}}), final)
+	st.Expect(t, calls, 3)
+	st.Expect(t, cache.Stats(), CacheStats{})
+
+	cache.Credentials = true
+	for i := 0; i < 2; i++ {
+		mw.Run(RequestPhase, utils.NewWriterStub(), cacheRequest(http.Header{"Authorization": {"foo"}}), final)
+	}
+	st.Expect(t, calls, 4)
+	st.Expect(t, cache.Stats(), CacheStats{Hits: 1, Misses: 1})
+}
+
+func TestCacheVary(t *testing.T) {
+	cache := NewCache(NewMemoryStore())
+	mw := New()
+	mw.Use(RequestPhase, cache)
+
+	calls := 0
+	vary := "Accept-Language"
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", vary)
+		w.Write([]byte(r.Header.Get("Accept-Language")))
+	})
+
+	for _, lang := range []string{"en", "en", "es", "es"} {
+		w := utils.NewWriterStub()
+		mw.Run(RequestPhase, w, cacheRequest(http.Header{"Accept-Language": {lang}}), final)
+		st.Expect(t, string(w.Body), lang)
+	}
+	st.Expect(t, calls, 2)
+	st.Expect(t, cache.Stats(), CacheStats{Hits: 2, Misses: 2})
+
+	vary = "*"
+	cache.Store = NewMemoryStore()
+	for i := 0; i < 2; i++ {
+		mw.Run(RequestPhase, utils.NewWriterStub(), cacheRequest(nil), final)
+	}
+	st.Expect(t, calls, 4)
+}
+
+func TestCacheResponsePhase(t *testing.T) {
+	cache := NewCache(NewMemoryStore())
+	mw := New(WithResponseBuffering(true))
+	mw.Use(RequestPhase, cache)
+	mw.Use(ResponsePhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		BufferOf(w).SetBody([]byte("rewritten"))
+		h.ServeHTTP(w, r)
+	})
+
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("hello world"))
+	})
+	mw.Run(RequestPhase, utils.NewWriterStub(), cacheRequest(nil), final)
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, cacheRequest(nil), final)
+	st.Expect(t, w.Header().Get("X-Cache"), "HIT")
+	st.Expect(t, string(w.Body), "rewritten")
+}
+
+func TestCacheTTL(t *testing.T) {
+	st.Expect(t, cacheTTL("max-age=10"), 10*time.Second)
+	st.Expect(t, cacheTTL("max-age=10, s-maxage=20"), 20*time.Second)
+	st.Expect(t, cacheTTL("no-store, max-age=10"), time.Duration(0))
+	st.Expect(t, cacheTTL(""), time.Duration(0))
+}
+
+func TestMemoryStoreExpiration(t *testing.T) {
+	store := NewMemoryStore()
+	store.Set("foo", &CachedResponse{StatusCode: 200}, -time.Second)
+
+	_, ok := store.Get("foo")
+	st.Expect(t, ok, false)
+	st.Expect(t, len(store.items), 0)
+}
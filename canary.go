@@ -0,0 +1,122 @@
+package layer
+
+import (
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultCanaryMinRequests defines the default minimum number of canary
+// requests served before evaluating the canary error rate.
+const DefaultCanaryMinRequests = 100
+
+// Canary defines a canary final handler, serving a percentage of the
+// requests instead of the layer final handler.
+type Canary struct {
+	// Handler defines the canary final handler.
+	Handler http.Handler
+	// Percent defines the percentage of requests served by the canary, from 0 to 100.
+	Percent float64
+	// Threshold defines the maximum error phase activation rate of the
+	// canary requests, from 0 to 1. Once exceeded, the canary is rolled back
+	// and every request is served by the layer final handler again.
+	Threshold float64
+	// MinRequests defines the minimum number of canary requests served before
+	// evaluating the error rate. Defaults to DefaultCanaryMinRequests.
+	MinRequests uint64
+	// OnRollback is called once the canary is rolled back, if defined.
+	OnRollback func(CanaryStats)
+}
+
+// CanaryStats stores the canary final handler counters.
+type CanaryStats struct {
+	// Requests stores the number of requests served by the canary.
+	Requests uint64
+	// Errors stores the number of canary requests activating the error phase.
+	Errors uint64
+	// RolledBack stores if the canary has been rolled back.
+	RolledBack bool
+}
+
+// canary implements the canary final handler, accessed atomically.
+type canary struct {
+	requests, errors, rolledBack uint64
+	config                       Canary
+	rollback                     sync.Once
+}
+
+// UseCanaryFinalHandler registers a canary final handler alongside the layer
+// final handler, serving the given percentage of the requests.
+// The canary is automatically rolled back if its error phase activation rate
+// exceeds the given threshold, e.g: due to panics, errors or 5xx responses
+// if WithStatusErrors is enabled. See CanaryStats.
+//
+// The canary only replaces the layer final handler, used when Run is called
+// with a nil final handler. A nil canary handler removes the canary.
+func (s *Layer) UseCanaryFinalHandler(config Canary) {
+	var c *canary
+	if !isNil(config.Handler) {
+		if config.MinRequests == 0 {
+			config.MinRequests = DefaultCanaryMinRequests
+		}
+		c = &canary{config: config}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.mutable()
+	s.canary = c
+	s.bump()
+}
+
+// CanaryStats returns the canary final handler counters,
+// or zero counters if no canary is registered.
+func (s *Layer) CanaryStats() CanaryStats {
+	s.mutex.RLock()
+	c := s.canary
+	s.mutex.RUnlock()
+	if c == nil {
+		return CanaryStats{}
+	}
+	return c.stats()
+}
+
+// handler returns the final handler serving the canary requests
+// and the given primary final handler ones.
+func (c *canary) handler(primary http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadUint64(&c.rolledBack) == 1 || rand.Float64()*100 >= c.config.Percent {
+			primary.ServeHTTP(w, r)
+			return
+		}
+		atomic.AddUint64(&c.requests, 1)
+		setLocal(r, "vinxi.canary", c)
+		c.config.Handler.ServeHTTP(w, r)
+	})
+}
+
+// recordError records a canary request error phase activation,
+// rolling back the canary if the error rate exceeds the threshold.
+func (c *canary) recordError() {
+	errors := atomic.AddUint64(&c.errors, 1)
+	requests := atomic.LoadUint64(&c.requests)
+	if requests < c.config.MinRequests || float64(errors)/float64(requests) <= c.config.Threshold {
+		return
+	}
+	c.rollback.Do(func() {
+		atomic.StoreUint64(&c.rolledBack, 1)
+		if c.config.OnRollback != nil {
+			c.config.OnRollback(c.stats())
+		}
+	})
+}
+
+// stats returns the canary counters.
+func (c *canary) stats() CanaryStats {
+	return CanaryStats{
+		Requests:   atomic.LoadUint64(&c.requests),
+		Errors:     atomic.LoadUint64(&c.errors),
+		RolledBack: atomic.LoadUint64(&c.rolledBack) == 1,
+	}
+}
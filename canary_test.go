@@ -0,0 +1,65 @@
+package layer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func TestCanaryFinalHandler(t *testing.T) {
+	mw := New(WithFinalHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})))
+	mw.UseCanaryFinalHandler(Canary{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(202) }),
+		Percent: 100,
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run("request", w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 202)
+	st.Expect(t, mw.CanaryStats(), CanaryStats{Requests: 1})
+
+	// Explicit final handlers are never replaced
+	w = httptest.NewRecorder()
+	mw.Run("request", w, &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(204) }))
+	st.Expect(t, w.Code, 204)
+
+	mw.UseCanaryFinalHandler(Canary{})
+	w = httptest.NewRecorder()
+	mw.Run("request", w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, mw.CanaryStats(), CanaryStats{})
+}
+
+func TestCanaryRollback(t *testing.T) {
+	mw := New(WithFinalHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})))
+
+	var rolledBack CanaryStats
+	mw.UseCanaryFinalHandler(Canary{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(errors.New("canary failure"))
+		}),
+		Percent:     100,
+		Threshold:   0.5,
+		MinRequests: 3,
+		OnRollback:  func(stats CanaryStats) { rolledBack = stats },
+	})
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		mw.Run("request", w, &http.Request{}, nil)
+		st.Expect(t, w.Code, 500)
+	}
+	st.Expect(t, rolledBack, CanaryStats{Requests: 3, Errors: 3, RolledBack: true})
+
+	w := httptest.NewRecorder()
+	mw.Run("request", w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, mw.CanaryStats(), CanaryStats{Requests: 3, Errors: 3, RolledBack: true})
+}
@@ -0,0 +1,97 @@
+package layer
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrNilFinalHandler is reported when the layer final handler is nil
+	// and the default final handler is used instead.
+	ErrNilFinalHandler = errors.New("vinxi: nil final handler, using default final handler")
+
+	// ErrNilFinalErrorHandler is reported when both the layer final error handler
+	// and the package level FinalErrorHandler are nil and the built-in
+	// final error handler is used instead.
+	ErrNilFinalErrorHandler = errors.New("vinxi: nil FinalErrorHandler, using built-in final error handler")
+
+	// ErrParentCycle is reported when the layer ancestors chain contains a cycle.
+	ErrParentCycle = errors.New("vinxi: parent layers contain a cycle")
+)
+
+// CheckError aggregates the problems found while auditing a layer.
+type CheckError struct {
+	// Errors stores the list of problems found in the layer.
+	Errors []error
+}
+
+// Error returns the error message.
+func (e *CheckError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Check audits the layer configuration looking for misconfigurations
+// that are silently covered by safe defaults at serve time, such as nil
+// final handlers, nil phase stacks, handlers registered for undefined
+// phases or cyclic parent layers.
+// It's designed to be called once at startup, before serving traffic.
+//
+// Returns a *CheckError listing every problem found, or nil if none.
+func (s *Layer) Check() error {
+	s.mutex.RLock()
+	var errs []error
+	if isNil(s.finalHandler) {
+		errs = append(errs, ErrNilFinalHandler)
+	}
+
+	phases := make([]string, 0, len(s.Pool))
+	for phase := range s.Pool {
+		phases = append(phases, phase)
+	}
+	sort.Strings(phases)
+	for _, phase := range phases {
+		if s.Pool[phase] == nil {
+			errs = append(errs, fmt.Errorf("vinxi: nil middleware stack for phase %q", phase))
+		}
+		if s.defined != nil && phase != AllPhases && !s.defined[phase] {
+			errs = append(errs, &PhaseError{Phase: phase, Err: ErrUnknownPhase})
+		}
+	}
+	finalError := s.finalErrorHandler
+	s.mutex.RUnlock()
+
+	if isNil(finalError) && FinalErrorHandler == nil {
+		errs = append(errs, ErrNilFinalErrorHandler)
+	}
+	if s.hasParentCycle() {
+		errs = append(errs, ErrParentCycle)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return &CheckError{Errors: errs}
+}
+
+// hasParentCycle reports whether the layer ancestors chain is cyclic.
+func (s *Layer) hasParentCycle() bool {
+	seen := map[*Layer]bool{}
+	for layer := s; layer != nil; {
+		if seen[layer] {
+			return true
+		}
+		seen[layer] = true
+
+		layer.mutex.RLock()
+		parent, _ := layer.parent.(*Layer)
+		layer.mutex.RUnlock()
+		layer = parent
+	}
+	return false
+}
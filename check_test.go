@@ -0,0 +1,61 @@
+package layer
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/utils.v0"
+)
+
+func TestCheck(t *testing.T) {
+	mw := New()
+	mw.Use(RequestPhase, FinalHandler)
+	st.Expect(t, mw.Check(), nil)
+}
+
+func TestCheckNilFinalHandler(t *testing.T) {
+	mw := New()
+	mw.UseFinalHandler(nil)
+
+	err, ok := mw.Check().(*CheckError)
+	st.Expect(t, ok, true)
+	st.Expect(t, err.Errors, []error{ErrNilFinalHandler})
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 502)
+	st.Expect(t, string(w.Body), "Bad Gateway")
+}
+
+func TestCheckNilFinalErrorHandler(t *testing.T) {
+	defer func(h http.HandlerFunc) { FinalErrorHandler = h }(FinalErrorHandler)
+	FinalErrorHandler = nil
+
+	mw := New()
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+
+	err, ok := mw.Check().(*CheckError)
+	st.Expect(t, ok, true)
+	st.Expect(t, err.Errors, []error{ErrNilFinalErrorHandler})
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 500)
+	st.Expect(t, string(w.Body), "Proxy Error")
+}
+
+func TestCheckNilStackAndParentCycle(t *testing.T) {
+	parent := New()
+	mw := New()
+	mw.SetParent(parent)
+	parent.SetParent(mw)
+	mw.Pool["foo"] = nil
+
+	err, ok := mw.Check().(*CheckError)
+	st.Expect(t, ok, true)
+	st.Expect(t, len(err.Errors), 2)
+	st.Expect(t, err.Error(), `vinxi: nil middleware stack for phase "foo"; `+ErrParentCycle.Error())
+}
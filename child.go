@@ -0,0 +1,53 @@
+package layer
+
+// InheritOrder represents the execution order of the inherited middleware.
+type InheritOrder int
+
+const (
+	// ParentFirst runs the inherited parent middleware before the child ones.
+	ParentFirst InheritOrder = iota
+
+	// ChildFirst runs the child middleware before the inherited parent ones.
+	ChildFirst
+)
+
+// WithInheritOrder defines the execution order of the middleware
+// inherited from the parent layer. See NewChild.
+// Defaults to ParentFirst.
+func WithInheritOrder(order InheritOrder) Option {
+	return func(s *Layer) {
+		s.childFirst = order == ChildFirst
+	}
+}
+
+// NewChild creates a new middleware layer inheriting the phase middleware
+// of the given parent layer: every phase runs the parent middleware first,
+// then the child ones, unless defined otherwise via WithInheritOrder,
+// so phases without child middleware fall back to the parent ones.
+//
+// Unlike SetParent, the inherited middleware are spliced into the child
+// phase chains, including the request phase, without copying the parent
+// stacks, so subsequent parent changes apply to the child too.
+// The parent final handlers are not inherited.
+func NewChild(parent *Layer, opts ...Option) *Layer {
+	child := New(opts...)
+	child.inherit = parent
+	return child
+}
+
+// inherit joins the inherited and own middleware queues in the given order.
+func inherit(inherited, own []MiddlewareFunc, childFirst bool) []MiddlewareFunc {
+	if len(inherited) == 0 {
+		return own
+	}
+	if len(own) == 0 {
+		return inherited
+	}
+	first, second := inherited, own
+	if childFirst {
+		first, second = own, inherited
+	}
+	queue := make([]MiddlewareFunc, 0, len(first)+len(second))
+	queue = append(queue, first...)
+	return append(queue, second...)
+}
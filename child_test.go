@@ -0,0 +1,52 @@
+package layer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func runOrder(mw *Layer, phase string) []string {
+	w := httptest.NewRecorder()
+	mw.Run(phase, w, &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Order", "final")
+	}))
+	return w.Header()["X-Order"]
+}
+
+func TestNewChild(t *testing.T) {
+	parent := New()
+	parent.Use("request", orderHandler("parent"))
+	parent.Use("foo", orderHandler("parent-foo"))
+
+	child := NewChild(parent)
+	child.Use("request", orderHandler("child"))
+	st.Expect(t, runOrder(child, "request"), []string{"parent", "child", "final"})
+	st.Expect(t, runOrder(child, "foo"), []string{"parent-foo", "final"})
+
+	// Parent changes apply to the child
+	parent.Use("request", orderHandler("parent-late"))
+	st.Expect(t, runOrder(child, "request"), []string{"parent", "parent-late", "child", "final"})
+	st.Expect(t, runOrder(parent, "request"), []string{"parent", "parent-late", "final"})
+}
+
+func TestNewChildOrder(t *testing.T) {
+	parent := New()
+	parent.Use("request", orderHandler("parent"))
+	parent.Use("error", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.WriteHeader(503)
+	})
+
+	child := NewChild(parent, WithInheritOrder(ChildFirst))
+	child.Use("request", orderHandler("child"))
+	st.Expect(t, runOrder(child, "request"), []string{"child", "parent", "final"})
+
+	child.Use("request", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		panic("boom")
+	})
+	w := httptest.NewRecorder()
+	child.Run("request", w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 503)
+}
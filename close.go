@@ -0,0 +1,88 @@
+package layer
+
+import (
+	"context"
+	"io"
+)
+
+// Shutdowner is implemented by the stateful middleware handlers
+// requiring a graceful teardown, such as connection pools or
+// background flushers. See Layer.Shutdown.
+type Shutdowner interface {
+	// Shutdown gracefully releases the handler resources,
+	// honoring the given context deadline.
+	Shutdown(context.Context) error
+}
+
+// Close tears down the layer middleware, see Shutdown.
+func (s *Layer) Close() error {
+	return s.Shutdown(context.Background())
+}
+
+// Shutdown tears down the registered middleware handlers and final handlers
+// implementing Shutdowner or io.Closer, in reverse registration order, and
+// closes the loaded plugins implementing io.Closer, see LoadPlugin.
+// Handlers registered in multiple phases are only closed once.
+//
+// Every handler is closed even if some of them fail, returning the first error.
+// The layer configuration is kept as is, so Shutdown must only be called
+// once the layer is no longer serving requests.
+func (s *Layer) Shutdown(ctx context.Context) error {
+	s.mutex.RLock()
+	var handlers []interface{}
+	for _, phase := range s.phases() {
+		if stack := s.Pool[phase]; stack != nil {
+			handlers = appendUnique(handlers, stack.Handlers()...)
+		}
+	}
+	handlers = appendUnique(handlers, s.finalHandler, s.finalErrorHandler)
+	plugins := make([]*loadedPlugin, 0, len(s.plugins))
+	for _, p := range s.plugins {
+		plugins = append(plugins, p)
+	}
+	s.mutex.RUnlock()
+
+	var err error
+	for i := len(handlers) - 1; i >= 0; i-- {
+		if cerr := shutdown(ctx, handlers[i]); err == nil {
+			err = cerr
+		}
+	}
+	for _, p := range plugins {
+		if cerr := p.close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// shutdown shuts down the given handler, if it implements Shutdowner or io.Closer.
+func shutdown(ctx context.Context, handler interface{}) error {
+	switch h := handler.(type) {
+	case Shutdowner:
+		return h.Shutdown(ctx)
+	case io.Closer:
+		return h.Close()
+	}
+	return nil
+}
+
+// appendUnique appends the given non-nil handlers not present in the given list.
+func appendUnique(list []interface{}, handlers ...interface{}) []interface{} {
+	for _, h := range handlers {
+		if isNil(h) {
+			continue
+		}
+		unique := true
+		for _, seen := range list {
+			if sameHandler(seen, h) {
+				unique = false
+				break
+			}
+		}
+		if unique {
+			list = append(list, h)
+		}
+	}
+	return list
+}
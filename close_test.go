@@ -0,0 +1,53 @@
+package layer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+type closerHandler struct {
+	name   string
+	closed *[]string
+	err    error
+}
+
+func (c *closerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {}
+
+func (c *closerHandler) Close() error {
+	*c.closed = append(*c.closed, c.name)
+	return c.err
+}
+
+type shutdownHandler struct {
+	closerHandler
+	ctx context.Context
+}
+
+func (s *shutdownHandler) Shutdown(ctx context.Context) error {
+	s.ctx = ctx
+	return s.Close()
+}
+
+func TestClose(t *testing.T) {
+	var closed []string
+	foo := &closerHandler{name: "foo", closed: &closed}
+	bar := &shutdownHandler{closerHandler: closerHandler{name: "bar", closed: &closed}}
+	final := &closerHandler{name: "final", closed: &closed, err: errors.New("boom")}
+	p := &testPlugin{}
+
+	mw := New()
+	mw.UsePhases([]string{"request", "response"}, foo)
+	mw.Use("request", bar, func(h http.Handler) http.Handler { return h })
+	mw.UseFinalHandler(final)
+	st.Expect(t, mw.usePlugin("foo.so", p), nil)
+
+	st.Expect(t, mw.Close().Error(), "boom")
+	st.Expect(t, closed, []string{"final", "bar", "foo"})
+	st.Expect(t, bar.ctx, context.Background())
+	st.Expect(t, p.closed, 1)
+	st.Expect(t, mw.Phases(), []string{"request", "response"})
+}
@@ -0,0 +1,95 @@
+package layer
+
+import (
+	"net/http"
+	"sync"
+)
+
+// CoalesceKeyFunc represents the function used to compute the coalescing key
+// of a request. Requests with the same key are coalesced, while an empty key
+// disables coalescing for the request.
+type CoalesceKeyFunc func(*http.Request) string
+
+// DefaultCoalesceKey returns the request method, host and URL as coalescing key.
+// Note that request headers are not part of the key, so a custom key function
+// must be used if responses vary per request header (e.g: Authorization).
+func DefaultCoalesceKey(r *http.Request) string {
+	return r.Method + " " + r.Host + r.URL.String()
+}
+
+// Coalesce returns a middleware decorator that collapses concurrent identical
+// GET and HEAD requests into a single execution of the downstream chain,
+// broadcasting the buffered response to every waiting request.
+// Waiting requests whose context is done return without writing a response.
+//
+// If key is nil, DefaultCoalesceKey is used.
+func Coalesce(key CoalesceKeyFunc) func(http.Handler) http.Handler {
+	if key == nil {
+		key = DefaultCoalesceKey
+	}
+	c := &coalescer{key: key, calls: make(map[string]*coalescedCall)}
+	return c.middleware
+}
+
+// coalescer implements the requests coalescing middleware.
+type coalescer struct {
+	mutex sync.Mutex
+	key   CoalesceKeyFunc
+	calls map[string]*coalescedCall
+}
+
+// coalescedCall represents an in-flight coalesced downstream call.
+type coalescedCall struct {
+	done chan struct{}
+	res  *ResponseBuffer
+}
+
+// middleware implements the coalescing middleware function.
+func (c *coalescer) middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		key := c.key(r)
+		if key == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		c.mutex.Lock()
+		if call, ok := c.calls[key]; ok {
+			c.mutex.Unlock()
+			// Stop waiting once the client goes away, leaving the response unwritten
+			select {
+			case <-call.done:
+			case <-r.Context().Done():
+				return
+			}
+			// If the leader call failed, serve the request on its own
+			if call.res == nil {
+				h.ServeHTTP(w, r)
+				return
+			}
+			call.res.writeTo(w)
+			return
+		}
+		call := &coalescedCall{done: make(chan struct{})}
+		c.calls[key] = call
+		c.mutex.Unlock()
+
+		// Release the waiters even if the downstream chain panics
+		defer func() {
+			c.mutex.Lock()
+			delete(c.calls, key)
+			c.mutex.Unlock()
+			close(call.done)
+		}()
+
+		res := NewResponseBuffer()
+		h.ServeHTTP(res, r)
+		call.res = res
+		res.writeTo(w)
+	})
+}
@@ -0,0 +1,114 @@
+package layer
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/utils.v0"
+)
+
+func TestCoalesce(t *testing.T) {
+	mw := New()
+
+	var entered int32
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		atomic.AddInt32(&entered, 1)
+		h.ServeHTTP(w, r)
+	})
+	mw.Use(RequestPhase, Coalesce(nil))
+
+	var calls int32
+	release := make(chan struct{})
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		w.Header().Set("foo", "bar")
+		w.WriteHeader(201)
+		w.Write([]byte("hello world"))
+	})
+
+	writers := make([]*utils.WriterStub, 5)
+	var wg sync.WaitGroup
+	for i := range writers {
+		writers[i] = utils.NewWriterStub()
+		wg.Add(1)
+		go func(w *utils.WriterStub) {
+			defer wg.Done()
+			req := &http.Request{Method: "GET", URL: &url.URL{Path: "/foo"}}
+			mw.Run(RequestPhase, w, req, final)
+		}(writers[i])
+	}
+
+	// Wait for every request to reach the coalescing middleware
+	for atomic.LoadInt32(&entered) < int32(len(writers)) || atomic.LoadInt32(&calls) == 0 {
+		runtime.Gosched()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	st.Expect(t, atomic.LoadInt32(&calls), int32(1))
+	for _, w := range writers {
+		st.Expect(t, w.Code, 201)
+		st.Expect(t, w.Header().Get("foo"), "bar")
+		st.Expect(t, string(w.Body), "hello world")
+	}
+}
+
+func TestCoalesceSkipsUnsafeMethods(t *testing.T) {
+	calls := 0
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	})
+
+	h := Coalesce(nil)(final)
+	h.ServeHTTP(utils.NewWriterStub(), &http.Request{Method: "POST", URL: &url.URL{Path: "/foo"}})
+	h.ServeHTTP(utils.NewWriterStub(), &http.Request{Method: "GET", URL: &url.URL{Path: "/foo"}})
+	st.Expect(t, calls, 2)
+}
+
+func TestCoalesceEmptyKey(t *testing.T) {
+	calls := 0
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	})
+
+	h := Coalesce(func(r *http.Request) string { return "" })(final)
+	h.ServeHTTP(utils.NewWriterStub(), &http.Request{Method: "GET", URL: &url.URL{Path: "/foo"}})
+	st.Expect(t, calls, 1)
+}
+
+func TestCoalesceCanceledWaiter(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(201)
+	})
+	h := Coalesce(nil)(final)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.ServeHTTP(utils.NewWriterStub(), &http.Request{Method: "GET", URL: &url.URL{Path: "/foo"}})
+	}()
+	<-started
+
+	// The waiter returns once its context is canceled, before the leader completes
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := utils.NewWriterStub()
+	req := (&http.Request{Method: "GET", URL: &url.URL{Path: "/foo"}}).WithContext(ctx)
+	h.ServeHTTP(w, req)
+	st.Expect(t, w.Code, 0)
+
+	close(release)
+	<-done
+}
@@ -0,0 +1,93 @@
+package layer
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+)
+
+// BuildPolicy represents when the layer phase chains are built.
+type BuildPolicy int
+
+const (
+	// LazyBuild builds and memoizes the phase chains on the first Run
+	// after a mutation, the default policy.
+	LazyBuild BuildPolicy = iota
+
+	// EagerBuild builds and memoizes the phase chains right away
+	// on every mutation, e.g: at Use time, so Run never builds them.
+	EagerBuild
+
+	// ExplicitBuild only memoizes the phase chains on explicit Compile calls.
+	// Phase chains mutated since the last Compile are composed
+	// on every Run, without memoizing them, until compiled again.
+	ExplicitBuild
+)
+
+// WithBuildPolicy defines when the layer phase chains are built,
+// allowing to choose where the chain construction cost lands.
+// Defaults to LazyBuild.
+func WithBuildPolicy(policy BuildPolicy) Option {
+	return func(s *Layer) {
+		s.buildPolicy = policy
+	}
+}
+
+// Compile eagerly builds and memoizes every phase middleware chain,
+// so the first requests don't pay the chain construction cost, and
+// audits the layer configuration, so misconfigurations surface before
+// serving traffic. Inherited layers are compiled as well, see NewChild.
+//
+// Besides the problems reported by Check, chains containing nil middleware
+// functions, e.g: pushed directly into the Pool stacks or returned by
+// a custom stack implementation, are reported as *HandlerError.
+// It's designed to be called once at startup, after registering the middleware.
+//
+// Returns a *CheckError listing every problem found, or nil if none.
+func (s *Layer) Compile() error {
+	var errs []error
+	if err, ok := s.Check().(*CheckError); ok {
+		errs = append(errs, err.Errors...)
+	}
+
+	s.mutex.Lock()
+	errs = append(errs, s.compile()...)
+	s.mutex.Unlock()
+
+	if s.inherit != nil {
+		if err, ok := s.inherit.Compile().(*CheckError); ok {
+			errs = append(errs, err.Errors...)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	for _, err := range errs {
+		s.log(context.Background(), slog.LevelWarn, "vinxi: configuration problem", "error", err)
+	}
+	return &CheckError{Errors: errs}
+}
+
+// compile memoizes every phase middleware chain not memoized yet,
+// returning the nil middleware functions found as errors.
+// The mutex must be held.
+func (s *Layer) compile() []error {
+	var errs []error
+	for _, phase := range s.phases() {
+		stack := s.Pool[phase]
+		if stack == nil {
+			continue
+		}
+		if stack.memo == nil {
+			stack.join(s.Pool[AllPhases])
+			atomic.AddUint64(&s.counters.memoRebuilds, 1)
+		}
+		for i, fn := range stack.memo {
+			if fn == nil {
+				errs = append(errs, &HandlerError{Phase: phase, Index: i, Err: ErrNilHandler})
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,60 @@
+package layer
+
+import (
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func TestCompile(t *testing.T) {
+	mw := New()
+	mw.Use("request", orderHandler("foo"))
+	mw.Use(AllPhases, orderHandler("all"))
+	st.Expect(t, mw.Compile(), nil)
+	st.Expect(t, len(mw.Pool["request"].memo), 2)
+	st.Expect(t, mw.Stats().MemoRebuilds, uint64(2))
+
+	// Memoized chains are reused
+	st.Expect(t, runOrder(mw, "request"), []string{"all", "foo", "final"})
+	st.Expect(t, mw.Stats().MemoRebuilds, uint64(2))
+}
+
+func TestCompileErrors(t *testing.T) {
+	mw := New()
+	mw.Use("request", orderHandler("foo"))
+	mw.Pool["request"].Push(Normal, nil)
+	mw.UseFinalHandler(nil)
+
+	err := mw.Compile().(*CheckError)
+	st.Expect(t, err.Errors, []error{
+		ErrNilFinalHandler,
+		&HandlerError{Phase: "request", Index: 1, Err: ErrNilHandler},
+	})
+
+	child := NewChild(mw)
+	st.Expect(t, len(child.Compile().(*CheckError).Errors), 2)
+}
+
+func TestBuildPolicy(t *testing.T) {
+	mw := New(WithBuildPolicy(EagerBuild))
+	mw.Use("request", orderHandler("foo"))
+	st.Expect(t, mw.Stats().MemoRebuilds, uint64(1))
+	mw.Use(AllPhases, orderHandler("all"))
+	st.Expect(t, mw.Stats().MemoRebuilds, uint64(3))
+	st.Expect(t, runOrder(mw, "request"), []string{"all", "foo", "final"})
+	st.Expect(t, mw.Stats().MemoRebuilds, uint64(3))
+
+	mw = New(WithBuildPolicy(ExplicitBuild))
+	mw.Use("request", orderHandler("foo"))
+	st.Expect(t, runOrder(mw, "request"), []string{"foo", "final"})
+	st.Expect(t, mw.Stats().MemoRebuilds, uint64(0))
+
+	st.Expect(t, mw.Compile(), nil)
+	st.Expect(t, mw.Stats().MemoRebuilds, uint64(1))
+	st.Expect(t, runOrder(mw, "request"), []string{"foo", "final"})
+
+	// Mutations take effect before compiling them again
+	mw.Use("request", orderHandler("bar"))
+	st.Expect(t, runOrder(mw, "request"), []string{"foo", "bar", "final"})
+	st.Expect(t, mw.Stats().MemoRebuilds, uint64(1))
+}
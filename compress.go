@@ -0,0 +1,242 @@
+package layer
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// EncoderFunc represents the function used to create a compressing writer
+// for a specific content encoding. Returned writers may optionally implement
+// a Flush() error method, used to flush streaming responses.
+type EncoderFunc func(io.Writer) io.WriteCloser
+
+// incompressible stores the content type prefixes already compressed.
+var incompressible = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zstd",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/octet-stream",
+	"font/woff",
+}
+
+// Compressor implements a response compression middleware negotiating
+// the content encoding via the Accept-Encoding request header.
+//
+// gzip encoding is supported out of the box, and additional encodings can be
+// plugged in via Register, such as zstd, provided by the encoders/zstdencoder
+// package to keep its dependency out of the layer package. Responses already encoded
+// or with an already compressed content type are never compressed,
+// and streaming responses are preserved via http.Flusher.
+//
+// Compressor implements the Handler interface, so it can be registered via Use:
+//
+//	mw.Use("request", layer.NewCompressor())
+type Compressor struct {
+	// encodings stores the supported encodings, in order of preference.
+	encodings []string
+	// encoders stores the encoder functions by encoding name.
+	encoders map[string]EncoderFunc
+}
+
+// NewCompressor creates a new response compressor supporting gzip encoding.
+func NewCompressor() *Compressor {
+	c := &Compressor{encoders: make(map[string]EncoderFunc)}
+	c.Register("gzip", func(w io.Writer) io.WriteCloser {
+		return gzip.NewWriter(w)
+	})
+	return c
+}
+
+// Register registers a new content encoding supported by the compressor.
+// Encodings registered first are preferred when the client accepts
+// several encodings with the same quality value.
+func (c *Compressor) Register(encoding string, fn EncoderFunc) {
+	if _, ok := c.encoders[encoding]; !ok {
+		c.encodings = append(c.encodings, encoding)
+	}
+	c.encoders[encoding] = fn
+}
+
+// HandleHTTP compresses the downstream response, if accepted by the client.
+// Responses which could have been compressed always vary on Accept-Encoding,
+// even if not compressed, so caches never serve them to the wrong clients.
+func (c *Compressor) HandleHTTP(w http.ResponseWriter, r *http.Request, h http.Handler) {
+	cw := &compressWriter{ResponseWriter: w}
+	if encoding := c.negotiate(r.Header.Get("Accept-Encoding")); encoding != "" && r.Method != "HEAD" {
+		cw.encoding, cw.encoder = encoding, c.encoders[encoding]
+	}
+	defer cw.close()
+	h.ServeHTTP(NewResponseWriter(cw), r)
+}
+
+// negotiate returns the preferred supported encoding accepted by the given
+// Accept-Encoding header value, or an empty string if none.
+func (c *Compressor) negotiate(header string) string {
+	accepted := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					q = v
+				}
+			}
+		}
+		accepted[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range c.encodings {
+		q, ok := accepted[encoding]
+		if !ok {
+			q, ok = accepted["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compressWriter implements a response writer compressing the response body,
+// deciding whether to compress when the response headers are written.
+// Responses are never compressed if no encoder is negotiated.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	encoder     EncoderFunc
+	writer      io.WriteCloser
+	wroteHeader bool
+}
+
+// WriteHeader decides whether to compress the response and writes the response headers.
+// Informational responses are written as is, since the final response headers follow.
+func (w *compressWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	if code < 200 {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.wroteHeader = true
+
+	header := w.Header()
+	if compressible(code, header) {
+		addVary(header, "Accept-Encoding")
+		if w.encoder != nil {
+			header.Set("Content-Encoding", w.encoding)
+			header.Del("Content-Length")
+			w.writer = w.encoder(w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes the given data, compressing it if required.
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(data))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.writer == nil {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.writer.Write(data)
+}
+
+// Flush flushes the buffered compressed data and the underlying writer, if supported,
+// writing the response headers first, if not written yet.
+func (w *compressWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.writer.(interface {
+		Flush() error
+	}); ok {
+		f.Flush()
+	}
+	flush(w.ResponseWriter)
+}
+
+// Hijack lets the caller take over the connection, if supported by the underlying writer.
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hijack(w.ResponseWriter)
+}
+
+// Push initiates an HTTP/2 server push, if supported by the underlying writer.
+func (w *compressWriter) Push(target string, opts *http.PushOptions) error {
+	return push(w.ResponseWriter, target, opts)
+}
+
+// CloseNotify returns a channel notifying when the client connection has gone away,
+// if supported by the underlying writer.
+func (w *compressWriter) CloseNotify() <-chan bool {
+	return closeNotify(w.ResponseWriter)
+}
+
+// ReadFrom reads data from the given reader and writes it, compressing it if required.
+func (w *compressWriter) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(writerOnly{w}, r)
+}
+
+// Unwrap returns the wrapped response writer.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close closes the compressing writer, if any.
+func (w *compressWriter) close() {
+	if w.writer != nil {
+		w.writer.Close()
+	}
+}
+
+// addVary adds the given header name to the Vary response header, unless already present.
+func addVary(header http.Header, name string) {
+	for _, value := range header["Vary"] {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field == "*" || strings.EqualFold(field, name) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", name)
+}
+
+// compressible reports whether a response with the given status code
+// and headers can be compressed.
+func compressible(code int, header http.Header) bool {
+	if code < 200 || code == http.StatusNoContent || code == http.StatusNotModified {
+		return false
+	}
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	for _, prefix := range incompressible {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,179 @@
+package layer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func TestCompressor(t *testing.T) {
+	mw := New()
+	mw.Use(RequestPhase, NewCompressor())
+
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "11")
+		w.Write([]byte("hello world"))
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "deflate, gzip;q=0.8")
+	w := httptest.NewRecorder()
+	mw.Run(RequestPhase, w, req, final)
+
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, w.Header().Get("Content-Encoding"), "gzip")
+	st.Expect(t, w.Header().Get("Content-Length"), "")
+	st.Expect(t, w.Header().Get("Vary"), "Accept-Encoding")
+
+	reader, err := gzip.NewReader(w.Body)
+	st.Expect(t, err, nil)
+	body, _ := ioutil.ReadAll(reader)
+	st.Expect(t, string(body), "hello world")
+}
+
+func TestCompressorNotAccepted(t *testing.T) {
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0, br")
+	w := httptest.NewRecorder()
+	NewCompressor().HandleHTTP(w, req, final)
+
+	st.Expect(t, w.Header().Get("Content-Encoding"), "")
+	st.Expect(t, w.Header().Get("Vary"), "Accept-Encoding")
+	st.Expect(t, w.Body.String(), "hello world")
+}
+
+func TestCompressorVary(t *testing.T) {
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Vary", "Origin, accept-encoding")
+		w.Write([]byte("hello world"))
+	})
+
+	for _, method := range []string{"GET", "HEAD"} {
+		req := httptest.NewRequest(method, "/", nil)
+		w := httptest.NewRecorder()
+		NewCompressor().HandleHTTP(w, req, final)
+		st.Expect(t, w.Header()["Vary"], []string{"Origin, accept-encoding"})
+		st.Expect(t, w.Header().Get("Content-Encoding"), "")
+	}
+}
+
+func TestCompressorSkipsCompressedContent(t *testing.T) {
+	png := []byte("\x89PNG\x0D\x0A\x1A\x0A")
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(png)
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "*")
+	w := httptest.NewRecorder()
+	NewCompressor().HandleHTTP(w, req, final)
+
+	st.Expect(t, w.Header().Get("Content-Type"), "image/png")
+	st.Expect(t, w.Header().Get("Content-Encoding"), "")
+	st.Expect(t, w.Header().Get("Vary"), "")
+	st.Expect(t, w.Body.Bytes(), png)
+}
+
+func TestCompressorFlush(t *testing.T) {
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+		w.(http.Flusher).Flush()
+		st.Expect(t, w.(wrapper).Unwrap().(*compressWriter).ResponseWriter.(*httptest.ResponseRecorder).Flushed, true)
+		st.Reject(t, w.(wrapper).Unwrap().(*compressWriter).ResponseWriter.(*httptest.ResponseRecorder).Body.Len(), 0)
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	NewCompressor().HandleHTTP(httptest.NewRecorder(), req, final)
+}
+
+func TestCompressorFlushFirst(t *testing.T) {
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.(http.Flusher).Flush()
+		w.Write([]byte("hello"))
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	NewCompressor().HandleHTTP(w, req, final)
+
+	st.Expect(t, w.Header().Get("Content-Encoding"), "gzip")
+	reader, err := gzip.NewReader(w.Body)
+	st.Expect(t, err, nil)
+	body, _ := ioutil.ReadAll(reader)
+	st.Expect(t, string(body), "hello")
+}
+
+func TestCompressorInformational(t *testing.T) {
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</style.css>; rel=preload")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(201)
+		w.Write([]byte("hello"))
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := &informationalRecorder{ResponseRecorder: httptest.NewRecorder()}
+	NewCompressor().HandleHTTP(w, req, final)
+
+	st.Expect(t, w.codes, []int{103, 201})
+	st.Expect(t, w.Code, 201)
+	st.Expect(t, w.Header().Get("Content-Encoding"), "gzip")
+	reader, err := gzip.NewReader(w.Body)
+	st.Expect(t, err, nil)
+	body, _ := ioutil.ReadAll(reader)
+	st.Expect(t, string(body), "hello")
+}
+
+// informationalRecorder records the written status codes,
+// including the informational ones, as net/http does.
+type informationalRecorder struct {
+	*httptest.ResponseRecorder
+	codes []int
+}
+
+func (w *informationalRecorder) WriteHeader(code int) {
+	w.codes = append(w.codes, code)
+	if code >= 200 {
+		w.ResponseRecorder.WriteHeader(code)
+	}
+}
+
+func TestCompressorCustomEncoding(t *testing.T) {
+	c := NewCompressor()
+	c.Register("identity-test", func(w io.Writer) io.WriteCloser {
+		return nopCloser{w}
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0.5, identity-test")
+	w := httptest.NewRecorder()
+	c.HandleHTTP(w, req, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	}))
+
+	st.Expect(t, w.Header().Get("Content-Encoding"), "identity-test")
+	st.Expect(t, bytes.Equal(w.Body.Bytes(), []byte("hello world")), true)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
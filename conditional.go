@@ -0,0 +1,187 @@
+package layer
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// UseIf registers new handlers for the given phase which are only executed
+// if the given condition matches the request, and skipped otherwise.
+// The condition is checked on every request, right before the middleware
+// is reached in the chain. Registrable handlers are not supported.
+//
+// It panics if condition is nil.
+func (s *Layer) UseIf(phase string, condition Condition, handler ...interface{}) {
+	if condition == nil {
+		panic(&HandlerError{Phase: phase, Err: ErrNilHandler})
+	}
+	s.useWith(phase, Normal, when(condition), handler...)
+}
+
+// SkipIf registers new handlers for the given phase which are skipped
+// if the given condition matches the request, and executed otherwise.
+// It's the negation of UseIf. Registrable handlers are not supported.
+//
+// It panics if condition is nil.
+func (s *Layer) SkipIf(phase string, condition Condition, handler ...interface{}) {
+	if condition == nil {
+		panic(&HandlerError{Phase: phase, Err: ErrNilHandler})
+	}
+	s.useWith(phase, Normal, when(func(r *http.Request) bool {
+		return !condition(r)
+	}), handler...)
+}
+
+// Except returns a condition matching every request except the ones
+// for the given paths, designed to be used with UseIf, e.g:
+//
+//	mw.UseIf("request", layer.Except("/healthz", "/metrics"), auth)
+//
+// Paths ending with a slash match any path with the same prefix.
+func Except(paths ...string) Condition {
+	return func(r *http.Request) bool {
+		for _, path := range paths {
+			if r.URL.Path == path || (strings.HasSuffix(path, "/") && strings.HasPrefix(r.URL.Path, path)) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// when returns a middleware decorator skipping the middleware
+// if the given condition doesn't match the request.
+func when(condition Condition) func(MiddlewareFunc) MiddlewareFunc {
+	return func(mw MiddlewareFunc) MiddlewareFunc {
+		return func(h http.Handler) http.Handler {
+			next := mw(h)
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if condition(r) {
+					next.ServeHTTP(w, r)
+					return
+				}
+				h.ServeHTTP(w, r)
+			})
+		}
+	}
+}
+
+// UseMethod registers new handlers for the given phase which are only
+// executed for requests with the given HTTP method, e.g: "POST".
+// Registrable handlers are not supported.
+func (s *Layer) UseMethod(phase, method string, handler ...interface{}) {
+	s.UseMethods(phase, []string{method}, handler...)
+}
+
+// UseMethods registers new handlers for the given phase which are only
+// executed for requests with any of the given HTTP methods.
+// Methods are matched case-insensitively. Registrable handlers are not supported.
+func (s *Layer) UseMethods(phase string, methods []string, handler ...interface{}) {
+	allowed := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		allowed[strings.ToUpper(method)] = true
+	}
+	s.useWith(phase, Normal, when(func(r *http.Request) bool {
+		return allowed[r.Method]
+	}), handler...)
+}
+
+// UsePath registers new handlers for the given phase which are only
+// executed if the request path starts with the given prefix, e.g: "/api/".
+// Registrable handlers are not supported.
+func (s *Layer) UsePath(phase, prefix string, handler ...interface{}) {
+	s.useWith(phase, Normal, when(func(r *http.Request) bool {
+		return strings.HasPrefix(r.URL.Path, prefix)
+	}), handler...)
+}
+
+// UseRegexp registers new handlers for the given phase which are only
+// executed if the request path matches the given regular expression,
+// e.g: "^/v[0-9]+/internal/". The expression is compiled once on registration.
+// Registrable handlers are not supported.
+//
+// It panics if the expression cannot be parsed.
+func (s *Layer) UseRegexp(phase, pattern string, handler ...interface{}) {
+	re := regexp.MustCompile(pattern)
+	s.useWith(phase, Normal, when(func(r *http.Request) bool {
+		return re.MatchString(r.URL.Path)
+	}), handler...)
+}
+
+// UseHost registers new handlers for the given phase which are only
+// executed if the request host, without port, matches the given host,
+// e.g: "api.example.com". Hosts are matched case-insensitively, and
+// a leading wildcard label matches any subdomain, e.g: "*.example.com"
+// matches "api.example.com" but not "example.com".
+// Registrable handlers are not supported.
+func (s *Layer) UseHost(phase, host string, handler ...interface{}) {
+	host = strings.ToLower(host)
+	s.useWith(phase, Normal, when(func(r *http.Request) bool {
+		return matchHost(host, requestHost(r))
+	}), handler...)
+}
+
+// requestHost returns the lower case request host without port.
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+// matchHost reports whether the given host matches the given host pattern.
+func matchHost(pattern, host string) bool {
+	if strings.HasPrefix(pattern, "*.") {
+		suffix := pattern[1:]
+		return len(host) > len(suffix) && strings.HasSuffix(host, suffix)
+	}
+	return pattern == host
+}
+
+// UsePathStrip is like UsePath, but the handlers see the request path
+// without the given prefix, as with http.StripPrefix, e.g: "/api/users"
+// is seen as "/users" for the "/api" prefix. The original request path
+// is restored once the handlers call the next handler in the chain.
+func (s *Layer) UsePathStrip(phase, prefix string, handler ...interface{}) {
+	s.useWith(phase, Normal, stripPrefix(prefix), handler...)
+}
+
+// stripPrefix returns a middleware decorator skipping the middleware
+// if the request path doesn't start with the given prefix,
+// and stripping it from the request path otherwise.
+func stripPrefix(prefix string) func(MiddlewareFunc) MiddlewareFunc {
+	return func(mw MiddlewareFunc) MiddlewareFunc {
+		return func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !strings.HasPrefix(r.URL.Path, prefix) {
+					h.ServeHTTP(w, r)
+					return
+				}
+
+				u := *r.URL
+				u.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(u.Path, prefix), "/")
+				u.RawPath = ""
+				if raw := r.URL.RawPath; strings.HasPrefix(raw, prefix) {
+					u.RawPath = "/" + strings.TrimPrefix(strings.TrimPrefix(raw, prefix), "/")
+				}
+
+				restore := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					h.ServeHTTP(w, withURL(req, r.URL))
+				})
+				mw(restore).ServeHTTP(w, withURL(r, &u))
+			})
+		}
+	}
+}
+
+// withURL returns a shallow copy of the given request with the given URL.
+func withURL(r *http.Request, u *url.URL) *http.Request {
+	req := new(http.Request)
+	*req = *r
+	req.URL = u
+	return req
+}
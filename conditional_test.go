@@ -0,0 +1,192 @@
+package layer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func conditionalHandler(w http.ResponseWriter, r *http.Request, h http.Handler) {
+	w.Header().Set("X-Conditional", "true")
+	h.ServeHTTP(w, r)
+}
+
+func runConditional(mw *Layer, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	mw.Run("request", w, r, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Path", r.URL.Path)
+		w.WriteHeader(204)
+	}))
+	return w
+}
+
+func TestUseIf(t *testing.T) {
+	mw := New()
+	mw.UseIf("request", func(r *http.Request) bool { return r.Header.Get("Debug") != "" }, conditionalHandler)
+
+	w := runConditional(mw, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Code, 204)
+	st.Expect(t, w.Header().Get("X-Conditional"), "")
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Debug", "1")
+	w = runConditional(mw, r)
+	st.Expect(t, w.Code, 204)
+	st.Expect(t, w.Header().Get("X-Conditional"), "true")
+}
+
+func TestUseIfNilCondition(t *testing.T) {
+	defer func() {
+		err, ok := recover().(*HandlerError)
+		st.Expect(t, ok, true)
+		st.Expect(t, err.Err, ErrNilHandler)
+	}()
+
+	New().UseIf("request", nil, conditionalHandler)
+}
+
+func TestUseMethod(t *testing.T) {
+	mw := New()
+	mw.UseMethods("request", []string{"post", "PUT"}, conditionalHandler)
+
+	for method, matched := range map[string]bool{"GET": false, "HEAD": false, "POST": true, "PUT": true} {
+		w := runConditional(mw, httptest.NewRequest(method, "/", nil))
+		st.Expect(t, w.Code, 204)
+		st.Expect(t, w.Header().Get("X-Conditional") == "true", matched)
+	}
+
+	mw = New()
+	mw.UseMethod("request", "DELETE", conditionalHandler)
+	st.Expect(t, runConditional(mw, httptest.NewRequest("DELETE", "/", nil)).Header().Get("X-Conditional"), "true")
+	st.Expect(t, runConditional(mw, httptest.NewRequest("GET", "/", nil)).Header().Get("X-Conditional"), "")
+}
+
+func TestUsePath(t *testing.T) {
+	mw := New()
+	mw.UsePath("request", "/api/", conditionalHandler)
+
+	w := runConditional(mw, httptest.NewRequest("GET", "/api/users", nil))
+	st.Expect(t, w.Header().Get("X-Conditional"), "true")
+	st.Expect(t, w.Header().Get("X-Path"), "/api/users")
+
+	w = runConditional(mw, httptest.NewRequest("GET", "/api", nil))
+	st.Expect(t, w.Header().Get("X-Conditional"), "")
+}
+
+func TestUsePathStrip(t *testing.T) {
+	mw := New()
+	mw.UsePathStrip("request", "/api", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Header().Set("X-Stripped", r.URL.Path)
+		h.ServeHTTP(w, r)
+	})
+
+	w := runConditional(mw, httptest.NewRequest("GET", "/api/users?page=1", nil))
+	st.Expect(t, w.Code, 204)
+	st.Expect(t, w.Header().Get("X-Stripped"), "/users")
+	st.Expect(t, w.Header().Get("X-Path"), "/api/users")
+
+	w = runConditional(mw, httptest.NewRequest("GET", "/api", nil))
+	st.Expect(t, w.Header().Get("X-Stripped"), "/")
+
+	w = runConditional(mw, httptest.NewRequest("GET", "/users", nil))
+	st.Expect(t, w.Header().Get("X-Stripped"), "")
+	st.Expect(t, w.Header().Get("X-Path"), "/users")
+}
+
+func TestUseRegexp(t *testing.T) {
+	mw := New()
+	mw.UseRegexp("request", "^/v[0-9]+/internal/", conditionalHandler)
+
+	for path, matched := range map[string]bool{"/v1/internal/foo": true, "/v12/internal/": true, "/v/internal/": false, "/api/v1/internal/": false} {
+		w := runConditional(mw, httptest.NewRequest("GET", path, nil))
+		st.Expect(t, w.Code, 204)
+		st.Expect(t, w.Header().Get("X-Conditional") == "true", matched)
+	}
+
+	defer func() {
+		st.Reject(t, recover(), nil)
+	}()
+	mw.UseRegexp("request", "(", conditionalHandler)
+}
+
+func TestUseHost(t *testing.T) {
+	mw := New()
+	mw.UseHost("request", "*.example.com", conditionalHandler)
+	mw.UseHost("request", "API.vinxi.io", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Header().Set("X-Vinxi", "true")
+		h.ServeHTTP(w, r)
+	})
+
+	cases := []struct {
+		host           string
+		example, vinxi bool
+	}{
+		{"api.example.com", true, false},
+		{"a.b.example.com:8080", true, false},
+		{"example.com", false, false},
+		{"badexample.com", false, false},
+		{"api.vinxi.io:443", false, true},
+		{"api.vinxi.io.evil.com", false, false},
+	}
+	for _, test := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = test.host
+		w := runConditional(mw, r)
+		st.Expect(t, w.Code, 204)
+		st.Expect(t, w.Header().Get("X-Conditional") == "true", test.example)
+		st.Expect(t, w.Header().Get("X-Vinxi") == "true", test.vinxi)
+	}
+}
+
+func TestSkipIf(t *testing.T) {
+	mw := New()
+	mw.SkipIf("request", func(r *http.Request) bool { return r.Method == "OPTIONS" }, conditionalHandler)
+	st.Expect(t, runConditional(mw, httptest.NewRequest("GET", "/", nil)).Header().Get("X-Conditional"), "true")
+	st.Expect(t, runConditional(mw, httptest.NewRequest("OPTIONS", "/", nil)).Header().Get("X-Conditional"), "")
+}
+
+func TestSkipIfNilCondition(t *testing.T) {
+	defer func() {
+		err, ok := recover().(*HandlerError)
+		st.Expect(t, ok, true)
+		st.Expect(t, err.Err, ErrNilHandler)
+	}()
+
+	New().SkipIf("request", nil, conditionalHandler)
+}
+
+func TestExcept(t *testing.T) {
+	mw := New()
+	mw.UseIf("request", Except("/healthz", "/metrics", "/debug/"), conditionalHandler)
+
+	for path, matched := range map[string]bool{"/": true, "/healthz": false, "/healthz/foo": true, "/metrics": false, "/debug/pprof": false, "/debug": true} {
+		w := runConditional(mw, httptest.NewRequest("GET", path, nil))
+		st.Expect(t, w.Code, 204)
+		st.Expect(t, w.Header().Get("X-Conditional") == "true", matched)
+	}
+}
+
+func TestConditionalWithoutMemoization(t *testing.T) {
+	mw := New(WithMemoization(false))
+	mw.UsePath("request", "/api", conditionalHandler)
+	mw.Use(AllPhases, orderHandler("all"))
+
+	for i := 0; i < 2; i++ {
+		w := runConditional(mw, httptest.NewRequest("GET", "/api/foo", nil))
+		st.Expect(t, w.Header().Get("X-Conditional"), "true")
+		st.Expect(t, w.Header()["X-Order"], []string{"all"})
+
+		w = runConditional(mw, httptest.NewRequest("GET", "/foo", nil))
+		st.Expect(t, w.Header().Get("X-Conditional"), "")
+	}
+	st.Expect(t, mw.Stats().MemoRebuilds, uint64(0))
+	st.Expect(t, mw.Pool["request"].memo == nil, true)
+
+	// Stack changes apply to the next run
+	mw.Disable("layer.conditionalHandler")
+	w := runConditional(mw, httptest.NewRequest("GET", "/api/foo", nil))
+	st.Expect(t, w.Header().Get("X-Conditional"), "")
+	st.Expect(t, w.Header()["X-Order"], []string{"all"})
+}
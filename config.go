@@ -0,0 +1,334 @@
+package layer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrUnknownFactory is used when a configured middleware factory is not registered.
+	ErrUnknownFactory = errors.New("vinxi: unknown middleware factory")
+
+	// ErrUnknownPriority is used when a configured middleware priority is unknown.
+	ErrUnknownPriority = errors.New("vinxi: unknown middleware priority")
+
+	// ErrDuplicateID is used when a configured middleware ID is already in use.
+	ErrDuplicateID = errors.New("vinxi: duplicate middleware id")
+)
+
+// priorities stores the named priorities accepted in configuration documents.
+var priorities = map[string]Priority{
+	"top_head": TopHead,
+	"head":     Head,
+	"normal":   Normal,
+	"top_tail": TopTail,
+	"tail":     Tail,
+}
+
+// Factory represents a named middleware factory, creating a middleware
+// handler of any of the supported interfaces from the given options.
+type Factory func(options map[string]interface{}) (interface{}, error)
+
+var (
+	// factories stores the middleware factories registered via RegisterFactory.
+	factories = map[string]Factory{}
+	// factoriesMutex guards the middleware factories registry.
+	factoriesMutex sync.RWMutex
+)
+
+// RegisterFactory registers a middleware factory by name, making it
+// available to configuration documents. Registering a factory with
+// an existing name replaces it.
+//
+// Factories are global and are expected to be registered at init time.
+func RegisterFactory(name string, factory Factory) {
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+	if factory == nil {
+		delete(factories, name)
+		return
+	}
+	factories[name] = factory
+}
+
+// factory returns the middleware factory registered by the given name, if any.
+func factory(name string) Factory {
+	factoriesMutex.RLock()
+	defer factoriesMutex.RUnlock()
+	return factories[name]
+}
+
+// Config represents a declarative layer pipeline configuration document.
+// It can be decoded from JSON via ParseConfig. YAML parsing is not built in,
+// keeping the layer free of dependencies: YAML documents must be decoded by
+// the caller using any YAML library honoring the yaml struct tags, such as
+// gopkg.in/yaml.v3:
+//
+//	phases: [request, response]
+//	middleware:
+//	  - name: cors
+//	    phase: request
+//	    priority: head
+//	    options:
+//	      origin: "*"
+//	  - name: auth
+//	    id: admin-auth
+//	    phase: request
+type Config struct {
+	// Phases defines the valid phases of the layer, if any. See DefinePhases.
+	Phases []string `json:"phases,omitempty" yaml:"phases,omitempty"`
+	// Middleware defines the middleware handlers to register, in order.
+	Middleware []MiddlewareConfig `json:"middleware,omitempty" yaml:"middleware,omitempty"`
+}
+
+// MiddlewareConfig represents a configured middleware handler.
+type MiddlewareConfig struct {
+	// Name defines the middleware factory name. See RegisterFactory.
+	Name string `json:"name" yaml:"name"`
+	// ID defines the handler name used to remove or replace it later.
+	// Defaults to the factory name.
+	ID string `json:"id,omitempty" yaml:"id,omitempty"`
+	// Phase defines the phase to register the handler in.
+	Phase string `json:"phase" yaml:"phase"`
+	// Priority defines the handler priority: top_head, head, normal,
+	// top_tail or tail. Defaults to normal.
+	Priority string `json:"priority,omitempty" yaml:"priority,omitempty"`
+	// Level defines an arbitrary priority level, overriding Priority if present.
+	// See PriorityAt.
+	Level *int `json:"level,omitempty" yaml:"level,omitempty"`
+	// Options defines the options passed to the middleware factory.
+	Options map[string]interface{} `json:"options,omitempty" yaml:"options,omitempty"`
+}
+
+// priority returns the configured handler priority.
+func (c MiddlewareConfig) priority() (Priority, error) {
+	if c.Level != nil {
+		return PriorityAt(*c.Level), nil
+	}
+	if c.Priority == "" {
+		return Normal, nil
+	}
+	priority, ok := priorities[c.Priority]
+	if !ok {
+		return 0, ErrUnknownPriority
+	}
+	return priority, nil
+}
+
+// ConfigError represents a configured middleware handler error,
+// reporting the middleware position and factory name that caused it.
+type ConfigError struct {
+	// Index stores the zero-based position of the middleware in the document.
+	Index int
+	// Name stores the middleware factory name.
+	Name string
+	// Err stores the underlying configuration error.
+	Err error
+}
+
+// Error returns the error message.
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s (middleware %q, entry %d)", e.Err, e.Name, e.Index)
+}
+
+// ParseConfig parses the given JSON configuration document.
+func ParseConfig(data []byte) (*Config, error) {
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// NewFromConfig creates a new middleware layer configured
+// accordingly to the given options and configuration document.
+func NewFromConfig(config *Config, opts ...Option) (*Layer, error) {
+	layer := New(opts...)
+	if err := layer.Configure(config); err != nil {
+		return nil, err
+	}
+	return layer, nil
+}
+
+// Configure registers the middleware handlers defined in the given
+// configuration document, created by their registered factories.
+//
+// The whole document is validated before changing the layer: a *ConfigError
+// is returned without defining the phases nor registering any handler if
+// any factory is unknown or fails, any priority or phase is invalid, or any
+// ID is duplicated in the document or in the phase it's registered in.
+// The IDs are checked before calling any factory, while the handlers already
+// created are torn down if a later one fails, see Shutdown.
+// The phases and handlers are then applied at once, under a single lock.
+//
+// Registrable handlers register themselves, ignoring the configured
+// phase, priority and ID. They are registered in a staging layer,
+// whose phase middleware is then applied with the rest of the document.
+//
+// It returns ErrFrozen if the layer is frozen, see Freeze.
+func (s *Layer) Configure(config *Config) error {
+	return s.configure(config, false)
+}
+
+// Reload replaces the layer middleware with the middleware handlers defined
+// in the given configuration document, as a single transaction: the document
+// is validated and its handlers created as in Configure, then every phase
+// middleware is replaced at once, under a single lock, so repeatedly applying
+// the same document converges to the same pipeline.
+//
+// If the document fails, the current middleware is kept untouched.
+// The final handlers and loaded plugins are kept, while the replaced handlers
+// are not torn down, since in-flight requests could still be running them.
+//
+// It returns ErrFrozen if the layer is frozen, see Freeze.
+func (s *Layer) Reload(config *Config) error {
+	return s.configure(config, true)
+}
+
+// configure applies the given configuration document,
+// replacing the current middleware if replace is true.
+func (s *Layer) configure(config *Config, replace bool) error {
+	if s.Frozen() {
+		return ErrFrozen
+	}
+
+	// Stage the document in a layer sharing the phase configuration
+	staging := &Layer{Pool: make(Pool), normalize: s.normalize, foldCase: s.foldCase, strict: s.strict}
+	staging.defined = s.definedPhases()
+	if len(config.Phases) > 0 {
+		staging.DefinePhases(config.Phases...)
+	}
+
+	// Validate the document before creating any handler
+	handlerPriorities := make([]Priority, len(config.Middleware))
+	handlerFactories := make([]Factory, len(config.Middleware))
+	ids := make(map[string]bool, len(config.Middleware))
+	for i, mc := range config.Middleware {
+		fail := func(err error) error {
+			return &ConfigError{Index: i, Name: mc.Name, Err: err}
+		}
+
+		phase := staging.normalizePhase(mc.Phase)
+		if staging.strict && !staging.isValidPhase(phase) {
+			return fail(&PhaseError{Phase: phase, Err: ErrUnknownPhase})
+		}
+		priority, err := mc.priority()
+		if err != nil {
+			return fail(err)
+		}
+		handlerPriorities[i] = priority
+		if handlerFactories[i] = factory(mc.Name); handlerFactories[i] == nil {
+			return fail(ErrUnknownFactory)
+		}
+		if mc.ID != "" {
+			if ids[mc.ID] || (!replace && s.hasNamed(phase, mc.ID)) {
+				return fail(ErrDuplicateID)
+			}
+			ids[mc.ID] = true
+		}
+	}
+
+	var created []interface{}
+	for i, mc := range config.Middleware {
+		fail := func(err error) error {
+			discard(created)
+			return &ConfigError{Index: i, Name: mc.Name, Err: err}
+		}
+
+		handler, err := handlerFactories[i](mc.Options)
+		if err != nil {
+			return fail(err)
+		}
+		if isNil(handler) {
+			return fail(ErrNilHandler)
+		}
+		created = append(created, handler)
+		if r, ok := handler.(Registrable); ok {
+			if err := registerConfigured(r, staging); err != nil {
+				return fail(err)
+			}
+			continue
+		}
+
+		fn := AdaptFunc(handler)
+		if fn == nil {
+			return fail(errors.New("vinxi: unsupported middleware interface"))
+		}
+		e := newEntry(handler, fn)
+		e.name = mc.Name
+		if mc.ID != "" {
+			e.name = mc.ID
+		}
+		staging.push(staging.normalizePhase(mc.Phase), handlerPriorities[i], e)
+	}
+
+	phases := staging.phases()
+	stacks := make([][]*entry, len(phases))
+	for i, phase := range phases {
+		stacks[i] = staging.Pool[phase].entries()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.Frozen() {
+		discard(created)
+		return ErrFrozen
+	}
+	// The layer could have been changed while the handlers were created
+	for i, mc := range config.Middleware {
+		if !replace && mc.ID != "" && s.findNamed(staging.normalizePhase(mc.Phase), mc.ID) {
+			discard(created)
+			return &ConfigError{Index: i, Name: mc.Name, Err: ErrDuplicateID}
+		}
+	}
+	if len(config.Phases) > 0 {
+		s.defined = staging.defined
+		s.bump()
+	}
+	if replace {
+		s.Pool, s.order = make(Pool), nil
+		s.touch(AllPhases)
+	}
+	s.merge(phases, stacks)
+	return nil
+}
+
+// hasNamed reports whether the given phase has a handler registered by the given name.
+func (s *Layer) hasNamed(phase, name string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.findNamed(phase, name)
+}
+
+// findNamed reports whether the given phase has a handler registered by the given name.
+// The mutex must be held.
+func (s *Layer) findNamed(phase, name string) bool {
+	stack := s.Pool[phase]
+	return stack != nil && stack.find(name) != nil
+}
+
+// discard tears down the given configured handlers, in reverse creation order.
+func discard(handlers []interface{}) {
+	for i := len(handlers) - 1; i >= 0; i-- {
+		shutdown(context.Background(), handlers[i])
+	}
+}
+
+// registerConfigured registers the given Registrable handler in the given layer,
+// returning the error it panics with, if any.
+func registerConfigured(r Registrable, layer *Layer) (err error) {
+	defer func() {
+		if re := recover(); re != nil {
+			e, ok := re.(error)
+			if !ok {
+				panic(re)
+			}
+			err = e
+		}
+	}()
+	r.Register(layer)
+	return nil
+}
@@ -0,0 +1,214 @@
+package layer
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/utils.v0"
+)
+
+func init() {
+	RegisterFactory("test-header", func(options map[string]interface{}) (interface{}, error) {
+		name, _ := options["name"].(string)
+		if name == "" {
+			return nil, errors.New("missing header name")
+		}
+		return func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+			w.Header().Add("X-Order", name)
+			h.ServeHTTP(w, r)
+		}, nil
+	})
+}
+
+const testConfig = `{
+	"phases": ["request", "error"],
+	"middleware": [
+		{"name": "test-header", "phase": "request", "options": {"name": "normal"}},
+		{"name": "test-header", "phase": "request", "priority": "tail", "options": {"name": "tail"}},
+		{"name": "test-header", "id": "first", "phase": "request", "priority": "head", "options": {"name": "head"}},
+		{"name": "test-header", "phase": "request", "level": -10, "options": {"name": "level"}}
+	]
+}`
+
+func TestConfigure(t *testing.T) {
+	config, err := ParseConfig([]byte(testConfig))
+	st.Expect(t, err, nil)
+
+	mw, err := NewFromConfig(config)
+	st.Expect(t, err, nil)
+	st.Expect(t, mw.Check(), nil)
+	st.Expect(t, mw.Pool["request"].Names(), []string{"first", "test-header", "test-header", "test-header"})
+
+	w := utils.NewWriterStub()
+	mw.Run("request", w, &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	st.Expect(t, w.Header()["X-Order"], []string{"head", "level", "normal", "tail"})
+
+	st.Expect(t, mw.Remove("request", "first"), 1)
+}
+
+func TestConfigureErrors(t *testing.T) {
+	cases := []struct {
+		config string
+		index  int
+		err    error
+	}{
+		{`{"middleware": [{"name": "missing", "phase": "request"}]}`, 0, ErrUnknownFactory},
+		{`{"middleware": [
+			{"name": "test-header", "phase": "request", "options": {"name": "foo"}},
+			{"name": "test-header", "phase": "request", "priority": "first", "options": {"name": "foo"}}
+		]}`, 1, ErrUnknownPriority},
+	}
+
+	for _, test := range cases {
+		config, err := ParseConfig([]byte(test.config))
+		st.Expect(t, err, nil)
+		mw := New()
+		err = mw.Configure(config)
+		st.Expect(t, err.(*ConfigError).Index, test.index)
+		st.Expect(t, err.(*ConfigError).Err, test.err)
+		st.Expect(t, len(mw.Pool), 0)
+	}
+}
+
+func TestConfigureFactoryError(t *testing.T) {
+	config := &Config{Middleware: []MiddlewareConfig{{Name: "test-header", Phase: "request"}}}
+	_, err := NewFromConfig(config)
+	st.Expect(t, err.Error(), `missing header name (middleware "test-header", entry 0)`)
+}
+
+func TestConfigureStrictPhases(t *testing.T) {
+	config := &Config{
+		Phases:     []string{"request"},
+		Middleware: []MiddlewareConfig{{Name: "test-header", Phase: "response", Options: map[string]interface{}{"name": "foo"}}},
+	}
+	_, err := NewFromConfig(config, WithStrictPhases(true))
+	st.Expect(t, err.(*ConfigError).Err, &PhaseError{Phase: "response", Err: ErrUnknownPhase})
+}
+
+func TestConfigureAtomic(t *testing.T) {
+	mw := New()
+	mw.Use("request", func(w http.ResponseWriter, r *http.Request, h http.Handler) {})
+	generation := mw.generation
+
+	config, err := ParseConfig([]byte(`{
+		"phases": ["request"],
+		"middleware": [
+			{"name": "test-header", "id": "foo", "phase": "request", "options": {"name": "foo"}},
+			{"name": "test-header", "id": "bar", "phase": "request", "options": {"name": "bar"}},
+			{"name": "missing", "phase": "request"}
+		]
+	}`))
+	st.Expect(t, err, nil)
+	err = mw.Configure(config)
+	st.Expect(t, err.(*ConfigError).Index, 2)
+	st.Expect(t, mw.generation, generation)
+	st.Expect(t, mw.definedPhases() == nil, true)
+	st.Expect(t, mw.Pool["request"].Len(), 1)
+}
+
+func TestConfigureDuplicateID(t *testing.T) {
+	config, err := ParseConfig([]byte(`{
+		"middleware": [
+			{"name": "test-header", "id": "foo", "phase": "request", "options": {"name": "foo"}},
+			{"name": "test-header", "id": "foo", "phase": "response", "options": {"name": "bar"}}
+		]
+	}`))
+	st.Expect(t, err, nil)
+	mw := New()
+	err = mw.Configure(config)
+	st.Expect(t, err.(*ConfigError).Index, 1)
+	st.Expect(t, err.(*ConfigError).Err, ErrDuplicateID)
+	st.Expect(t, len(mw.Pool), 0)
+
+	config.Middleware = config.Middleware[:1]
+	st.Expect(t, mw.Configure(config), nil)
+	err = mw.Configure(config)
+	st.Expect(t, err.(*ConfigError).Index, 0)
+	st.Expect(t, err.(*ConfigError).Err, ErrDuplicateID)
+	st.Expect(t, mw.Pool["request"].Len(), 1)
+}
+
+func TestConfigureDuplicateIDFactories(t *testing.T) {
+	calls := 0
+	RegisterFactory("test-count", func(options map[string]interface{}) (interface{}, error) {
+		calls++
+		return func(w http.ResponseWriter, r *http.Request, h http.Handler) {}, nil
+	})
+	defer RegisterFactory("test-count", nil)
+
+	mw := New()
+	mw.UseNamed("request", "foo", func(w http.ResponseWriter, r *http.Request, h http.Handler) {})
+	config := &Config{Middleware: []MiddlewareConfig{
+		{Name: "test-count", ID: "bar", Phase: "request"},
+		{Name: "test-count", ID: "foo", Phase: "request"},
+	}}
+	err := mw.Configure(config)
+	st.Expect(t, err.(*ConfigError).Index, 1)
+	st.Expect(t, err.(*ConfigError).Err, ErrDuplicateID)
+	st.Expect(t, calls, 0)
+}
+
+func TestConfigureDiscard(t *testing.T) {
+	var closed []string
+	created := &closerHandler{name: "foo", closed: &closed}
+	RegisterFactory("test-closer", func(options map[string]interface{}) (interface{}, error) {
+		return created, nil
+	})
+	defer RegisterFactory("test-closer", nil)
+
+	mw := New()
+	config := &Config{Middleware: []MiddlewareConfig{
+		{Name: "test-closer", Phase: "request"},
+		{Name: "test-header", Phase: "request"},
+	}}
+	err := mw.Configure(config)
+	st.Expect(t, err.(*ConfigError).Index, 1)
+	st.Expect(t, closed, []string{"foo"})
+	st.Expect(t, len(mw.Pool), 0)
+}
+
+func TestReload(t *testing.T) {
+	mw := New()
+	mw.UseNamed("request", "foo", func(w http.ResponseWriter, r *http.Request, h http.Handler) {})
+	mw.Use("response", func(w http.ResponseWriter, r *http.Request, h http.Handler) {})
+
+	config := &Config{Middleware: []MiddlewareConfig{
+		{Name: "test-header", ID: "foo", Phase: "request", Options: map[string]interface{}{"name": "foo"}},
+	}}
+	st.Expect(t, mw.Reload(config), nil)
+	st.Expect(t, mw.Pool["request"].Names(), []string{"foo"})
+	st.Expect(t, mw.Pool["response"], (*Stack)(nil))
+
+	// Applying the same document again converges to the same pipeline
+	st.Expect(t, mw.Reload(config), nil)
+	st.Expect(t, mw.Pool["request"].Names(), []string{"foo"})
+
+	w := utils.NewWriterStub()
+	mw.Run("request", w, &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	st.Expect(t, w.Header()["X-Order"], []string{"foo"})
+
+	// Failing documents keep the current middleware
+	config.Middleware = append(config.Middleware, MiddlewareConfig{Name: "missing", Phase: "request"})
+	st.Expect(t, mw.Reload(config).(*ConfigError).Err, ErrUnknownFactory)
+	st.Expect(t, mw.Pool["request"].Names(), []string{"foo"})
+}
+
+func TestConfigureRegistrable(t *testing.T) {
+	RegisterFactory("test-cors", func(options map[string]interface{}) (interface{}, error) {
+		return &CORS{AllowedOrigins: []string{"*"}}, nil
+	})
+	defer RegisterFactory("test-cors", nil)
+
+	mw := New()
+	mw.UsePriority("request", Head, func(w http.ResponseWriter, r *http.Request, h http.Handler) {})
+	config := &Config{Middleware: []MiddlewareConfig{
+		{Name: "test-header", ID: "header", Phase: "request", Priority: "head", Options: map[string]interface{}{"name": "foo"}},
+		{Name: "test-cors", Phase: "request"},
+	}}
+	st.Expect(t, mw.Configure(config), nil)
+	names := mw.Pool["request"].Names()
+	st.Expect(t, len(names), 3)
+	st.Expect(t, names[1:], []string{"header", "layer.(*CORS).HandleHTTP-fm"})
+}
@@ -0,0 +1,221 @@
+package layer
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CORS implements a Cross-Origin Resource Sharing middleware component.
+//
+// CORS preflight requests are replied directly, while the responses to actual
+// cross-origin requests are stamped with the CORS headers once written,
+// overriding the ones set downstream, such as the proxied upstream ones.
+// CORS implements the Registrable interface, registering itself in the request
+// phase with Head priority, so it runs before the regular middleware of the phase.
+// TopHead and wildcard phase middleware still run before it:
+//
+//	mw.Use("request", &layer.CORS{AllowedOrigins: []string{"https://example.com"}})
+type CORS struct {
+	// AllowedOrigins stores the allowed origins. Use "*" to allow any origin.
+	AllowedOrigins []string
+	// AllowedMethods stores the allowed methods. Defaults to GET, HEAD and POST.
+	AllowedMethods []string
+	// AllowedHeaders stores the allowed request headers. Use "*" to allow any header.
+	AllowedHeaders []string
+	// ExposedHeaders stores the response headers exposed to the client.
+	ExposedHeaders []string
+	// AllowCredentials defines if the client is allowed to send credentials.
+	// Credentials are only allowed for the explicitly listed origins:
+	// origins allowed via "*" are never reflected nor sent credentials.
+	AllowCredentials bool
+	// MaxAge stores the number of seconds the preflight response can be cached.
+	MaxAge int
+}
+
+// Register registers the CORS middleware in the request phase with Head priority.
+func (c *CORS) Register(mw Middleware) {
+	mw.UsePriority(RequestPhase, Head, c.HandleHTTP)
+}
+
+// HandleHTTP replies CORS preflight requests or calls the next handler
+// stamping the CORS headers in the cross-origin responses.
+func (c *CORS) HandleHTTP(w http.ResponseWriter, r *http.Request, h http.Handler) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		h.ServeHTTP(w, r)
+		return
+	}
+
+	header := w.Header()
+	header.Add("Vary", "Origin")
+
+	// Reply preflight requests directly
+	if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		if c.allowOrigin(origin) && c.allowMethod(r.Header.Get("Access-Control-Request-Method")) {
+			c.stampOrigin(header, origin)
+			header.Set("Access-Control-Allow-Methods", strings.Join(c.methods(), ", "))
+			if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" && c.allowHeaders(headers) {
+				header.Set("Access-Control-Allow-Headers", headers)
+			}
+			if c.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(c.MaxAge))
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if !c.allowOrigin(origin) {
+		h.ServeHTTP(w, r)
+		return
+	}
+	h.ServeHTTP(NewResponseWriter(&corsWriter{ResponseWriter: w, cors: c, origin: origin}), r)
+}
+
+// stampOrigin writes the allowed origin and credentials response headers.
+// Origins only allowed via "*" are never reflected.
+func (c *CORS) stampOrigin(header http.Header, origin string) {
+	if !contains(c.AllowedOrigins, origin) {
+		header.Set("Access-Control-Allow-Origin", "*")
+		header.Del("Access-Control-Allow-Credentials")
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", origin)
+	if c.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	} else {
+		header.Del("Access-Control-Allow-Credentials")
+	}
+}
+
+// stamp writes the CORS headers of an actual cross-origin response.
+func (c *CORS) stamp(header http.Header, origin string) {
+	c.stampOrigin(header, origin)
+	if len(c.ExposedHeaders) > 0 {
+		header.Set("Access-Control-Expose-Headers", strings.Join(c.ExposedHeaders, ", "))
+	}
+}
+
+// methods returns the allowed methods.
+func (c *CORS) methods() []string {
+	if len(c.AllowedMethods) == 0 {
+		return []string{"GET", "HEAD", "POST"}
+	}
+	return c.AllowedMethods
+}
+
+// allowOrigin reports whether the given origin is allowed.
+func (c *CORS) allowOrigin(origin string) bool {
+	return contains(c.AllowedOrigins, "*") || contains(c.AllowedOrigins, origin)
+}
+
+// allowMethod reports whether the given method is allowed.
+func (c *CORS) allowMethod(method string) bool {
+	for _, m := range c.methods() {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowHeaders reports whether every header in the given comma separated list is allowed.
+func (c *CORS) allowHeaders(headers string) bool {
+	if contains(c.AllowedHeaders, "*") {
+		return true
+	}
+	for _, name := range strings.Split(headers, ",") {
+		name = strings.TrimSpace(name)
+		allowed := false
+		for _, h := range c.AllowedHeaders {
+			if strings.EqualFold(h, name) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// corsWriter implements a response writer stamping the CORS headers
+// when the response headers are written.
+type corsWriter struct {
+	http.ResponseWriter
+	cors        *CORS
+	origin      string
+	wroteHeader bool
+}
+
+// WriteHeader stamps the CORS headers and writes the response status code.
+func (w *corsWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.cors.stamp(w.Header(), w.origin)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes the response body, implicitly writing a 200 status code if not written yet.
+func (w *corsWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends any buffered data to the client, if supported by the underlying writer.
+func (w *corsWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	flush(w.ResponseWriter)
+}
+
+// Hijack lets the caller take over the connection, if supported by the underlying writer.
+func (w *corsWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hijack(w.ResponseWriter)
+}
+
+// Push initiates an HTTP/2 server push, if supported by the underlying writer.
+func (w *corsWriter) Push(target string, opts *http.PushOptions) error {
+	return push(w.ResponseWriter, target, opts)
+}
+
+// CloseNotify returns a channel notifying when the client connection has gone away,
+// if supported by the underlying writer.
+func (w *corsWriter) CloseNotify() <-chan bool {
+	return closeNotify(w.ResponseWriter)
+}
+
+// ReadFrom reads data from the given reader and writes it to the response body,
+// using the underlying writer implementation, if supported.
+func (w *corsWriter) ReadFrom(r io.Reader) (int64, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return readFrom(w.ResponseWriter, r)
+}
+
+// Unwrap returns the wrapped response writer.
+func (w *corsWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// contains reports whether the given list contains the given value.
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
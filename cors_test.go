@@ -0,0 +1,110 @@
+package layer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func TestCORSPreflight(t *testing.T) {
+	mw := New()
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("preflight must not reach the chain")
+	})
+	mw.Use(RequestPhase, &CORS{
+		AllowedOrigins: []string{"https://example.com"},
+		AllowedMethods: []string{"GET", "PUT"},
+		AllowedHeaders: []string{"X-Foo"},
+		MaxAge:         60,
+	})
+
+	req := httptest.NewRequest("OPTIONS", "/", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	req.Header.Set("Access-Control-Request-Headers", "x-foo")
+	w := httptest.NewRecorder()
+	mw.Run(RequestPhase, w, req, nil)
+
+	st.Expect(t, w.Code, 204)
+	st.Expect(t, w.Header().Get("Access-Control-Allow-Origin"), "https://example.com")
+	st.Expect(t, w.Header().Get("Access-Control-Allow-Methods"), "GET, PUT")
+	st.Expect(t, w.Header().Get("Access-Control-Allow-Headers"), "x-foo")
+	st.Expect(t, w.Header().Get("Access-Control-Max-Age"), "60")
+}
+
+func TestCORSPreflightNotAllowed(t *testing.T) {
+	c := &CORS{AllowedOrigins: []string{"https://example.com"}}
+
+	req := httptest.NewRequest("OPTIONS", "/", nil)
+	req.Header.Set("Origin", "https://evil.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	w := httptest.NewRecorder()
+	c.HandleHTTP(w, req, FinalHandler)
+
+	st.Expect(t, w.Code, 204)
+	st.Expect(t, w.Header().Get("Access-Control-Allow-Origin"), "")
+}
+
+func TestCORSActualRequest(t *testing.T) {
+	c := &CORS{AllowedOrigins: []string{"*"}, ExposedHeaders: []string{"X-Bar"}}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Origin", "https://example.com")
+	w := httptest.NewRecorder()
+	c.HandleHTTP(w, req, FinalHandler)
+
+	st.Expect(t, w.Code, 502)
+	st.Expect(t, w.Header().Get("Access-Control-Allow-Origin"), "*")
+	st.Expect(t, w.Header().Get("Access-Control-Expose-Headers"), "X-Bar")
+	st.Expect(t, w.Header().Get("Vary"), "Origin")
+}
+
+func TestCORSCredentials(t *testing.T) {
+	c := &CORS{AllowedOrigins: []string{"https://example.com"}, AllowCredentials: true}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Origin", "https://example.com")
+	w := httptest.NewRecorder()
+	c.HandleHTTP(w, req, FinalHandler)
+
+	st.Expect(t, w.Header().Get("Access-Control-Allow-Origin"), "https://example.com")
+	st.Expect(t, w.Header().Get("Access-Control-Allow-Credentials"), "true")
+}
+
+func TestCORSCredentialsWildcard(t *testing.T) {
+	c := &CORS{AllowedOrigins: []string{"*"}, AllowCredentials: true}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Origin", "https://evil.com")
+	w := httptest.NewRecorder()
+	c.HandleHTTP(w, req, FinalHandler)
+
+	st.Expect(t, w.Header().Get("Access-Control-Allow-Origin"), "*")
+	st.Expect(t, w.Header().Get("Access-Control-Allow-Credentials"), "")
+}
+
+func TestCORSStampsResponse(t *testing.T) {
+	mw := New()
+	mw.Use(RequestPhase, &CORS{AllowedOrigins: []string{"https://example.com"}})
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		st.Expect(t, w.Header().Get("Access-Control-Allow-Origin"), "")
+		h.ServeHTTP(w, r)
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Origin", "https://example.com")
+	w := httptest.NewRecorder()
+	mw.Run(RequestPhase, w, req, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Emulate the headers copied from an upstream response
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Write([]byte("foo"))
+	}))
+
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, w.Header().Get("Access-Control-Allow-Origin"), "https://example.com")
+	st.Expect(t, w.Header().Get("Access-Control-Allow-Credentials"), "")
+	st.Expect(t, w.Body.String(), "foo")
+}
@@ -0,0 +1,142 @@
+package layer
+
+import (
+	stdcontext "context"
+	"net/http"
+	"sync"
+
+	"gopkg.in/vinxi/context.v0"
+)
+
+// LegacyContext defines if the error exposed to the error phase ("vinxi.error")
+// and the request lifecycle values are also stored in the gopkg.in/vinxi/context
+// global storage, keeping compatibility with existing vinxi consumers.
+//
+// Legacy values are stored for the request originally passed to the layer and
+// for the request they're set for, so middleware reading them via context.Get
+// on the request it receives, such as the error phase middleware, finds them.
+// The derived requests values are released once the Run call attaching the request
+// storage completes, while the original request values must be released via
+// context.Clear or context.ClearHandler, otherwise they leak.
+// Values set on requests attached beforehand via Attach must be released via
+// context.Clear as well.
+//
+// It's enabled by default: disable it to only use the request context.Context.
+var LegacyContext = true
+
+// contextKey represents the context.Context key used to store the request data.
+type contextKey struct{}
+
+// requestData stores the layer request-scoped values.
+type requestData struct {
+	mutex  sync.RWMutex
+	values map[string]interface{}
+	// origin stores the request originally attached, used as legacy context key.
+	origin *http.Request
+	// derived stores the derived requests used as legacy context keys.
+	derived map[*http.Request]bool
+	// position stores the request chain position tracker.
+	position position
+}
+
+// Attach returns a shallow copy of the given request whose context.Context
+// carries the layer request-scoped storage, if not present yet.
+//
+// Run attaches the storage automatically, so the request must only be attached
+// beforehand to share values, such as the lifecycle state, across multiple calls to Run.
+func Attach(r *http.Request) *http.Request {
+	if dataOf(r) != nil {
+		return r
+	}
+	data := &requestData{values: make(map[string]interface{}), origin: r}
+	return r.WithContext(stdcontext.WithValue(r.Context(), contextKey{}, data))
+}
+
+// withContext returns a shallow copy of the given request using the given context,
+// preserving the layer request-scoped storage, if any.
+func withContext(r *http.Request, ctx stdcontext.Context) *http.Request {
+	if data := dataOf(r); data != nil {
+		ctx = stdcontext.WithValue(ctx, contextKey{}, data)
+	}
+	return r.WithContext(ctx)
+}
+
+// ErrorOf returns the error exposed to the error phase for the given request, if any.
+func ErrorOf(r *http.Request) interface{} {
+	return getValue(r, "vinxi.error")
+}
+
+// GenerationOf returns the layer configuration generation used to serve the given request.
+func GenerationOf(r *http.Request) uint64 {
+	generation, _ := getValue(r, "vinxi.generation").(uint64)
+	return generation
+}
+
+// dataOf returns the layer request data attached to the request context, if any.
+func dataOf(r *http.Request) *requestData {
+	data, _ := r.Context().Value(contextKey{}).(*requestData)
+	return data
+}
+
+// setValue stores the given request-scoped value, also storing it
+// in the vinxi context storage if LegacyContext is enabled.
+func setValue(r *http.Request, key string, value interface{}) {
+	data := dataOf(r)
+	if data != nil {
+		data.mutex.Lock()
+		data.values[key] = value
+		data.mutex.Unlock()
+	}
+	if !LegacyContext {
+		return
+	}
+	if data != nil && r != data.origin {
+		data.mutex.Lock()
+		if data.derived == nil {
+			data.derived = make(map[*http.Request]bool)
+		}
+		data.derived[r] = true
+		data.mutex.Unlock()
+		context.Set(data.origin, key, value)
+	}
+	context.Set(r, key, value)
+}
+
+// releaseLegacy releases the legacy values stored for the derived requests
+// of the given attached request, keeping the original request ones.
+func releaseLegacy(r *http.Request) {
+	data := dataOf(r)
+	if data == nil {
+		return
+	}
+	data.mutex.Lock()
+	derived := data.derived
+	data.derived = nil
+	data.mutex.Unlock()
+	for req := range derived {
+		context.Clear(req)
+	}
+}
+
+// setLocal stores the given request-scoped value in the request storage only,
+// which is never exposed via the vinxi context storage.
+func setLocal(r *http.Request, key string, value interface{}) {
+	if data := dataOf(r); data != nil {
+		data.mutex.Lock()
+		data.values[key] = value
+		data.mutex.Unlock()
+	}
+}
+
+// getValue returns the given request-scoped value, if any.
+func getValue(r *http.Request, key string) interface{} {
+	if data := dataOf(r); data != nil {
+		data.mutex.RLock()
+		defer data.mutex.RUnlock()
+		return data.values[key]
+	}
+	if LegacyContext {
+		return context.Get(r, key)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package layer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/context.v0"
+	"gopkg.in/vinxi/utils.v0"
+)
+
+func TestRequestContext(t *testing.T) {
+	LegacyContext = false
+	defer func() { LegacyContext = true }()
+
+	var recovered interface{}
+	var legacy interface{}
+	mw := New()
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+	mw.Use(ErrorPhase, func(w http.ResponseWriter, r *http.Request) {
+		recovered, legacy = ErrorOf(r), context.Get(r, "vinxi.error")
+		w.WriteHeader(500)
+	})
+
+	w := httptest.NewRecorder()
+	mw.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Code, 500)
+	st.Expect(t, recovered.(*PanicError).Value, "oops")
+	st.Expect(t, legacy, nil)
+}
+
+func TestRequestContextAttach(t *testing.T) {
+	mw := New(WithStrictTransitions(true))
+	req := Attach(&http.Request{})
+	st.Expect(t, Attach(req), req)
+
+	mw.Run(RequestPhase, utils.NewWriterStub(), req, nil)
+	st.Expect(t, StateOf(req), StateRequest)
+	st.Expect(t, GenerationOf(req), mw.Generation())
+	st.Expect(t, context.Get(req, "vinxi.state"), StateRequest)
+
+	// Requests attached beforehand are released by the caller
+	context.Clear(req)
+	st.Expect(t, context.Get(req, "vinxi.state"), nil)
+	st.Expect(t, StateOf(req), StateRequest)
+}
+
+func TestRequestContextLegacy(t *testing.T) {
+	st.Expect(t, LegacyContext, true)
+
+	var derived, errored *http.Request
+	mw := New()
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request) {
+		derived = r
+		panic("oops")
+	})
+	mw.Use(ErrorPhase, func(w http.ResponseWriter, r *http.Request) {
+		// Error phase middleware finds the error in the request it receives
+		errored = r
+		st.Expect(t, context.Get(r, "vinxi.error").(*PanicError).Value, "oops")
+		w.WriteHeader(500)
+	})
+
+	req := &http.Request{}
+	defer context.Clear(req)
+	mw.ServeHTTP(utils.NewWriterStub(), req)
+	st.Expect(t, derived != req, true)
+	st.Expect(t, errored != nil, true)
+	st.Expect(t, ErrorOf(req), context.Get(req, "vinxi.error"))
+	st.Expect(t, ErrorOf(req).(*PanicError).Value, "oops")
+	st.Expect(t, context.Get(req, "vinxi.generation"), nil)
+
+	// The derived requests values are released once served
+	st.Expect(t, context.Get(derived, "vinxi.error"), nil)
+	st.Expect(t, context.Get(errored, "vinxi.error"), nil)
+}
@@ -0,0 +1,100 @@
+package layer
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+// packageDir stores the package source directory,
+// used to skip the package frames when inferring the registration source.
+var packageDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}()
+
+// Description represents a serializable snapshot of the layer pipeline.
+type Description struct {
+	// Generation stores the layer configuration generation.
+	Generation uint64 `json:"generation"`
+	// Phases stores the layer phases in a stable order. See Phases.
+	Phases []PhaseDescription `json:"phases"`
+}
+
+// PhaseDescription represents the description of a layer phase.
+type PhaseDescription struct {
+	// Name stores the phase name.
+	Name string `json:"name"`
+	// Middleware stores the phase middleware in execution order,
+	// excluding the wildcard phase ones.
+	Middleware []MiddlewareDescription `json:"middleware"`
+}
+
+// MiddlewareDescription represents the description of a registered middleware.
+type MiddlewareDescription struct {
+	// Name stores the middleware name.
+	Name string `json:"name"`
+	// Priority stores the middleware priority name.
+	Priority string `json:"priority"`
+	// Level stores the middleware priority level.
+	Level int `json:"level"`
+	// Source stores the file and line the middleware was registered from, if known.
+	Source string `json:"source,omitempty"`
+	// Disabled stores if the middleware is disabled. See Disable.
+	Disabled bool `json:"disabled,omitempty"`
+	// Calls stores the number of middleware calls, if counted. See WithMiddlewareStats.
+	Calls uint64 `json:"calls,omitempty"`
+}
+
+// Describe returns a serializable description of the layer phases
+// and their registered middleware, designed for admin APIs and debugging tools.
+func (s *Layer) Describe() *Description {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	phases := s.phases()
+	desc := &Description{Generation: s.generation, Phases: make([]PhaseDescription, 0, len(phases))}
+	for _, phase := range phases {
+		stack := s.Pool[phase]
+		if stack == nil {
+			continue
+		}
+		middleware := make([]MiddlewareDescription, len(stack.items))
+		for i, e := range stack.items {
+			middleware[i] = MiddlewareDescription{
+				Name:     e.name,
+				Priority: e.priority.String(),
+				Level:    e.level,
+				Source:   e.source,
+				Disabled: e.disabled,
+				Calls:    atomic.LoadUint64(&e.calls),
+			}
+		}
+		desc.Phases = append(desc.Phases, PhaseDescription{Name: phase, Middleware: middleware})
+	}
+	return desc
+}
+
+// MarshalJSON encodes the layer description as JSON. See Describe.
+func (s *Layer) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Describe())
+}
+
+// callerSource returns the file and line of the first caller outside the package,
+// e.g: "main.go:12", or an empty string if unknown.
+func callerSource() string {
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if frame.File != "" && (filepath.Dir(frame.File) != packageDir || strings.HasSuffix(frame.File, "_test.go")) {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
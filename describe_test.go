@@ -0,0 +1,58 @@
+package layer
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func describedHandler(w http.ResponseWriter, r *http.Request) {}
+
+func TestDescribe(t *testing.T) {
+	mw := New()
+	mw.Use("request", describedHandler)
+	mw.UsePriority("request", Head, describedHandler)
+	mw.UseNamed("response", "named", describedHandler)
+	mw.UsePriority("response", PriorityAt(-10), describedHandler)
+
+	desc := mw.Describe()
+	st.Expect(t, desc.Generation, mw.Generation())
+	st.Expect(t, len(desc.Phases), 2)
+	st.Expect(t, desc.Phases[0].Name, "request")
+	st.Expect(t, desc.Phases[1].Name, "response")
+
+	request := desc.Phases[0].Middleware
+	st.Expect(t, len(request), 2)
+	st.Expect(t, request[0].Name, "layer.describedHandler")
+	st.Expect(t, request[0].Priority, "head")
+	st.Expect(t, request[0].Level, HeadLevel)
+	st.Expect(t, request[1].Priority, "normal")
+	st.Expect(t, filepath.Base(strings.Split(request[0].Source, ":")[0]), "describe_test.go")
+
+	response := desc.Phases[1].Middleware
+	st.Expect(t, response[0].Priority, "level(-10)")
+	st.Expect(t, response[1].Name, "named")
+}
+
+func TestMarshalJSON(t *testing.T) {
+	mw := New()
+	mw.UsePriority("request", Tail, describedHandler)
+
+	data, err := json.Marshal(mw)
+	st.Expect(t, err, nil)
+
+	desc := &Description{}
+	st.Expect(t, json.Unmarshal(data, desc), nil)
+	st.Expect(t, desc.Phases[0].Middleware[0].Priority, "tail")
+	st.Expect(t, desc.Phases[0].Middleware[0].Level, TailLevel)
+}
+
+func TestPriorityString(t *testing.T) {
+	st.Expect(t, TopHead.String(), "top_head")
+	st.Expect(t, TopTail.String(), "top_tail")
+	st.Expect(t, PriorityAt(25).String(), "level(25)")
+}
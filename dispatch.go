@@ -0,0 +1,133 @@
+package layer
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+)
+
+// dispatcher implements an index-based middleware chain dispatcher.
+//
+// Instead of eagerly wrapping every middleware into nested closures before
+// serving the request, each middleware is composed lazily right before
+// it is invoked, using a precomputed step as next handler, so middleware
+// that are never reached, e.g: short-circuited chains, are never composed.
+// The steps are allocated once per dispatched chain.
+//
+// The dispatcher does not provide flat stack usage: middleware handlers call
+// the next one from their own frame and may run code once it returns, as any
+// net/http middleware, so the chain can't be unwound into a loop without
+// breaking them. Every middleware adds its own frame plus the step one,
+// and very deep chains rely on the Go growable stacks, bounded by debug.SetMaxStack.
+type dispatcher struct {
+	// queue stores the middleware functions to dispatch in order.
+	queue []MiddlewareFunc
+	// final stores the final handler called at the end of the chain.
+	final http.Handler
+	// steps stores the dispatcher steps, one per chain position plus the final one.
+	steps []step
+	// phase stores the dispatched phase, used to track the chain position.
+	phase string
+	// position stores the request chain position tracker, if any.
+	position *position
+	// counters stores the layer counters used to count final handler invocations, if any.
+	counters *counters
+	// defaultFinal defines if the final handler is the layer default one.
+	defaultFinal bool
+	// chain stores the dispatched layer chain, used to delegate to request sub-layers.
+	chain *chain
+	// ctx stores the context checked before every step, if any.
+	ctx context.Context
+}
+
+// step represents a position in the middleware chain,
+// used as next handler by the previous middleware.
+type step struct {
+	dispatcher *dispatcher
+	index      int
+}
+
+// newDispatcher creates a new dispatcher for the given middleware queue and final handler.
+func newDispatcher(queue []MiddlewareFunc, final http.Handler) *dispatcher {
+	d := &dispatcher{queue: queue, final: final, steps: make([]step, len(queue)+1)}
+	for i := range d.steps {
+		d.steps[i] = step{dispatcher: d, index: i}
+	}
+	return d
+}
+
+// ServeHTTP dispatches the request starting from the first middleware.
+func (d *dispatcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.steps[0].ServeHTTP(w, r)
+}
+
+// ServeHTTP composes and calls the middleware at the current step position,
+// or the final handler if the end of the chain has been reached.
+// The current position is tracked and only restored if the handler returns
+// normally, so in case of panic it points to the panicking middleware.
+//
+// It's kept as a single frame, since it's stacked once per middleware.
+func (s *step) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d := s.dispatcher
+	if abortOf(r).skips(d.phase) {
+		return
+	}
+	d.extend(r, s.index)
+
+	final := s.index >= len(d.queue)
+	pos := d.position
+	var prev position
+	if pos != nil {
+		prev = *pos
+		*pos = position{phase: d.phase, index: s.index, active: true}
+		if final {
+			pos.index = -1
+		}
+		if d.chain != nil {
+			pos.layer = d.chain.layer
+		}
+	}
+
+	if d.ctx != nil {
+		if err := d.ctx.Err(); err != nil {
+			panic(returnedError{err})
+		}
+	}
+
+	var h http.Handler
+	if final {
+		h = d.finalHandler(r)
+	} else {
+		h = d.queue[s.index](&d.steps[s.index+1])
+	}
+	h.ServeHTTP(w, r)
+
+	if pos != nil {
+		*pos = prev
+	}
+}
+
+// finalHandler counts the final handler invocation and returns it,
+// delegating to the request sub-layers, if any.
+func (d *dispatcher) finalHandler(r *http.Request) http.Handler {
+	d.countFinal()
+	if d.defaultFinal && d.chain != nil {
+		d.chain.layer.logFinalFallback(r, d.phase)
+	}
+	if d.chain != nil {
+		return d.chain.delegate(d.final)
+	}
+	return d.final
+}
+
+// countFinal counts a final handler invocation, if counters are enabled.
+func (d *dispatcher) countFinal() {
+	if d.counters == nil {
+		return
+	}
+	if d.defaultFinal {
+		atomic.AddUint64(&d.counters.defaultFinal, 1)
+		return
+	}
+	atomic.AddUint64(&d.counters.customFinal, 1)
+}
@@ -0,0 +1,115 @@
+package layer
+
+import (
+	"net/http"
+	"runtime"
+	"testing"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/utils.v0"
+)
+
+func TestDispatcherDeepChain(t *testing.T) {
+	mw := New()
+
+	calls := 0
+	for i := 0; i < 10000; i++ {
+		mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+			calls++
+			h.ServeHTTP(w, r)
+		})
+	}
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, calls, 10000)
+	st.Expect(t, w.Code, 502)
+}
+
+func TestDispatcherVeryDeepChain(t *testing.T) {
+	calls := 0
+	queue := make([]MiddlewareFunc, 100000)
+	for i := range queue {
+		queue[i] = func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				h.ServeHTTP(w, r)
+			})
+		}
+	}
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	})
+
+	w := utils.NewWriterStub()
+	newDispatcher(queue, final).ServeHTTP(w, &http.Request{})
+	st.Expect(t, calls, 100000)
+	st.Expect(t, w.Code, 204)
+}
+
+func TestDispatcherStackDepth(t *testing.T) {
+	depth := func(n int, dispatch bool) int {
+		frames := 0
+		queue := make([]MiddlewareFunc, n)
+		for i := range queue {
+			queue[i] = func(h http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					h.ServeHTTP(w, r)
+				})
+			}
+		}
+		var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			frames = runtime.Callers(0, make([]uintptr, 1024))
+		})
+		if dispatch {
+			h = newDispatcher(queue, h)
+		} else {
+			for i := len(queue) - 1; i >= 0; i-- {
+				h = queue[i](h)
+			}
+		}
+		h.ServeHTTP(utils.NewWriterStub(), &http.Request{})
+		return frames
+	}
+
+	// Every middleware only stacks the step frame on top of the nested closures ones
+	nested := depth(11, false) - depth(1, false)
+	st.Expect(t, depth(11, true)-depth(1, true), nested+10)
+}
+
+func TestDispatcherLazyComposition(t *testing.T) {
+	composed := 0
+	middleware := func(h http.Handler) http.Handler {
+		composed++
+		return h
+	}
+	stop := func(h http.Handler) http.Handler {
+		composed++
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(204)
+		})
+	}
+
+	d := newDispatcher([]MiddlewareFunc{middleware, stop, middleware}, FinalHandler)
+	w := utils.NewWriterStub()
+	d.ServeHTTP(w, &http.Request{})
+
+	st.Expect(t, composed, 2)
+	st.Expect(t, w.Code, 204)
+}
+
+func TestDispatcherReentrantNext(t *testing.T) {
+	calls := 0
+	retry := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r)
+			h.ServeHTTP(w, r)
+		})
+	}
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	})
+
+	newDispatcher([]MiddlewareFunc{retry, retry}, final).ServeHTTP(utils.NewWriterStub(), &http.Request{})
+	st.Expect(t, calls, 4)
+}
@@ -0,0 +1,124 @@
+package layer
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DOT returns a Graphviz DOT graph of the layer pipeline: every phase
+// is drawn as a cluster with its middleware in execution order, including
+// the wildcard phase ones, followed by its final handler, so complex
+// pipelines can be visualized and reviewed, e.g:
+//
+//	dot -Tsvg pipeline.dot > pipeline.svg
+//
+// Disabled middleware are drawn dashed. The request phase is linked to
+// the response phase, which runs once it's completed, and to the error phase,
+// triggered on failures.
+func (s *Layer) DOT() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("digraph vinxi {\n")
+	buf.WriteString("\trankdir=LR;\n")
+	buf.WriteString("\tnode [shape=box];\n")
+
+	phases := s.phases()
+	if s.Pool[RequestPhase] != nil && s.Pool[ResponsePhase] == nil {
+		phases = append(phases, ResponsePhase)
+	}
+	if s.Pool[ErrorPhase] == nil {
+		phases = append(phases, ErrorPhase)
+	}
+
+	drawn := make(map[string]bool, len(phases))
+	for _, phase := range phases {
+		if phase == AllPhases {
+			continue
+		}
+		fmt.Fprintf(buf, "\tsubgraph %s {\n", dotID(fmt.Sprintf("cluster_%d", len(drawn))))
+		drawn[phase] = true
+		fmt.Fprintf(buf, "\t\tlabel=%s;\n", dotID(phase))
+
+		prev := dotID(phase + ".start")
+		fmt.Fprintf(buf, "\t\t%s [label=%s, shape=circle];\n", prev, dotID(phase))
+		for j, e := range s.dotEntries(phase) {
+			id := dotID(fmt.Sprintf("%s.%d", phase, j))
+			name := e.name
+			if name == "" {
+				name = "middleware"
+			}
+			style := ""
+			if e.disabled {
+				style = ", style=dashed"
+			}
+			fmt.Fprintf(buf, "\t\t%s [label=%s%s];\n", id, dotID(name+"\n"+e.priority.String()), style)
+			fmt.Fprintf(buf, "\t\t%s -> %s;\n", prev, id)
+			prev = id
+		}
+
+		final := dotID(phase + ".final")
+		fmt.Fprintf(buf, "\t\t%s [label=%s, shape=ellipse];\n", final, dotID(s.dotFinal(phase)))
+		fmt.Fprintf(buf, "\t\t%s -> %s;\n", prev, final)
+		buf.WriteString("\t}\n")
+	}
+
+	if drawn[RequestPhase] && drawn[ResponsePhase] {
+		fmt.Fprintf(buf, "\t%s -> %s [style=dotted];\n", dotID(RequestPhase+".final"), dotID(ResponsePhase+".start"))
+	}
+	if drawn[RequestPhase] {
+		fmt.Fprintf(buf, "\t%s -> %s [style=dashed, label=\"on error\"];\n", dotID(RequestPhase+".start"), dotID(ErrorPhase+".start"))
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// dotEntries returns the entries of the given phase in execution order,
+// including the wildcard phase ones. The mutex must be held.
+func (s *Layer) dotEntries(phase string) []*entry {
+	stack, wildcard := s.Pool[phase], s.Pool[AllPhases]
+	if stack == nil {
+		stack = wildcard
+	}
+	if stack == nil {
+		return nil
+	}
+	if wildcard == nil || wildcard == stack {
+		return stack.items
+	}
+	if stack.factory != nil {
+		return append(append([]*entry(nil), wildcard.items...), stack.items...)
+	}
+	return merge(wildcard.items, stack.items)
+}
+
+// dotFinal returns the final handler label of the given phase. The mutex must be held.
+func (s *Layer) dotFinal(phase string) string {
+	var final http.Handler
+	switch phase {
+	case ResponsePhase:
+		return "no-op"
+	case ErrorPhase:
+		final = s.finalErrorHandler
+		if isNil(final) {
+			return "final error handler"
+		}
+	default:
+		final = s.finalHandler
+		if isNil(final) {
+			return "default final handler"
+		}
+	}
+	return handlerName(final)
+}
+
+// dotID returns the given string as a DOT quoted identifier.
+func dotID(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	return `"` + s + `"`
+}
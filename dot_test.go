@@ -0,0 +1,53 @@
+package layer
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func TestDOT(t *testing.T) {
+	mw := New()
+	mw.UseNamed("request", "foo", orderHandler("foo"))
+	mw.UsePriority(AllPhases, Head, observedHandler)
+	mw.UseNamed("request", `"bar"`, orderHandler("bar"))
+	mw.Disable(`"bar"`)
+	mw.UseFinalHandler(http.NotFoundHandler())
+
+	st.Expect(t, mw.DOT(), `digraph vinxi {
+	rankdir=LR;
+	node [shape=box];
+	subgraph "cluster_0" {
+		label="request";
+		"request.start" [label="request", shape=circle];
+		"request.0" [label="layer.observedHandler\nhead"];
+		"request.start" -> "request.0";
+		"request.1" [label="foo\nnormal"];
+		"request.0" -> "request.1";
+		"request.2" [label="\"bar\"\nnormal", style=dashed];
+		"request.1" -> "request.2";
+		"request.final" [label="http.NotFound", shape=ellipse];
+		"request.2" -> "request.final";
+	}
+	subgraph "cluster_1" {
+		label="response";
+		"response.start" [label="response", shape=circle];
+		"response.0" [label="layer.observedHandler\nhead"];
+		"response.start" -> "response.0";
+		"response.final" [label="no-op", shape=ellipse];
+		"response.0" -> "response.final";
+	}
+	subgraph "cluster_2" {
+		label="error";
+		"error.start" [label="error", shape=circle];
+		"error.0" [label="layer.observedHandler\nhead"];
+		"error.start" -> "error.0";
+		"error.final" [label="final error handler", shape=ellipse];
+		"error.0" -> "error.final";
+	}
+	"request.final" -> "response.start" [style=dotted];
+	"request.start" -> "error.start" [style=dashed, label="on error"];
+}
+`)
+}
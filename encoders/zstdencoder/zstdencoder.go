@@ -0,0 +1,38 @@
+// Package zstdencoder implements the zstd content encoding for the layer
+// response compressor, kept apart from the layer package so its
+// dependency is only required when used:
+//
+//	compressor := layer.NewCompressor()
+//	zstdencoder.Register(compressor)
+//	mw.Use("request", compressor)
+//
+// Since layer.NewCompressor registers gzip first, gzip is preferred
+// when the client accepts both encodings with the same quality value.
+package zstdencoder
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+// Encoding defines the zstd content encoding name.
+const Encoding = "zstd"
+
+// Encoder implements a layer.EncoderFunc creating zstd compressing writers
+// with the default options. The returned writers support streaming
+// responses, since they implement a Flush() error method.
+func Encoder(w io.Writer) io.WriteCloser {
+	encoder, err := zstd.NewWriter(w)
+	if err != nil {
+		// The default options are always valid
+		panic(err)
+	}
+	return encoder
+}
+
+// Register registers the zstd content encoding in the given compressor.
+func Register(c *layer.Compressor) {
+	c.Register(Encoding, Encoder)
+}
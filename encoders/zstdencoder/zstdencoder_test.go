@@ -0,0 +1,46 @@
+package zstdencoder
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+func TestRegister(t *testing.T) {
+	c := layer.NewCompressor()
+	Register(c)
+	mw := layer.New()
+	mw.Use("request", c)
+
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0.5, zstd")
+	w := httptest.NewRecorder()
+	mw.Run("request", w, req, final)
+
+	st.Expect(t, w.Header().Get("Content-Encoding"), "zstd")
+	st.Expect(t, w.Header().Get("Vary"), "Accept-Encoding")
+
+	reader, err := zstd.NewReader(w.Body)
+	st.Expect(t, err, nil)
+	defer reader.Close()
+	body, _ := ioutil.ReadAll(reader)
+	st.Expect(t, string(body), "hello world")
+}
+
+func TestEncoderFlush(t *testing.T) {
+	w := Encoder(ioutil.Discard)
+	_, ok := w.(interface {
+		Flush() error
+	})
+	st.Expect(t, ok, true)
+	st.Expect(t, w.Close(), nil)
+}
@@ -0,0 +1,85 @@
+package layer
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var (
+	// ErrNilHandler is used when a nil middleware handler is registered.
+	ErrNilHandler = errors.New("vinxi: nil middleware handler")
+
+	// ErrUnknownPhase is used when an unknown phase is used in strict phases mode.
+	ErrUnknownPhase = errors.New("vinxi: unknown middleware phase")
+
+	// ErrReservedPhase is used when a custom phase collides with a reserved phase.
+	ErrReservedPhase = errors.New("vinxi: reserved middleware phase")
+
+	// ErrDuplicateName is used when a named middleware handler is already registered in the phase.
+	ErrDuplicateName = errors.New("vinxi: duplicated middleware name")
+
+	// ErrUnknownMiddleware is used when a named middleware handler is not registered in the phase.
+	ErrUnknownMiddleware = errors.New("vinxi: unknown middleware name")
+
+	// ErrFrozen is used when a frozen layer configuration is mutated. See Freeze.
+	ErrFrozen = errors.New("vinxi: frozen layer cannot be mutated")
+)
+
+// HandlerError represents a middleware handler registration error,
+// reporting the phase and the handler argument position that caused it.
+type HandlerError struct {
+	// Phase stores the middleware phase where the handler was registered.
+	Phase string
+	// Index stores the zero-based position of the handler argument.
+	Index int
+	// Err stores the underlying registration error.
+	Err error
+}
+
+// Error returns the error message.
+func (e *HandlerError) Error() string {
+	return fmt.Sprintf("%s (phase %q, argument %d)", e.Err, e.Phase, e.Index)
+}
+
+// PhaseError represents a middleware phase validation error.
+type PhaseError struct {
+	// Phase stores the offending phase name.
+	Phase string
+	// Err stores the underlying phase error.
+	Err error
+}
+
+// Error returns the error message.
+func (e *PhaseError) Error() string {
+	return fmt.Sprintf("%s: %q", e.Err, e.Phase)
+}
+
+// NameError represents a named middleware handler lookup error.
+type NameError struct {
+	// Phase stores the middleware phase where the handler was looked up.
+	Phase string
+	// Name stores the offending middleware name.
+	Name string
+	// Err stores the underlying lookup error.
+	Err error
+}
+
+// Error returns the error message.
+func (e *NameError) Error() string {
+	return fmt.Sprintf("%s: %q (phase %q)", e.Err, e.Name, e.Phase)
+}
+
+// isNil reports whether the given handler is nil or a typed nil value,
+// such as a nil function or a nil pointer stored in an interface.
+func isNil(h interface{}) bool {
+	if h == nil {
+		return true
+	}
+	v := reflect.ValueOf(h)
+	switch v.Kind() {
+	case reflect.Func, reflect.Ptr, reflect.Map, reflect.Chan, reflect.Interface, reflect.Slice:
+		return v.IsNil()
+	}
+	return false
+}
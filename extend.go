@@ -0,0 +1,64 @@
+package layer
+
+import "net/http"
+
+// extension stores the handlers appended to a request phase chain.
+type extension struct {
+	phase string
+	queue []MiddlewareFunc
+}
+
+// AppendToRequest appends the given handlers to the remainder of the
+// request middleware chain, allowing earlier middleware, such as routers,
+// to attach request-specific middleware decided late.
+//
+// The handlers are spliced into the currently running phase chain right
+// after the current position, so they run once the current middleware calls
+// its next handler, before the rest of the chain and the final handler.
+// Handlers appended by the final handler or outside of a running chain are ignored.
+//
+// It panics if any of the handlers is nil or implements an unsupported interface.
+// Registrable handlers are not supported.
+func AppendToRequest(r *http.Request, handler ...interface{}) {
+	queue := make([]MiddlewareFunc, len(handler))
+	for i, h := range handler {
+		if isNil(h) {
+			panic(&HandlerError{Index: i, Err: ErrNilHandler})
+		}
+		if queue[i] = AdaptFunc(h); queue[i] == nil {
+			panic("vinxi: unsupported middleware interface")
+		}
+	}
+
+	var phase string
+	if pos := positionFor(r); pos.active {
+		phase = pos.phase
+	}
+	if ext, ok := getValue(r, "vinxi.extension").(*extension); ok && ext != nil && ext.phase == phase {
+		ext.queue = append(ext.queue, queue...)
+		return
+	}
+
+	setLocal(r, "vinxi.extension", &extension{phase: phase, queue: queue})
+}
+
+// extend splices the handlers appended to the request for the dispatched
+// phase, if any, at the given chain position.
+func (d *dispatcher) extend(r *http.Request, index int) {
+	ext, ok := getValue(r, "vinxi.extension").(*extension)
+	if !ok || ext == nil || (ext.phase != "" && ext.phase != d.phase) {
+		return
+	}
+	setLocal(r, "vinxi.extension", nil)
+
+	queue := make([]MiddlewareFunc, 0, len(d.queue)+len(ext.queue))
+	queue = append(queue, d.queue[:index]...)
+	queue = append(queue, ext.queue...)
+	d.queue = append(queue, d.queue[index:]...)
+
+	// Steps already handed out keep pointing to valid positions, since they're index-based
+	d.steps = make([]step, len(d.queue)+1)
+	for i := range d.steps {
+		d.steps[i] = step{dispatcher: d, index: i}
+	}
+}
@@ -0,0 +1,53 @@
+package layer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func orderHandler(name string) func(http.ResponseWriter, *http.Request, http.Handler) {
+	return func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Header().Add("X-Order", name)
+		h.ServeHTTP(w, r)
+	}
+}
+
+func TestAppendToRequest(t *testing.T) {
+	mw := New()
+	mw.Use("request", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		AppendToRequest(r, orderHandler("route-1"))
+		AppendToRequest(r, orderHandler("route-2"))
+		h.ServeHTTP(w, r)
+	})
+	mw.Use("request", orderHandler("tail"))
+
+	w := httptest.NewRecorder()
+	mw.Run("request", w, &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Order", "final")
+	}))
+	st.Expect(t, w.Header()["X-Order"], []string{"route-1", "route-2", "tail", "final"})
+
+	// Extensions are request-scoped
+	w = httptest.NewRecorder()
+	mw.Use("response", orderHandler("response"))
+	mw.Run("response", w, &http.Request{}, nil)
+	st.Expect(t, w.Header()["X-Order"], []string{"response"})
+}
+
+func TestAppendToRequestLastPosition(t *testing.T) {
+	mw := New()
+	mw.Use("request", orderHandler("head"))
+	mw.Use("request", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		AppendToRequest(r, orderHandler("route"))
+		h.ServeHTTP(w, r)
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run("request", w, &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Order", "final")
+	}))
+	st.Expect(t, w.Header()["X-Order"], []string{"head", "route", "final"})
+}
@@ -0,0 +1,37 @@
+package layer
+
+import "sync/atomic"
+
+// Freeze makes the layer configuration immutable, eagerly building
+// every phase middleware chain, so frozen layers can be safely handed
+// to untrusted code for execution.
+//
+// Once frozen, every mutating method, e.g: Use, Remove, Replace, Promote,
+// Configure or LoadPlugin, panics with ErrFrozen, so use Frozen to check it
+// beforehand if necessary. Freezing is irreversible and only applies to the
+// layer itself: parent and inherited layers must be frozen on their own.
+// Direct access to the Pool stacks is not guarded.
+//
+// Frozen layers serve requests without locking their configuration.
+func (s *Layer) Freeze() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.Frozen() {
+		return
+	}
+	s.compile()
+	atomic.StoreInt32(&s.frozen, 1)
+}
+
+// Frozen reports whether the layer configuration is immutable. See Freeze.
+func (s *Layer) Frozen() bool {
+	return atomic.LoadInt32(&s.frozen) != 0
+}
+
+// mutable panics with ErrFrozen if the layer is frozen.
+// The mutex must be held.
+func (s *Layer) mutable() {
+	if s.Frozen() {
+		panic(ErrFrozen)
+	}
+}
@@ -0,0 +1,59 @@
+package layer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func expectFrozen(t *testing.T, fn func()) {
+	defer func() {
+		st.Expect(t, recover(), ErrFrozen)
+	}()
+	fn()
+}
+
+func TestFreeze(t *testing.T) {
+	mw := New()
+	mw.Use("request", orderHandler("foo"))
+	mw.Use(AllPhases, orderHandler("all"))
+	st.Expect(t, mw.Frozen(), false)
+
+	mw.Freeze()
+	mw.Freeze()
+	st.Expect(t, mw.Frozen(), true)
+	st.Expect(t, mw.Pool["request"].memo != nil, true)
+	st.Expect(t, runOrder(mw, "request"), []string{"all", "foo", "final"})
+
+	expectFrozen(t, func() { mw.Use("request", orderHandler("bar")) })
+	expectFrozen(t, func() { mw.UsePriority("request", Head, orderHandler("bar")) })
+	expectFrozen(t, func() { mw.UseFinalHandler(http.NotFoundHandler()) })
+	expectFrozen(t, func() { mw.Flush() })
+	expectFrozen(t, func() { mw.Remove("request", "foo") })
+	expectFrozen(t, func() { mw.Disable("foo") })
+	expectFrozen(t, func() { mw.Enable("foo") })
+	expectFrozen(t, func() { mw.Replace("request", "foo", orderHandler("bar")) })
+	expectFrozen(t, func() { mw.UseAfter("request", "foo", orderHandler("bar")) })
+	expectFrozen(t, func() { mw.MoveAfter("request", "foo", "all") })
+	expectFrozen(t, func() { mw.UseCanaryFinalHandler(Canary{}) })
+	st.Expect(t, mw.Configure(&Config{}), ErrFrozen)
+	expectFrozen(t, func() { mw.UnloadPlugin("foo.so") })
+
+	// The layer keeps serving requests
+	st.Expect(t, runOrder(mw, "request"), []string{"all", "foo", "final"})
+
+	w := adminRequest(AdminHandler(mw), "DELETE", "/phases/request", "")
+	st.Expect(t, w.Code, http.StatusConflict)
+	w = adminRequest(AdminHandler(mw), "GET", "/", "")
+	st.Expect(t, w.Code, http.StatusOK)
+}
+
+func TestFreezeEmpty(t *testing.T) {
+	mw := New()
+	mw.Freeze()
+	w := httptest.NewRecorder()
+	mw.Run("request", w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 502)
+}
@@ -0,0 +1,163 @@
+package layer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+var (
+	writerType  = reflect.TypeOf((*http.ResponseWriter)(nil)).Elem()
+	requestType = reflect.TypeOf((*http.Request)(nil))
+	handlerType = reflect.TypeOf((*http.Handler)(nil)).Elem()
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// DependencyError represents an unresolved handler dependency error,
+// exposed via the "vinxi.error" context key.
+type DependencyError struct {
+	// Type stores the unresolved parameter type.
+	Type reflect.Type
+}
+
+// Error returns the error message.
+func (e *DependencyError) Error() string {
+	return fmt.Sprintf("vinxi: unresolved handler dependency: %s", e.Type)
+}
+
+// Injector stores the values injected into dependency-injected handlers by type,
+// in the Martini fashion.
+type Injector struct {
+	mutex  sync.RWMutex
+	values map[reflect.Type]reflect.Value
+}
+
+// NewInjector creates a new empty injector.
+func NewInjector() *Injector {
+	return &Injector{values: make(map[reflect.Type]reflect.Value)}
+}
+
+// Map maps the given value by its own type.
+func (i *Injector) Map(value interface{}) *Injector {
+	v := reflect.ValueOf(value)
+	i.set(v.Type(), v)
+	return i
+}
+
+// MapTo maps the given value by the interface type pointed by the given pointer,
+// e.g: MapTo(logger, (*Logger)(nil)).
+func (i *Injector) MapTo(value interface{}, ifacePtr interface{}) *Injector {
+	i.set(reflect.TypeOf(ifacePtr).Elem(), reflect.ValueOf(value))
+	return i
+}
+
+// set maps the given value by the given type.
+func (i *Injector) set(t reflect.Type, v reflect.Value) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.values[t] = v
+}
+
+// get returns the value mapped by the given type, if any.
+func (i *Injector) get(t reflect.Type) (reflect.Value, bool) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	v, ok := i.values[t]
+	return v, ok
+}
+
+// WithInjector defines the injector used to resolve
+// the dependencies of the handlers registered via UseInjected.
+func WithInjector(injector *Injector) Option {
+	return func(s *Layer) {
+		s.injector = injector
+	}
+}
+
+// UseInjected registers new dependency-injected handlers for the given phase,
+// which are functions with an arbitrary parameter list, optionally returning an error:
+//
+//	mw.UseInjected("request", func(log *Logger, w http.ResponseWriter, r *http.Request) {
+//	  log.Print(r.URL)
+//	})
+//
+// The http.ResponseWriter, *http.Request, http.Handler (next handler) and
+// context.Context parameters are resolved from the request, and any other
+// parameter from the layer injector, configured via WithInjector.
+// Unresolved parameters trigger the error phase with a *DependencyError.
+//
+// Handlers without an http.Handler parameter call the next handler
+// once they return, unless the response has been already written.
+// Returned errors trigger the error phase as with HandlerFuncError.
+func (s *Layer) UseInjected(phase string, handler ...interface{}) {
+	s.mutex.RLock()
+	injector := s.injector
+	s.mutex.RUnlock()
+	if injector == nil {
+		injector = NewInjector()
+	}
+
+	phase = s.phase(phase)
+	for i, h := range handler {
+		if isNil(h) {
+			panic(&HandlerError{Phase: phase, Index: i, Err: ErrNilHandler})
+		}
+		mw := adaptInjected(injector, h)
+		if mw == nil {
+			panic("vinxi: unsupported middleware interface")
+		}
+		s.push(phase, Normal, newEntry(h, mw))
+	}
+}
+
+// adaptInjected adapts the given dependency-injected handler function,
+// returning nil if it's not a non-variadic function or returns anything but an error.
+func adaptInjected(injector *Injector, h interface{}) MiddlewareFunc {
+	fn := reflect.ValueOf(h)
+	t := fn.Type()
+	if t.Kind() != reflect.Func || t.IsVariadic() || t.NumOut() > 1 || (t.NumOut() == 1 && t.Out(0) != errorType) {
+		return nil
+	}
+
+	params := make([]reflect.Type, t.NumIn())
+	callsNext := false
+	for i := range params {
+		params[i] = t.In(i)
+		callsNext = callsNext || params[i] == handlerType
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			args := make([]reflect.Value, len(params))
+			for i, param := range params {
+				switch param {
+				case writerType:
+					args[i] = reflect.ValueOf(&w).Elem()
+				case requestType:
+					args[i] = reflect.ValueOf(r)
+				case handlerType:
+					args[i] = reflect.ValueOf(&next).Elem()
+				case contextType:
+					args[i] = reflect.ValueOf(r.Context())
+				default:
+					v, ok := injector.get(param)
+					if !ok {
+						panic(returnedError{&DependencyError{Type: param}})
+					}
+					args[i] = v
+				}
+			}
+
+			out := fn.Call(args)
+			if len(out) == 1 && !out[0].IsNil() {
+				panic(returnedError{out[0].Interface().(error)})
+			}
+			if !callsNext && !committed(w) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package layer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/utils.v0"
+)
+
+type greeter interface {
+	Greet() string
+}
+
+type englishGreeter struct{}
+
+func (englishGreeter) Greet() string { return "hello" }
+
+type counter struct {
+	calls int
+}
+
+func TestUseInjected(t *testing.T) {
+	c := &counter{}
+	injector := NewInjector().Map(c).MapTo(englishGreeter{}, (*greeter)(nil))
+	mw := New(WithInjector(injector))
+
+	mw.UseInjected(RequestPhase, func(c *counter, g greeter, w http.ResponseWriter) {
+		c.calls++
+		w.Header().Set("greeting", g.Greet())
+	}, func(ctx context.Context, r *http.Request, w http.ResponseWriter, next http.Handler) {
+		c.calls++
+		st.Expect(t, ctx, r.Context())
+		next.ServeHTTP(w, r)
+	})
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	}))
+	st.Expect(t, c.calls, 2)
+	st.Expect(t, w.Code, 204)
+	st.Expect(t, w.Header().Get("greeting"), "hello")
+}
+
+func TestUseInjectedWrittenResponse(t *testing.T) {
+	mw := New()
+	mw.UseInjected(RequestPhase, func(w http.ResponseWriter) {
+		w.WriteHeader(202)
+	})
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("next handler must not be called")
+	}))
+	st.Expect(t, w.Code, 202)
+}
+
+func TestUseInjectedErrors(t *testing.T) {
+	mw := New()
+	mw.UseInjected(RequestPhase, func(c *counter) {})
+
+	req := Attach(&http.Request{})
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, req, nil)
+	st.Expect(t, w.Code, 500)
+	err, ok := ErrorOf(req).(*DependencyError)
+	st.Expect(t, ok, true)
+	st.Expect(t, err.Error(), "vinxi: unresolved handler dependency: *layer.counter")
+
+	errFailed := errors.New("failed")
+	mw = New()
+	mw.UseInjected(RequestPhase, func() error { return errFailed })
+	req = Attach(&http.Request{})
+	mw.Run(RequestPhase, utils.NewWriterStub(), req, nil)
+	st.Expect(t, ErrorOf(req), errFailed)
+}
+
+func TestUseInjectedUnsupported(t *testing.T) {
+	defer func() {
+		st.Expect(t, recover(), "vinxi: unsupported middleware interface")
+	}()
+	New().UseInjected(RequestPhase, func() int { return 0 })
+}
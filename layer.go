@@ -3,9 +3,13 @@
 package layer
 
 import (
+	"context"
+	"log/slog"
 	"net/http"
-
-	"gopkg.in/vinxi/context.v0"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
@@ -13,22 +17,64 @@ const (
 	ErrorPhase = "error"
 	// RequestPhase defines the default middleware phase for request.
 	RequestPhase = "request"
+	// ResponsePhase defines the middleware phase executed once the request phase is completed.
+	ResponsePhase = "response"
+	// AllPhases defines the wildcard phase, whose middleware run in every phase
+	// before the phase-specific middleware with the same priority.
+	AllPhases = "*"
 )
 
-// FinalHandler stores the default http.Handler used as final middleware chain.
-// You can customize this handler in order to reply with a default error response.
-var FinalHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+// defaultFinalHandler stores the built-in final handler used as safe fallback.
+var defaultFinalHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(502)
 	w.Write([]byte("Bad Gateway"))
 })
 
-// FinalErrorHandler stores the default http.Handler used as final middleware chain.
-// You can customize this handler in order to reply with a default error response.
-var FinalErrorHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+// defaultFinalErrorHandler stores the built-in final error handler used as safe fallback.
+var defaultFinalErrorHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(500)
 	w.Write([]byte("Proxy Error"))
 })
 
+// FinalHandler stores the default http.Handler used as final middleware chain.
+// You can customize this handler in order to reply with a default error response.
+//
+// Layers copy it on creation: prefer WithFinalHandler or Layer.UseFinalHandler
+// to configure a specific layer without affecting every layer in the process.
+var FinalHandler = defaultFinalHandler
+
+// FinalErrorHandler stores the default http.Handler used as final middleware chain.
+// You can customize this handler in order to reply with a default error response.
+//
+// It's only used by layers without their own final error handler:
+// prefer WithFinalErrorHandler or Layer.SetFinalErrorHandler to configure
+// a specific layer without affecting every layer in the process.
+var FinalErrorHandler = defaultFinalErrorHandler
+
+// finalHandler returns the given final handler, falling back to
+// the package level or built-in final handler if it is nil.
+func finalHandler(h http.Handler) http.Handler {
+	if !isNil(h) {
+		return h
+	}
+	if FinalHandler != nil {
+		return FinalHandler
+	}
+	return defaultFinalHandler
+}
+
+// finalErrorHandler returns the given final error handler, falling back to
+// the package level or built-in final error handler if it is nil.
+func finalErrorHandler(h http.Handler) http.Handler {
+	if !isNil(h) {
+		return h
+	}
+	if FinalErrorHandler != nil {
+		return FinalErrorHandler
+	}
+	return defaultFinalErrorHandler
+}
+
 // Runnable represents the required interface for a runnable
 type Runnable interface {
 	Run(string, http.ResponseWriter, *http.Request, http.Handler)
@@ -63,69 +109,367 @@ type Pool map[string]*Stack
 
 // Layer type represent an HTTP domain
 // specific middleware layer with hieritance support.
+//
+// Layer is safe for concurrent use: its configuration can be mutated
+// via its methods while requests are being served,
+// including from middleware running within the layer itself.
+// Every Run operates on a copy of the phase chain taken when it starts,
+// so mutations such as Use or Flush never affect in-flight chains and
+// only take effect in subsequent calls to Run.
 type Layer struct {
+	// skipped stores the number of runs skipped due to already committed responses.
+	// Accessed atomically, declared first to guarantee 64-bit alignment.
+	skipped uint64
+	// counters stores the layer cumulative counters, accessed atomically.
+	counters counters
+	// skipCommitted enables skipping the chain on already committed responses.
+	skipCommitted bool
+	// keepWrittenFinal disables skipping the final handler on responses written by the chain.
+	keepWrittenFinal bool
+	// normalize enables phase names normalization.
+	normalize bool
+	// foldCase enables phase names case folding on normalization.
+	foldCase bool
+	// strict enables rejecting unknown phase names.
+	strict bool
+	// strictTransitions enables enforcing legal request lifecycle state transitions.
+	strictTransitions bool
+	// noRecover disables the built-in panic recovery.
+	noRecover bool
+	// recoverFunc stores the custom panic recovery function, if any.
+	recoverFunc RecoverFunc
+	// panicFilter stores the predicate selecting the panics to propagate, if any.
+	panicFilter PanicFilter
+	// statusErrors enables triggering the error phase on 5xx responses.
+	statusErrors bool
+	// bufferResponses enables buffering the request phase responses.
+	bufferResponses bool
+	// canary stores the canary final handler, if any.
+	canary *canary
+	// splitKey stores the traffic split key, if any.
+	splitKey SplitKey
+	// middlewareStats enables counting the middleware calls.
+	middlewareStats bool
+	// requestTrace enables recording the request execution trace.
+	requestTrace bool
+	// logger stores the chains execution events logger, if any.
+	logger *slog.Logger
+	// profilerLabels enables tagging the middleware calls with profiler labels.
+	profilerLabels bool
+	// observers stores the chains execution observers. See AddObserver.
+	observers []Observer
+	// noMemo disables memoizing the phase chains.
+	noMemo bool
+	// buildPolicy stores when the phase chains are built.
+	buildPolicy BuildPolicy
+	// plugins stores the loaded plugins by path.
+	plugins map[string]*loadedPlugin
+	// injector stores the dependency-injected handlers injector, if any.
+	injector *Injector
+	// order stores the phases in stack creation order.
+	order []string
+	// stackFactory stores the custom middleware stack implementation factory, if any.
+	stackFactory func() MiddlewareStack
+	// defined stores the explicitly defined valid phases, if any.
+	defined map[string]bool
+	// timeouts stores the middleware chain timeout per phase.
+	timeouts map[string]time.Duration
+	// finalTimeout stores the final handler timeout, if any.
+	finalTimeout time.Duration
+	// mutex guards the layer configuration against concurrent mutations,
+	// allowing concurrent runs to read the configuration in parallel.
+	mutex sync.RWMutex
+	// statsMutex guards the panic counters, hooks, shadows and mirrors.
+	statsMutex sync.Mutex
+	// panics stores the recovered panic counters.
+	panics PanicStats
+	// panicHooks stores the hooks called on recovered panics.
+	panicHooks []PanicHook
+	// shadows stores the shadowed middleware counters by name.
+	shadows map[string]*shadow
+	// mirrors stores the request mirrors counters by name.
+	mirrors map[string]*mirror
+	// runs stores the number of runs per phase as *uint64, accessed atomically.
+	runs sync.Map
+	// sequences stores the phase sequences run by RunAll by phases list.
+	sequences sync.Map
+	// latency stores the Run latency histogram.
+	latency histogram
+	// generation stores the configuration version, incremented on every mutation.
+	generation uint64
+	// changes stores the channel closed on the next mutation, if watched. See Changes.
+	changes chan struct{}
 	// finalHandler stores the final middleware chain handler.
 	finalHandler http.Handler
+
+	// finalErrorHandler stores the error phase final handler, if any.
+	finalErrorHandler http.Handler
 	// parent stores the parent middleware layer to use. Use SetParent(parent).
 	parent Middleware
+	// inherit stores the layer inherited middleware layer, if any. See NewChild.
+	inherit *Layer
+	// childFirst defines if the layer middleware run before the inherited ones.
+	childFirst bool
+	// staged stores the staged layer candidate, if any. Use Stage(layer).
+	staged *Layer
+	// frozen defines if the layer configuration is immutable, accessed atomically. See Freeze.
+	frozen int32
+	// commandMutex serializes the applied commands. See Apply.
+	commandMutex sync.Mutex
+	// commandVersion stores the last applied command version.
+	commandVersion uint64
 	// Pool stores the phase-specific middleware handlers stack.
+	// Direct access is not synchronized, so use the Layer methods instead
+	// while the layer is serving requests.
 	Pool Pool
 }
 
-// New creates a new middleware layer.
-func New() *Layer {
-	return &Layer{Pool: make(Pool), finalHandler: FinalHandler}
+// New creates a new middleware layer, optionally configured with the given options.
+func New(opts ...Option) *Layer {
+	s := &Layer{Pool: make(Pool), finalHandler: FinalHandler}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Flush flushes the middleware pool.
+//
+// Flushing removes every registered handler, including the error phase ones,
+// but never the error phase terminator: panics are still recovered and
+// replied by FinalErrorHandler, or by the built-in final error handler if nil.
+// Loaded plugins are unloaded as well, see LoadPlugin.
 func (s *Layer) Flush() {
+	s.mutex.Lock()
+	if s.Frozen() {
+		s.mutex.Unlock()
+		panic(ErrFrozen)
+	}
+	plugins := s.plugins
 	s.Pool = make(Pool)
+	s.order, s.plugins = nil, nil
+	s.bump()
+	s.mutex.Unlock()
+
+	// Close the unloaded plugins, if any
+	for _, p := range plugins {
+		p.close()
+	}
+}
+
+// FlushPhase removes every handler registered in the given phase,
+// returning the number of removed handlers, e.g: FlushPhase("error")
+// resets the error handling middleware without disturbing the other phases.
+//
+// Flushing the wildcard phase removes its handlers from every phase chain.
+// As with Flush, the error phase terminator is never removed.
+// Flushing takes effect in subsequent calls to Run.
+func (s *Layer) FlushPhase(phase string) int {
+	phase = s.phase(phase)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.mutable()
+
+	stack := s.Pool[phase]
+	if stack == nil {
+		return 0
+	}
+	delete(s.Pool, phase)
+	s.touch(phase)
+	return len(stack.items)
+}
+
+// Generation returns the current layer configuration generation.
+// The generation is incremented every time the layer is mutated,
+// and the generation used by a given request can be retrieved
+// via GenerationOf.
+func (s *Layer) Generation() uint64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.generation
+}
+
+// Changes returns a channel closed once the layer configuration is mutated,
+// i.e. its generation is incremented, designed to watch the layer changes:
+//
+//	for {
+//		changes := mw.Changes()
+//		publish(mw.Describe())
+//		<-changes
+//	}
+func (s *Layer) Changes() <-chan struct{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.changes == nil {
+		s.changes = make(chan struct{})
+	}
+	return s.changes
+}
+
+// bump increments the layer configuration generation, notifying the
+// layer changes watchers, if any. See Changes.
+// The mutex must be held.
+func (s *Layer) bump() {
+	s.generation++
+	if s.changes != nil {
+		close(s.changes)
+		s.changes = nil
+	}
+}
+
+// SkippedRuns returns the number of middleware chain or final handler calls
+// skipped because the response was already committed.
+// See WithSkipCommitted and WithSkipWrittenFinal options.
+func (s *Layer) SkippedRuns() uint64 {
+	return atomic.LoadUint64(&s.skipped)
 }
 
 // Use registers new handlers for the given phase in the middleware stack.
+// Handlers registered with the same priority run in registration order.
 func (s *Layer) Use(phase string, handler ...interface{}) {
 	s.use(phase, Normal, handler...)
 }
 
 // UsePriority registers new handlers for the given phase in the middleware stack with a custom priority.
+//
+// Handlers registered with the same priority run in registration order,
+// except for the TopHead and TopTail priorities, which place the handlers
+// of every call before the previously registered ones, keeping their given order.
 func (s *Layer) UsePriority(phase string, priority Priority, handler ...interface{}) {
 	s.use(phase, priority, handler...)
 }
 
+// UsePhases registers new handlers for every given phase in the middleware stack.
+// The handlers are registered in every phase at once, so concurrent runs
+// either see them in every phase or in none of them.
+// Registrable handlers are not supported.
+func (s *Layer) UsePhases(phases []string, handler ...interface{}) {
+	names := make([]string, len(phases))
+	for i, phase := range phases {
+		names[i] = s.phase(phase)
+	}
+
+	fns := make([]MiddlewareFunc, len(handler))
+	for i, h := range handler {
+		if isNil(h) {
+			panic(&HandlerError{Phase: strings.Join(names, ","), Index: i, Err: ErrNilHandler})
+		}
+		if fns[i] = AdaptFunc(h); fns[i] == nil {
+			panic("vinxi: unsupported middleware interface")
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.mutable()
+	for _, phase := range names {
+		stack := s.phaseStack(phase)
+		for i, h := range handler {
+			stack.push(Normal, newEntry(h, fns[i]))
+		}
+		s.touch(phase)
+	}
+}
+
+// UseNamed registers a new handler for the given phase identified by the given name.
+// The name can be used later to remove or replace the handler.
+// If the name is empty, the name is inferred from the handler.
+// Registrable handlers are not supported.
+//
+// It panics with a *HandlerError if a handler with the same name
+// is already registered in the phase.
+func (s *Layer) UseNamed(phase, name string, handler interface{}) {
+	phase = s.phase(phase)
+	if isNil(handler) {
+		panic(&HandlerError{Phase: phase, Index: 0, Err: ErrNilHandler})
+	}
+	mw := AdaptFunc(handler)
+	if mw == nil {
+		panic("vinxi: unsupported middleware interface")
+	}
+
+	e := newEntry(handler, mw)
+	if name != "" {
+		e.name = name
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.mutable()
+	stack := s.phaseStack(phase)
+	if name != "" && stack.find(name) != nil {
+		panic(&HandlerError{Phase: phase, Index: 0, Err: ErrDuplicateName})
+	}
+	stack.push(Normal, e)
+	s.touch(phase)
+}
+
 // UseFinalHandler defines an http.Handler as final middleware call chain handler.
 // This handler is tipically responsible of replying with a custom response
 // or error (e.g: cannot route the request).
+//
+// If the given handler is nil, the default final handler is used instead
+// and the misconfiguration is reported by Check.
 func (s *Layer) UseFinalHandler(fn http.Handler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.mutable()
 	s.finalHandler = fn
+	s.bump()
+}
+
+// SetFinalErrorHandler defines an http.Handler as final error phase handler,
+// replying to the client once the error phase middleware chain is completed.
+//
+// If the given handler is nil, the package level FinalErrorHandler is used instead.
+func (s *Layer) SetFinalErrorHandler(fn http.Handler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.mutable()
+	s.finalErrorHandler = fn
+	s.bump()
 }
 
 // SetParent sets a new middleware layer as parent layer,
 // allowing to trigger ancestors layer from the current one.
 func (s *Layer) SetParent(parent Middleware) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.mutable()
 	s.parent = parent
+	s.bump()
 }
 
 // use is used internally to register one or multiple middleware handlers
 // in the middleware pool in the given phase and ordered by the given priority.
-func (s *Layer) use(phase string, priority Priority, handler ...interface{}) *Layer {
-	if s.Pool[phase] == nil {
-		s.Pool[phase] = &Stack{}
+func (s *Layer) use(phase string, priority Priority, handler ...interface{}) []*entry {
+	phase = s.phase(phase)
+	var entries []*entry
+	for i := range handler {
+		if priority == TopHead || priority == TopTail {
+			// Register in reverse order, so the handlers keep the given order
+			i = len(handler) - 1 - i
+		}
+		if e := register(s, phase, priority, i, handler[i]); e != nil {
+			entries = append(entries, e)
+		}
 	}
+	return entries
+}
 
-	stack := s.Pool[phase]
-	for _, h := range handler {
-		register(s, stack, priority, h)
+// register infers the handler interface and registers it in the given layer phase,
+// returning the registered stack entry, or nil for registrable handlers.
+// It panics with a *HandlerError if the handler at the given position is nil.
+func register(layer *Layer, phase string, priority Priority, index int, handler interface{}) *entry {
+	if isNil(handler) {
+		panic(&HandlerError{Phase: phase, Index: index, Err: ErrNilHandler})
 	}
 
-	return s
-}
-
-// register infers the handler interface and registers it in the given middleware stack.
-func register(layer *Layer, stack *Stack, priority Priority, handler interface{}) {
 	// Vinci's registrable interface
 	if r, ok := handler.(Registrable); ok {
 		r.Register(layer)
-		return
+		return nil
 	}
 
 	// Otherwise infer the function interface
@@ -134,74 +478,503 @@ func register(layer *Layer, stack *Stack, priority Priority, handler interface{}
 		panic("vinxi: unsupported middleware interface")
 	}
 
-	stack.Push(priority, mw)
+	e := newEntry(handler, mw)
+	layer.push(phase, priority, e)
+	return e
+}
+
+// useWith registers one or multiple middleware handlers in the given phase,
+// decorating every adapted middleware function with the given decorator.
+// Registrable handlers cannot be decorated and are not supported.
+func (s *Layer) useWith(phase string, priority Priority, decorate func(MiddlewareFunc) MiddlewareFunc, handler ...interface{}) {
+	phase = s.phase(phase)
+	for i, h := range handler {
+		if isNil(h) {
+			panic(&HandlerError{Phase: phase, Index: i, Err: ErrNilHandler})
+		}
+		mw := AdaptFunc(h)
+		if mw == nil {
+			panic("vinxi: unsupported middleware interface")
+		}
+		s.push(phase, priority, newEntry(h, decorate(mw)))
+	}
+}
+
+// push pushes the given middleware entry in the phase stack
+// and increments the layer configuration generation.
+func (s *Layer) push(phase string, priority Priority, e *entry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.mutable()
+
+	s.phaseStack(phase).push(priority, e)
+	s.touch(phase)
+}
+
+// touch increments the layer configuration generation once the given phase
+// stack is mutated, flushing every memoized chain if it's the wildcard phase,
+// and rebuilding the chains right away if the build policy is EagerBuild.
+// The mutex must be held.
+func (s *Layer) touch(phase string) {
+	s.bump()
+	if phase == AllPhases {
+		for _, stack := range s.Pool {
+			if stack != nil {
+				stack.memo = nil
+			}
+		}
+	}
+	if s.buildPolicy == EagerBuild {
+		s.compile()
+	}
+}
+
+// phaseStack returns the stack of the given phase,
+// creating it if the phase has no stack yet.
+// The mutex must be held.
+func (s *Layer) phaseStack(phase string) *Stack {
+	stack := s.Pool[phase]
+	if stack != nil {
+		return stack
+	}
+	stack = s.newStack()
+	s.Pool[phase] = stack
+	for _, name := range s.order {
+		if name == phase {
+			return stack
+		}
+	}
+	s.order = append(s.order, phase)
+	return stack
+}
+
+// stack returns the stack used to run the given phase, falling back
+// to the wildcard phase stack if no middleware is registered for it.
+// The mutex must be held.
+func (s *Layer) stack(phase string) *Stack {
+	if stack := s.Pool[phase]; stack != nil {
+		return stack
+	}
+	return s.Pool[AllPhases]
 }
 
 // Run triggers the middleware call chain for the given phase.
-// In case of panic, it will be recovered transparently and trigger the error middleware chain.ç
+//
+// Once the request phase chain is completed, including when a middleware replied
+// without calling the next handler, the response phase chain is triggered with
+// a no-op final handler, allowing to log or fix up the response.
+// The response phase is not triggered if the request phase panics.
+//
+// In case of panic, it will be recovered transparently and trigger the error middleware chain,
+// exposing a *PanicError via ErrorOf and the "vinxi.error" context key.
+// Panics with http.ErrAbortHandler are not recovered, aborting the response
+// as the standard library expects.
+// Errors returned by error returning handlers trigger the error middleware chain too.
+//
+// The response writer is wrapped into a ResponseWriter, unless it already is one,
+// so middleware can inspect the written response.
+//
+// The middleware chain is snapshotted when Run is called, so concurrent
+// mutations of the layer only take effect in subsequent calls to Run.
 func (s *Layer) Run(phase string, w http.ResponseWriter, r *http.Request, h http.Handler) {
+	s.run(nil, phase, w, r, h)
+}
+
+// RunContext triggers the middleware call chain for the given phase like Run,
+// propagating the given context onto the request.
+//
+// The context is checked before calling every middleware handler and the final
+// handler: once it's cancelled or timed out, the remaining chain is skipped and
+// the error phase is triggered, exposing the context error via ErrorOf.
+// The error phase itself is never cancelled.
+//
+// Request-scoped values, such as the lifecycle state, are stored in the derived
+// request: use Attach beforehand to share them across calls to Run.
+func (s *Layer) RunContext(ctx context.Context, phase string, w http.ResponseWriter, r *http.Request, h http.Handler) {
+	s.run(ctx, phase, w, withContext(r, ctx), h)
+}
+
+// run triggers the middleware call chain for the given phase,
+// checking the given context between middleware handlers, if not nil.
+func (s *Layer) run(ctx context.Context, phase string, w http.ResponseWriter, r *http.Request, h http.Handler) {
+	start := time.Now()
+	w = NewResponseWriter(w)
+	if dataOf(r) == nil {
+		r = Attach(r)
+		// Released once the error phase, if any, is completed
+		defer releaseLegacy(r)
+	}
+
 	// In case of panic we want to handle it accordingly
+	var observers []Observer
 	defer func() {
-		if phase == "error" {
+		defer func() {
+			elapsed := time.Since(start)
+			s.recordRun(phase, elapsed)
+			s.logPhaseEnd(r, phase, elapsed)
+			for _, obs := range observers {
+				obs.OnPhaseEnd(r, phase, elapsed)
+			}
+		}()
+		if phase == ErrorPhase {
 			return
 		}
 		if re := recover(); re != nil {
-			s.runRecoverError(re, w, r)
+			s.recover(phase, re, w, r)
 		}
 	}()
 
+	phase = s.phase(phase)
+	if s.strictTransitions {
+		transition(r, PhaseState(phase))
+	}
+
+	s.logPhaseStart(r, phase)
+	snap, parent := s.snapshot(phase)
+	observers = snap.observers
+	for _, obs := range observers {
+		obs.OnPhaseStart(r, phase)
+	}
+	if phase == ResponsePhase {
+		snap.counters = nil // the response phase terminator is not counted as final handler
+	}
+	if phase != ErrorPhase {
+		snap.ctx, snap.finalTimeout = ctx, s.finalTimeout
+		if timeout := s.timeouts[phase]; timeout > 0 {
+			deadline, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			snap.base, snap.ctx = r.Context(), deadline
+		}
+	}
+	req := r
+	if snap.base != nil {
+		req = withContext(r, snap.ctx)
+	}
+
+	// Buffer the response and intercept server error responses, if enabled
+	cw, rw := w, w
+	var buffer *ResponseBuffer
+	var interceptor *statusInterceptor
+	if phase == RequestPhase && s.bufferResponses {
+		buffer = NewResponseBuffer()
+		cw = buffer
+		rw = newResponseWriter(buffer)
+	}
+	if phase == RequestPhase && s.statusErrors {
+		interceptor = &statusInterceptor{ResponseWriter: cw}
+		cw = interceptor
+	}
+	if cw != w {
+		cw = newResponseWriter(cw)
+	}
 	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		s.run(phase, w, r, h)
+		snap.run(w, r, h)
 	})
 
 	// Run parent layer for the given phase, if present
-	if phase != RequestPhase && s.parent != nil {
-		s.parent.Run(phase, w, r, next)
+	if phase != RequestPhase && parent != nil {
+		parent.Run(phase, w, req, next)
 		return
 	}
 
 	// Otherwise run the current layer
-	next.ServeHTTP(w, r)
+	next.ServeHTTP(cw, req)
+	if interceptor != nil {
+		if err := interceptor.err(); err != nil {
+			panic(returnedError{err})
+		}
+	}
+
+	// Run the response phase once the request phase is completed
+	if phase == RequestPhase && s.responds() {
+		s.Run(ResponsePhase, rw, req, responseFinalHandler)
+	}
+
+	// Flush the buffered response, once rewritten by the response phase
+	if buffer != nil {
+		buffer.writeTo(w)
+	}
 }
 
-// run runs the current layer middleware chain for the given phase.
-func (s *Layer) run(phase string, w http.ResponseWriter, r *http.Request, h http.Handler) {
-	// Use default final handler if no one is passed
-	if h == nil {
-		h = s.finalHandler
+// responseFinalHandler stores the no-op final handler used by the response phase.
+var responseFinalHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+// responds reports whether the response phase must be run,
+// which happens if it has middleware registered, a parent layer is present
+// or the inherited layer responds.
+func (s *Layer) responds() bool {
+	if !s.Frozen() {
+		s.mutex.RLock()
+		defer s.mutex.RUnlock()
+	}
+	if s.parent != nil || (s.Pool[ResponsePhase] != nil && s.Pool[ResponsePhase].Len() > 0) {
+		return true
 	}
+	return s.inherit != nil && s.inherit.responds()
+}
 
-	// Get registered middleware handlers for the current phase
-	stack, ok := s.Pool[phase]
-	if !ok {
-		h.ServeHTTP(w, r)
+// Handler returns an http.Handler running the middleware chain of the given phase,
+// using the given final handler as chain terminator, so it can be mounted
+// on any router or server expecting an http.Handler.
+// If final is nil, the layer final handler is used instead.
+//
+// The returned handler is bound to the layer, not to its current configuration,
+// so middleware registered afterwards is also used on subsequent requests.
+func (s *Layer) Handler(phase string, final http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Run(phase, w, r, final)
+	})
+}
+
+// Middlewares returns the ordered middleware functions of the given phase,
+// including the wildcard phase ones, as standard middleware constructors,
+// so the phase can be composed by any third-party composer or router.
+//
+// The returned middleware runs outside the layer: panics are not recovered,
+// the error phase is never triggered and the parent layers are not run.
+// Errors returned by error returning handlers are raised as panics.
+func (s *Layer) Middlewares(phase string) []func(http.Handler) http.Handler {
+	snap, _ := s.snapshot(s.phase(phase))
+	mws := make([]func(http.Handler) http.Handler, len(snap.queue))
+	for i, fn := range snap.queue {
+		mws[i] = fn
+	}
+	return mws
+}
+
+// ServeHTTP implements the http.Handler interface, running
+// the request phase middleware chain with the layer final handler.
+func (s *Layer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Run(RequestPhase, w, r, nil)
+}
+
+// recover handles the given value recovered while running the given phase,
+// triggering the error phase accordingly to the layer recovery configuration.
+func (s *Layer) recover(phase string, re interface{}, w http.ResponseWriter, r *http.Request) {
+	// Aborted handlers must reach the server, as net/http expects
+	if re == http.ErrAbortHandler {
+		panic(re)
+	}
+	if e, ok := re.(returnedError); ok {
+		*positionFor(r) = position{}
+		s.runRecoverError(e.err, w, r)
 		return
 	}
+	if s.noRecover || (s.panicFilter != nil && s.panicFilter(re)) {
+		panic(re)
+	}
 
-	// Build the middleware handlers call chain
-	queue := stack.Join()
-	for i := len(queue) - 1; i >= 0; i-- {
-		h = queue[i](h)
+	// Count the panic in the layer owning the panicking middleware, e.g: a child layer
+	info, owner := panicInfo(phase, re, r)
+	if owner == nil {
+		owner = s
 	}
+	owner.recordPanic(info)
+	s.logPanic(info)
+	if s.recoverFunc != nil && !s.recoverFunc(re, w, r) {
+		return
+	}
+	s.runRecoverError(panicError(info), w, r)
+}
+
+// snapshot returns a point-in-time copy of the middleware chain
+// registered for the given phase, including the inherited one, if any,
+// and the current parent layer.
+func (s *Layer) snapshot(phase string) (*chain, Middleware) {
+	snap, parent := s.ownSnapshot(phase)
+	if snap.inherit != nil {
+		inherited, _ := snap.inherit.snapshot(phase)
+		snap.queue = inherit(inherited.queue, snap.queue, snap.childFirst)
+	}
+	return snap, parent
+}
+
+// ownSnapshot returns a point-in-time copy of the middleware chain
+// registered in the layer for the given phase and the current parent layer.
+//
+// The configuration is read under a read lock, only upgrading
+// to the write lock if the memoized phase chain must be rebuilt.
+func (s *Layer) ownSnapshot(phase string) (*chain, Middleware) {
+	// Frozen configurations are never mutated, so no locking is required
+	if s.Frozen() {
+		return s.chain(phase, s.stack(phase)), s.parent
+	}
+
+	s.mutex.RLock()
+	stack := s.stack(phase)
+	if stack == nil || (stack.memo != nil && !s.noMemo) {
+		defer s.mutex.RUnlock()
+		return s.chain(phase, stack), s.parent
+	}
+	// Compose the chain without memoizing it, if disabled or left to Compile
+	if s.noMemo || s.buildPolicy == ExplicitBuild {
+		defer s.mutex.RUnlock()
+		snap := s.chain(phase, nil)
+		snap.queue = stack.compose(s.Pool[AllPhases])
+		return snap, s.parent
+	}
+	s.mutex.RUnlock()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stack = s.stack(phase)
+	if stack != nil && stack.memo == nil {
+		stack.join(s.Pool[AllPhases])
+		atomic.AddUint64(&s.counters.memoRebuilds, 1)
+	}
+	return s.chain(phase, stack), s.parent
+}
 
-	// Trigger the first middleware handler
-	h.ServeHTTP(w, r)
+// chain creates a new chain snapshot from the given phase stack.
+// The stack chain must be already memoized and the mutex held.
+func (s *Layer) chain(phase string, stack *Stack) *chain {
+	snap := &chain{layer: s, phase: phase, final: finalHandler(s.finalHandler), generation: s.generation}
+	if s.canary != nil {
+		snap.final = s.canary.handler(snap.final)
+	}
+	snap.inherit, snap.childFirst = s.inherit, s.childFirst
+	snap.observers = s.observers
+	snap.skipped = &s.skipped
+	snap.skipChain, snap.skipFinal = s.skipCommitted, !s.keepWrittenFinal
+	snap.counters = &s.counters
+	if stack != nil {
+		snap.queue = stack.memo
+	}
+	return snap
 }
 
 // runRecoverError runs the current layer error phase middleware chain
 // triggering the parent layer if necessary.
 func (s *Layer) runRecoverError(rerr interface{}, w http.ResponseWriter, r *http.Request) {
+	s.logErrorPhase(r, rerr)
+	snap, parent := s.snapshot(ErrorPhase)
+	snap.counters = nil // the error phase terminator is not counted as final handler
+	s.mutex.RLock()
+	final := finalErrorHandler(s.finalErrorHandler)
+	s.mutex.RUnlock()
+	if se, ok := rerr.(*StatusError); ok {
+		// Reply with the intercepted response by default
+		final = http.HandlerFunc(se.writeTo)
+	}
 	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// If no parent, run default error final handler
-		if s.parent == nil {
-			FinalErrorHandler.ServeHTTP(w, r)
+		if parent == nil {
+			final.ServeHTTP(w, r)
 			return
 		}
 		// If parent layer exists, trigger it
-		s.parent.Run("error", w, r, FinalErrorHandler)
+		parent.Run(ErrorPhase, w, r, final)
 	})
 
-	// Expose error via context. This may change in a future.
-	context.Set(r, "vinxi.error", rerr)
-	s.run("error", w, r, next)
+	// Discard the buffered response, if any, replaced by the error phase one
+	if buffer := BufferOf(w); buffer != nil {
+		buffer.reset()
+	}
+
+	// Expose error via the request-scoped storage
+	setValue(r, "vinxi.error", rerr)
+	atomic.AddUint64(&s.counters.errorPhase, 1)
+	if c, ok := getValue(r, "vinxi.canary").(*canary); ok {
+		setLocal(r, "vinxi.canary", nil) // record the canary error once per request
+		c.recordError()
+	}
+	if s.strictTransitions {
+		transition(r, StateError)
+	}
+	snap.run(w, r, next)
+}
+
+// chain represents a point-in-time snapshot of a layer phase middleware chain.
+type chain struct {
+	// layer stores the layer owning the chain.
+	layer *Layer
+	// phase stores the chain phase.
+	phase string
+	// queue stores the joined middleware functions.
+	queue []MiddlewareFunc
+	// final stores the layer final handler at snapshot time.
+	final http.Handler
+	// generation stores the layer configuration generation at snapshot time.
+	generation uint64
+	// inherit stores the layer inherited middleware layer, if any. See NewChild.
+	inherit *Layer
+	// childFirst defines if the layer middleware run before the inherited ones.
+	childFirst bool
+	// observers stores the layer observers at snapshot time.
+	observers []Observer
+	// skipped stores the layer skipped runs counter.
+	skipped *uint64
+	// skipChain defines if the chain is skipped when the response has been already committed.
+	skipChain bool
+	// skipFinal defines if the final handler is skipped when the response
+	// has been committed by the chain.
+	skipFinal bool
+	// counters stores the layer cumulative counters.
+	counters *counters
+	// ctx stores the context checked between middleware handlers, if any.
+	ctx context.Context
+	// base stores the request context before applying the phase timeout, if any,
+	// which is restored when calling the final handler.
+	base context.Context
+	// finalTimeout stores the final handler timeout, if any.
+	finalTimeout time.Duration
+}
+
+// run runs the middleware chain snapshot.
+func (c *chain) run(w http.ResponseWriter, r *http.Request, h http.Handler) {
+	// Use default final handler if no one is passed
+	defaultFinal := h == nil
+	if defaultFinal {
+		h = c.final
+	}
+
+	// Expose the configuration generation used to serve the request
+	setLocal(r, "vinxi.generation", c.generation)
+
+	// Apply the final handler deadline, if any
+	if c.base != nil || c.finalTimeout > 0 {
+		h = c.deadline(h)
+	}
+
+	// Skip the chain if the response has been already written, guarding the final handler too
+	if c.skipChain {
+		if committed(w) {
+			atomic.AddUint64(c.skipped, 1)
+			return
+		}
+		h = c.skipCommitted(h)
+	} else if c.skipFinal && !committed(w) {
+		// Skip the final handler once a middleware has written the response
+		h = c.skipCommitted(h)
+	}
+
+	// Enforce the phase deadline on the running middleware, if any
+	var tw *timeoutWriter
+	if c.base != nil {
+		tw = newTimeoutWriter(w)
+		h = passTimeout(tw, h)
+	}
+
+	// Trigger the middleware handlers call chain
+	d := newDispatcher(c.queue, h)
+	d.phase, d.position = c.phase, positionFor(r)
+	d.counters, d.defaultFinal = c.counters, defaultFinal
+	d.chain, d.ctx = c, c.ctx
+	if tw != nil {
+		c.enforce(d, tw, r)
+		return
+	}
+	d.ServeHTTP(w, r)
+}
+
+// skipCommitted wraps the given final handler to skip it if the response
+// has been already written by a previous middleware.
+func (c *chain) skipCommitted(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if committed(w) {
+			atomic.AddUint64(c.skipped, 1)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
 }
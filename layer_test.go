@@ -1,7 +1,10 @@
 package layer
 
 import (
+	stdcontext "context"
 	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 
 	"github.com/nbio/st"
@@ -118,6 +121,35 @@ func TestRegisterUnsupportedInterface(t *testing.T) {
 	mw.Use(RequestPhase, func() {})
 }
 
+func TestRegisterNilHandler(t *testing.T) {
+	defer func() {
+		err, ok := recover().(*HandlerError)
+		st.Expect(t, ok, true)
+		st.Expect(t, err.Err, ErrNilHandler)
+		st.Expect(t, err.Phase, RequestPhase)
+		st.Expect(t, err.Index, 1)
+		st.Expect(t, err.Error(), `vinxi: nil middleware handler (phase "request", argument 1)`)
+	}()
+
+	mw := New()
+
+	var fn func(http.Handler) http.Handler
+	mw.Use(RequestPhase, FinalHandler, fn)
+}
+
+func TestRegisterTypedNilHandler(t *testing.T) {
+	defer func() {
+		err, ok := recover().(*HandlerError)
+		st.Expect(t, ok, true)
+		st.Expect(t, err.Index, 0)
+	}()
+
+	mw := New()
+
+	var p *plugin
+	mw.Use(RequestPhase, p)
+}
+
 func TestUsePriority(t *testing.T) {
 	mw := New()
 
@@ -186,6 +218,31 @@ func TestFlush(t *testing.T) {
 	st.Expect(t, mw.Pool, Pool{})
 }
 
+func TestFlushPhase(t *testing.T) {
+	mw := New()
+	mw.Use("request", orderHandler("foo"))
+	mw.Use(AllPhases, orderHandler("all"))
+	mw.Use("error", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.WriteHeader(503)
+	})
+	st.Expect(t, runOrder(mw, "request"), []string{"all", "foo", "final"})
+
+	st.Expect(t, mw.FlushPhase("error"), 1)
+	st.Expect(t, mw.FlushPhase("error"), 0)
+	st.Expect(t, mw.Phases(), []string{"request", AllPhases})
+
+	// Memoized chains are invalidated when flushing the wildcard phase
+	st.Expect(t, mw.FlushPhase(AllPhases), 1)
+	st.Expect(t, runOrder(mw, "request"), []string{"foo", "final"})
+
+	mw.Use("request", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		panic("boom")
+	})
+	w := httptest.NewRecorder()
+	mw.Run("request", w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 500)
+}
+
 func TestParentLayer(t *testing.T) {
 	parent := New()
 	mw := New()
@@ -370,6 +427,277 @@ func TestParentLayerChildPanicHandler(t *testing.T) {
 	st.Expect(t, string(w.Body), "Proxy Error")
 }
 
+func TestGenerationSnapshot(t *testing.T) {
+	mw := New()
+
+	calls := 0
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		// Mutating the layer must not affect the in-flight request
+		mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+			calls++
+			h.ServeHTTP(w, r)
+		})
+		h.ServeHTTP(w, r)
+	})
+	gen := mw.Generation()
+
+	req := Attach(&http.Request{})
+	mw.Run("request", utils.NewWriterStub(), req, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	st.Expect(t, calls, 0)
+	st.Expect(t, GenerationOf(req), gen)
+	st.Expect(t, mw.Generation(), gen+1)
+
+	req = Attach(&http.Request{})
+	mw.Run("request", utils.NewWriterStub(), req, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	st.Expect(t, calls, 1)
+	st.Expect(t, GenerationOf(req), gen+1)
+}
+
+func TestChanges(t *testing.T) {
+	mw := New()
+	changes := mw.Changes()
+	st.Expect(t, mw.Changes(), changes)
+
+	select {
+	case <-changes:
+		t.Fatal("layer unexpectedly changed")
+	default:
+	}
+
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {})
+	<-changes
+	st.Expect(t, mw.Changes() != changes, true)
+}
+
+func TestFlushDuringRun(t *testing.T) {
+	mw := New()
+
+	calls := 0
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		mw.Flush()
+		h.ServeHTTP(w, r)
+	})
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		calls++
+		h.ServeHTTP(w, r)
+	})
+
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	})
+	mw.Run(RequestPhase, utils.NewWriterStub(), &http.Request{}, final)
+	st.Expect(t, calls, 2)
+	st.Expect(t, mw.Pool, Pool{})
+
+	mw.Run(RequestPhase, utils.NewWriterStub(), &http.Request{}, final)
+	st.Expect(t, calls, 3)
+}
+
+func TestRegisterPluginDuringRun(t *testing.T) {
+	mw := New()
+
+	calls := 0
+	p := newPlugin(func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		calls++
+		h.ServeHTTP(w, r)
+	})
+	mw.UsePriority(RequestPhase, Head, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		mw.Use(RequestPhase, p)
+		h.ServeHTTP(w, r)
+	})
+
+	mw.Run(RequestPhase, utils.NewWriterStub(), &http.Request{}, nil)
+	st.Expect(t, calls, 0)
+	st.Expect(t, mw.Pool[RequestPhase].Len(), 2)
+
+	mw.Run(RequestPhase, utils.NewWriterStub(), &http.Request{}, nil)
+	st.Expect(t, calls, 1)
+	st.Expect(t, mw.Pool[RequestPhase].Len(), 3)
+}
+
+func TestMutationDuringErrorPhase(t *testing.T) {
+	mw := New()
+
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+	mw.Use(ErrorPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		mw.Flush()
+		w.Header().Set("error", "handled")
+		h.ServeHTTP(w, r)
+	})
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 500)
+	st.Expect(t, w.Header().Get("error"), "handled")
+	st.Expect(t, mw.Pool, Pool{})
+}
+
+type committedWriter struct {
+	*utils.WriterStub
+}
+
+func (w *committedWriter) Write(b []byte) (int, error) {
+	if w.Code == 0 {
+		w.WriteHeader(200)
+	}
+	return w.WriterStub.Write(b)
+}
+
+func (w *committedWriter) Written() bool {
+	return w.Code != 0
+}
+
+func TestSkipCommitted(t *testing.T) {
+	mw := New(WithSkipCommitted(true))
+
+	calls := 0
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		calls++
+		h.ServeHTTP(w, r)
+	})
+
+	w := &committedWriter{utils.NewWriterStub()}
+	w.WriteHeader(200)
+	w.Write([]byte("hello world"))
+	mw.Run("request", w, &http.Request{}, nil)
+
+	st.Expect(t, calls, 0)
+	st.Expect(t, mw.SkippedRuns(), uint64(1))
+	st.Expect(t, string(w.Body), "hello world")
+}
+
+func TestSkipCommittedFinalHandler(t *testing.T) {
+	mw := New(WithSkipCommitted(true))
+
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Write([]byte("hello world"))
+		h.ServeHTTP(w, r)
+	})
+
+	w := &committedWriter{utils.NewWriterStub()}
+	mw.Run("request", w, &http.Request{}, nil)
+
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, mw.SkippedRuns(), uint64(1))
+	st.Expect(t, string(w.Body), "hello world")
+}
+
+func TestSkipCommittedDisabled(t *testing.T) {
+	mw := New()
+
+	w := &committedWriter{utils.NewWriterStub()}
+	w.Write([]byte("hello world"))
+	mw.Run("request", w, &http.Request{}, nil)
+
+	st.Expect(t, mw.SkippedRuns(), uint64(0))
+	st.Expect(t, string(w.Body), "hello worldBad Gateway")
+}
+
+func TestSkipWrittenFinal(t *testing.T) {
+	mw := New()
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.WriteHeader(401)
+		w.Write([]byte("unauthorized"))
+		h.ServeHTTP(w, r)
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run("request", w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 401)
+	st.Expect(t, w.Body.String(), "unauthorized")
+	st.Expect(t, mw.SkippedRuns(), uint64(1))
+}
+
+func TestSkipWrittenFinalDisabled(t *testing.T) {
+	mw := New(WithSkipWrittenFinal(false))
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Write([]byte("hello "))
+		h.ServeHTTP(w, r)
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run("request", w, &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("world"))
+	}))
+	st.Expect(t, w.Body.String(), "hello world")
+	st.Expect(t, mw.SkippedRuns(), uint64(0))
+}
+
+func TestAlternatingFinalHandlers(t *testing.T) {
+	parent := New()
+	parent.Use("foo", headerMiddleware("parent", "true"))
+
+	mw := New()
+	mw.SetParent(parent)
+	mw.Use("foo", headerMiddleware("child", "true"))
+
+	final := func(code int) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		})
+	}
+
+	for i, code := range []int{200, 201, 200, 0, 202} {
+		// Invalidate the memoized chain halfway
+		if i == 3 {
+			mw.Use("foo", headerMiddleware("late", "true"))
+		}
+
+		var h http.Handler
+		if code != 0 {
+			h = final(code)
+		}
+
+		w := utils.NewWriterStub()
+		mw.Run("foo", w, &http.Request{}, h)
+
+		if code == 0 {
+			code = 502
+		}
+		st.Expect(t, w.Code, code)
+		st.Expect(t, w.Header().Get("parent"), "true")
+		st.Expect(t, w.Header().Get("child"), "true")
+		st.Expect(t, w.Header().Get("late") == "true", i >= 3)
+	}
+	st.Expect(t, mw.Stats().MemoRebuilds, uint64(2))
+}
+
+func TestConcurrentUseAndRun(t *testing.T) {
+	mw := New()
+	fn := func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		h.ServeHTTP(w, r)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				mw.Use(RequestPhase, fn)
+				mw.UsePriority(ErrorPhase, Head, fn)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				mw.Run(RequestPhase, utils.NewWriterStub(), &http.Request{}, nil)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				mw.Flush()
+				mw.UseFinalHandler(FinalHandler)
+				mw.Generation()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 func BenchmarkLayerRun(b *testing.B) {
 	w := utils.NewWriterStub()
 	req := &http.Request{}
@@ -405,3 +733,209 @@ func BenchmarkStackLayers(b *testing.B) {
 		mw.Run(RequestPhase, w, req, http.HandlerFunc(nil))
 	}
 }
+
+func TestHandler(t *testing.T) {
+	mw := New()
+	mw.Use(RequestPhase, headerMiddleware("foo", "bar"))
+
+	h := mw.Handler(RequestPhase, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	}))
+
+	mux := http.NewServeMux()
+	mux.Handle("/", h)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Code, 204)
+	st.Expect(t, w.Header().Get("foo"), "bar")
+
+	// Middleware registered afterwards is also used
+	mw.Use(RequestPhase, headerMiddleware("baz", "qux"))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Header().Get("baz"), "qux")
+}
+
+func TestMiddlewares(t *testing.T) {
+	mw := New()
+	mw.Use(RequestPhase, orderMiddleware("normal"))
+	mw.UsePriority(RequestPhase, Head, orderMiddleware("head"))
+	mw.Use(AllPhases, orderMiddleware("all"))
+	st.Expect(t, len(mw.Middlewares("unknown")), 1)
+
+	mws := mw.Middlewares(RequestPhase)
+	st.Expect(t, len(mws), 3)
+
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Header()["Order"], []string{"head", "all", "normal"})
+}
+
+func TestServeHTTP(t *testing.T) {
+	mw := New()
+	mw.Use(RequestPhase, headerMiddleware("foo", "bar"))
+	mw.UseFinalHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	}))
+
+	var h http.Handler = mw
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Code, 204)
+	st.Expect(t, w.Header().Get("foo"), "bar")
+}
+
+func TestInstanceFinalHandlers(t *testing.T) {
+	panicking := func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	}
+	custom := New(
+		WithFinalHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(404)
+		})),
+		WithFinalErrorHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(503)
+		})),
+	)
+	other := New()
+	other.Use(RequestPhase, panicking)
+
+	w := utils.NewWriterStub()
+	custom.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 404)
+
+	custom.Use(RequestPhase, panicking)
+	w = utils.NewWriterStub()
+	custom.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 503)
+
+	// Other layers keep using the package level handlers
+	w = utils.NewWriterStub()
+	other.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 500)
+
+	other.SetFinalErrorHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(504)
+	}))
+	w = utils.NewWriterStub()
+	other.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 504)
+}
+
+func TestRunContext(t *testing.T) {
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	var calls int
+	var reqCtx stdcontext.Context
+
+	mw := New()
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		calls++
+		reqCtx = r.Context()
+		cancel()
+		h.ServeHTTP(w, r)
+	})
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		calls++
+		h.ServeHTTP(w, r)
+	})
+	mw.Use(ErrorPhase, func(w http.ResponseWriter, r *http.Request) {
+		st.Expect(t, ErrorOf(r), stdcontext.Canceled)
+		w.WriteHeader(504)
+	})
+
+	w := httptest.NewRecorder()
+	mw.RunContext(ctx, RequestPhase, w, httptest.NewRequest("GET", "/", nil), nil)
+	st.Expect(t, calls, 1)
+	st.Expect(t, reqCtx.Done(), ctx.Done())
+	st.Expect(t, w.Code, 504)
+	st.Expect(t, mw.Panics().Total, uint64(0))
+}
+
+func TestResponsePhase(t *testing.T) {
+	var order []string
+	mw := New()
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		order = append(order, "request")
+		h.ServeHTTP(w, r)
+	})
+	mw.Use(ResponsePhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		order = append(order, "response")
+		h.ServeHTTP(w, r)
+	})
+	mw.Use(ResponsePhase, func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "logger")
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run(RequestPhase, w, httptest.NewRequest("GET", "/", nil), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "final")
+		w.WriteHeader(204)
+	}))
+	st.Expect(t, order, []string{"request", "final", "response", "logger"})
+	st.Expect(t, w.Code, 204)
+	st.Expect(t, mw.Stats().CustomFinalHandler, uint64(1))
+}
+
+func TestResponsePhaseSkippedOnPanic(t *testing.T) {
+	mw := New()
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+	mw.Use(ResponsePhase, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("response phase must not be triggered")
+	})
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 500)
+}
+
+func TestWildcardPhase(t *testing.T) {
+	mw := New()
+	mw.Use(AllPhases, orderMiddleware("all"))
+	mw.UsePriority(AllPhases, Head, orderMiddleware("all-head"))
+	mw.Use(RequestPhase, orderMiddleware("request"))
+	mw.UsePriority(RequestPhase, Head, orderMiddleware("request-head"))
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Header()["Order"], []string{"all-head", "request-head", "all", "request"})
+
+	// Phases without middleware run the wildcard middleware too
+	w = utils.NewWriterStub()
+	mw.Run("custom", w, &http.Request{}, nil)
+	st.Expect(t, w.Header()["Order"], []string{"all-head", "all"})
+
+	// Memoized chains are flushed when wildcard middleware change
+	st.Expect(t, mw.Remove(AllPhases, "layer.orderMiddleware.func1"), 2)
+	w = utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Header()["Order"], []string{"request-head", "request"})
+}
+
+func TestUsePhases(t *testing.T) {
+	mw := New()
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+	generation := mw.Generation()
+	mw.UsePhases([]string{RequestPhase, ErrorPhase}, orderMiddleware("shared"))
+	st.Expect(t, mw.Generation() > generation, true)
+	st.Expect(t, mw.Pool[RequestPhase].Len(), 2)
+	st.Expect(t, mw.Pool[ErrorPhase].Len(), 1)
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Header()["Order"], []string{"shared"})
+
+	// Handlers are not registered in any phase on failure
+	defer func() {
+		st.Expect(t, recover().(*HandlerError).Err, ErrNilHandler)
+		st.Expect(t, mw.Pool[ErrorPhase].Len(), 1)
+	}()
+	mw.UsePhases([]string{ErrorPhase}, orderMiddleware("other"), nil)
+}
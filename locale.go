@@ -0,0 +1,108 @@
+package layer
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Catalog represents a localized error messages catalog.
+type Catalog interface {
+	// Message returns the error message for the given language tag and status code.
+	Message(lang string, code int) (string, bool)
+}
+
+// MapCatalog implements a Catalog backed by a map of language tags to
+// status code messages, e.g: MapCatalog{"es": {502: "Puerta de enlace incorrecta"}}.
+type MapCatalog map[string]map[int]string
+
+// Message returns the error message for the given language tag and status code.
+func (c MapCatalog) Message(lang string, code int) (string, bool) {
+	msg, ok := c[lang][code]
+	return msg, ok
+}
+
+// ErrorHandler returns an http.Handler replying with the given status code
+// and a message localized accordingly to the request Accept-Language header,
+// looked up in the given catalog.
+//
+// The status code and the X-Request-Id request header, echoed in the response,
+// are never localized so they remain machine-readable.
+// If no catalog message matches, the given default message is used.
+func ErrorHandler(code int, message string, catalog Catalog) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		msg, lang := message, ""
+		if catalog != nil {
+			for _, tag := range AcceptedLanguages(r.Header.Get("Accept-Language")) {
+				if m, ok := lookupMessage(catalog, tag, code); ok {
+					msg, lang = m, tag
+					break
+				}
+			}
+		}
+
+		if lang != "" {
+			w.Header().Set("Content-Language", lang)
+		}
+		if id := r.Header.Get("X-Request-Id"); id != "" {
+			w.Header().Set("X-Request-Id", id)
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(code)
+		w.Write([]byte(msg))
+	})
+}
+
+// lookupMessage looks up the catalog message for the given language tag,
+// falling back to its primary language subtag (e.g: "es-ES" to "es").
+func lookupMessage(catalog Catalog, tag string, code int) (string, bool) {
+	if msg, ok := catalog.Message(tag, code); ok {
+		return msg, true
+	}
+	if i := strings.Index(tag, "-"); i > 0 {
+		return catalog.Message(tag[:i], code)
+	}
+	return "", false
+}
+
+// AcceptedLanguages parses the given Accept-Language header value and returns
+// the accepted language tags sorted by preference, excluding the wildcard
+// and the languages explicitly rejected with a zero quality value.
+func AcceptedLanguages(header string) []string {
+	type language struct {
+		tag string
+		q   float64
+	}
+
+	var langs []language
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			langs = append(langs, language{tag: tag, q: q})
+		}
+	}
+
+	sort.SliceStable(langs, func(i, j int) bool {
+		return langs[i].q > langs[j].q
+	})
+
+	tags := make([]string, len(langs))
+	for i, lang := range langs {
+		tags[i] = lang.tag
+	}
+	return tags
+}
@@ -0,0 +1,47 @@
+package layer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func TestAcceptedLanguages(t *testing.T) {
+	st.Expect(t, AcceptedLanguages("en;q=0.5, es-ES, fr;q=0, *;q=0.1, de;q=0.8"), []string{"es-es", "de", "en"})
+	st.Expect(t, AcceptedLanguages(""), []string{})
+}
+
+func TestErrorHandler(t *testing.T) {
+	catalog := MapCatalog{"es": {502: "Puerta de enlace incorrecta"}}
+
+	mw := New()
+	mw.UseFinalHandler(ErrorHandler(502, "Bad Gateway", catalog))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Language", "fr, es-ES;q=0.9")
+	req.Header.Set("X-Request-Id", "123")
+	w := httptest.NewRecorder()
+	mw.Run(RequestPhase, w, req, nil)
+
+	st.Expect(t, w.Code, 502)
+	st.Expect(t, w.Header().Get("Content-Language"), "es-es")
+	st.Expect(t, w.Header().Get("X-Request-Id"), "123")
+	st.Expect(t, w.Body.String(), "Puerta de enlace incorrecta")
+}
+
+func TestErrorHandlerDefaultMessage(t *testing.T) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Language", "fr")
+	ErrorHandler(500, "Proxy Error", MapCatalog{}).ServeHTTP(w, req)
+
+	st.Expect(t, w.Code, 500)
+	st.Expect(t, w.Header().Get("Content-Language"), "")
+	st.Expect(t, w.Body.String(), "Proxy Error")
+
+	w = httptest.NewRecorder()
+	ErrorHandler(500, "Proxy Error", nil).ServeHTTP(w, &http.Request{Header: http.Header{}})
+	st.Expect(t, w.Body.String(), "Proxy Error")
+}
@@ -0,0 +1,74 @@
+package layer
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// WithLogger defines the structured logger used to report the chains
+// execution events, silent by default:
+//
+//   - phase runs start and end, at debug level.
+//   - middleware panics, at error level.
+//   - error phase activations, at warn level.
+//   - default final handler fallbacks, at warn level.
+//   - runs of phases not defined via DefinePhases, at warn level.
+//   - the configuration problems found by Compile, at warn level.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Layer) {
+		s.logger = logger
+	}
+}
+
+// log logs the given event, if a logger is defined.
+func (s *Layer) log(ctx context.Context, level slog.Level, msg string, args ...interface{}) {
+	if s.logger != nil {
+		s.logger.Log(ctx, level, msg, args...)
+	}
+}
+
+// logPhaseStart logs the start of the given phase run.
+func (s *Layer) logPhaseStart(r *http.Request, phase string) {
+	if s.logger == nil {
+		return
+	}
+	s.log(r.Context(), slog.LevelDebug, "vinxi: phase started", "phase", phase)
+
+	s.mutex.RLock()
+	defined := s.defined
+	s.mutex.RUnlock()
+	if defined != nil && !defined[phase] {
+		s.log(r.Context(), slog.LevelWarn, "vinxi: undefined phase run", "phase", phase)
+	}
+}
+
+// logPhaseEnd logs the end of the given phase run.
+func (s *Layer) logPhaseEnd(r *http.Request, phase string, elapsed time.Duration) {
+	s.log(r.Context(), slog.LevelDebug, "vinxi: phase finished", "phase", phase, "elapsed", elapsed)
+}
+
+// logPanic logs the given recovered middleware panic.
+func (s *Layer) logPanic(info *PanicInfo) {
+	s.log(info.Request.Context(), slog.LevelError, "vinxi: middleware panic",
+		"phase", info.Phase, "middleware", info.Middleware(), "panic", info.Value)
+}
+
+// logErrorPhase logs the activation of the error phase due to the given error.
+func (s *Layer) logErrorPhase(r *http.Request, err interface{}) {
+	s.log(r.Context(), slog.LevelWarn, "vinxi: error phase triggered", "error", err)
+}
+
+// logFinalFallback logs the usage of the default final handler in the given phase.
+func (s *Layer) logFinalFallback(r *http.Request, phase string) {
+	if s.logger == nil {
+		return
+	}
+	path := ""
+	if r.URL != nil {
+		path = r.URL.Path
+	}
+	s.log(r.Context(), slog.LevelWarn, "vinxi: default final handler used",
+		"phase", phase, "method", r.Method, "path", path)
+}
@@ -0,0 +1,53 @@
+package layer
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func newTestLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey || a.Key == "elapsed" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+}
+
+func TestWithLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	mw := New(WithLogger(newTestLogger(buf)))
+	mw.Run("request", httptest.NewRecorder(), httptest.NewRequest("GET", "/foo", nil), nil)
+	st.Expect(t, strings.Split(strings.TrimSpace(buf.String()), "\n"), []string{
+		`level=DEBUG msg="vinxi: phase started" phase=request`,
+		`level=WARN msg="vinxi: default final handler used" phase=request method=GET path=/foo`,
+		`level=DEBUG msg="vinxi: phase finished" phase=request`,
+	})
+
+	buf.Reset()
+	mw.DefinePhases("request")
+	mw.Use("foo", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		panic("boom")
+	})
+	mw.Run("foo", httptest.NewRecorder(), &http.Request{}, nil)
+	st.Expect(t, strings.Split(strings.TrimSpace(buf.String()), "\n"), []string{
+		`level=DEBUG msg="vinxi: phase started" phase=foo`,
+		`level=WARN msg="vinxi: undefined phase run" phase=foo`,
+		`level=ERROR msg="vinxi: middleware panic" phase=foo middleware=foo[0] panic=boom`,
+		`level=WARN msg="vinxi: error phase triggered" error="vinxi: panic in foo phase: boom"`,
+		`level=DEBUG msg="vinxi: phase finished" phase=foo`,
+	})
+
+	buf.Reset()
+	st.Expect(t, mw.Compile() != nil, true)
+	st.Expect(t, buf.String(), `level=WARN msg="vinxi: configuration problem" error="vinxi: unknown middleware phase: \"foo\""`+"\n")
+}
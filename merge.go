@@ -0,0 +1,68 @@
+package layer
+
+// Merge appends every phase middleware registered in the given layer into
+// the layer, respecting their priorities: handlers merged with the same
+// priority level run after the ones already registered, except the TopHead
+// and TopTail ones, which run before them, keeping their relative order.
+//
+// Merged handlers are copied, so subsequent changes in any of both layers,
+// such as Remove or Disable, don't affect the other one. The final handlers,
+// parent layer and loaded plugins of the given layer are not merged.
+func (s *Layer) Merge(other *Layer) {
+	other.mutex.RLock()
+	phases := other.phases()
+	stacks := make([][]*entry, len(phases))
+	for i, phase := range phases {
+		if stack := other.Pool[phase]; stack != nil {
+			stacks[i] = copyEntries(stack.items)
+		}
+	}
+	other.mutex.RUnlock()
+
+	for i := range phases {
+		phases[i] = s.phase(phases[i])
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.mutable()
+	s.merge(phases, stacks)
+}
+
+// merge appends the given entries into the given phase stacks, respecting their priorities.
+// The mutex must be held.
+func (s *Layer) merge(phases []string, stacks [][]*entry) {
+	for i, phase := range phases {
+		stack := s.phaseStack(phase)
+		entries := stacks[i]
+		// Register the top priority entries in reverse, so they keep their order
+		for j := len(entries) - 1; j >= 0; j-- {
+			if p := entries[j].priority; p == TopHead || p == TopTail {
+				stack.push(p, entries[j])
+			}
+		}
+		for _, e := range entries {
+			if e.priority != TopHead && e.priority != TopTail {
+				stack.push(e.priority, e)
+			}
+		}
+		s.touch(phase)
+	}
+}
+
+// copyEntries returns a copy of the given stack entries, without their counters.
+func copyEntries(entries []*entry) []*entry {
+	copies := make([]*entry, len(entries))
+	for i, e := range entries {
+		copies[i] = &entry{
+			name:     e.name,
+			handler:  e.handler,
+			fn:       e.fn,
+			priority: e.priority,
+			level:    e.level,
+			source:   e.source,
+			disabled: e.disabled,
+		}
+	}
+	return copies
+}
@@ -0,0 +1,31 @@
+package layer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func TestMerge(t *testing.T) {
+	bundle := New()
+	bundle.UsePriority("request", TopHead, orderHandler("bundle-top-1"), orderHandler("bundle-top-2"))
+	bundle.Use("request", orderHandler("bundle-normal"))
+	bundle.UsePriority("request", Tail, orderHandler("bundle-tail"))
+	bundle.UseNamed("foo", "bundle-response", orderHandler("bundle-response"))
+
+	mw := New()
+	mw.UsePriority("request", Head, orderHandler("app-head"))
+	mw.Use("request", orderHandler("app-normal"))
+	mw.Merge(bundle)
+
+	w := httptest.NewRecorder()
+	mw.Run("request", w, &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	st.Expect(t, w.Header()["X-Order"], []string{"bundle-top-1", "bundle-top-2", "app-head", "app-normal", "bundle-normal", "bundle-tail"})
+	st.Expect(t, mw.Phases(), []string{"request", "foo"})
+
+	// Merged handlers are decoupled from the merged layer
+	st.Expect(t, mw.Remove("foo", "bundle-response"), 1)
+	st.Expect(t, bundle.Pool["foo"].Len(), 1)
+}
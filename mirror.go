@@ -0,0 +1,182 @@
+package layer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+)
+
+const (
+	// DefaultMirrorMaxBodySize defines the default maximum request body size mirrored.
+	DefaultMirrorMaxBodySize = 1 << 20
+
+	// DefaultMirrorMaxConcurrency defines the default maximum number of in-flight mirrored requests.
+	DefaultMirrorMaxConcurrency = 100
+)
+
+// Mirror defines a secondary handler receiving a copy of the incoming requests,
+// such as another layer or a reverse proxy to a new backend version.
+type Mirror struct {
+	// Handler defines the handler serving the mirrored requests.
+	// Its responses are discarded.
+	Handler http.Handler
+	// MaxBodySize defines the maximum request body size buffered to be mirrored.
+	// Requests with larger bodies are not mirrored. Defaults to DefaultMirrorMaxBodySize.
+	MaxBodySize int64
+	// MaxConcurrency defines the maximum number of in-flight mirrored requests.
+	// Requests exceeding it are not mirrored. Defaults to DefaultMirrorMaxConcurrency.
+	MaxConcurrency int
+}
+
+// MirrorStats stores the counters of a request mirror.
+type MirrorStats struct {
+	// Requests stores the number of mirrored requests.
+	Requests uint64
+	// Errors stores the number of mirrored requests panicking or replied with a 5xx status.
+	Errors uint64
+	// Dropped stores the number of requests not mirrored due to the body size or concurrency limits.
+	Dropped uint64
+}
+
+// mirror stores the counters of a request mirror, accessed atomically.
+type mirror struct {
+	requests, errors, dropped uint64
+}
+
+// UseMirror registers a request mirror in the given phase, identified by name,
+// which asynchronously sends a copy of every request, including a buffered
+// copy of its body, to the given mirror handler while the request continues
+// the chain. Mirrored responses are discarded, but their errors are counted.
+// See MirrorStats.
+//
+// The request body is only buffered once a concurrency slot is acquired,
+// so requests dropped by the concurrency limit are never buffered.
+// Mirrored requests don't share the original request context,
+// so they're not canceled once the original request is served.
+// Registering the same name multiple times accumulates the counters.
+func (s *Layer) UseMirror(phase, name string, config Mirror) {
+	if isNil(config.Handler) {
+		panic(&HandlerError{Phase: phase, Err: ErrNilHandler})
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = DefaultMirrorMaxBodySize
+	}
+	if config.MaxConcurrency <= 0 {
+		config.MaxConcurrency = DefaultMirrorMaxConcurrency
+	}
+
+	s.statsMutex.Lock()
+	if s.mirrors == nil {
+		s.mirrors = make(map[string]*mirror)
+	}
+	counter, ok := s.mirrors[name]
+	if !ok {
+		counter = &mirror{}
+		s.mirrors[name] = counter
+	}
+	s.statsMutex.Unlock()
+
+	slots := make(chan struct{}, config.MaxConcurrency)
+	s.use(phase, Normal, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		// Acquire a slot first, so dropped requests are never buffered
+		select {
+		case slots <- struct{}{}:
+		default:
+			atomic.AddUint64(&counter.dropped, 1)
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		req, ok := mirrorRequest(r, config.MaxBodySize)
+		if !ok {
+			<-slots
+			atomic.AddUint64(&counter.dropped, 1)
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		atomic.AddUint64(&counter.requests, 1)
+		go func() {
+			defer func() { <-slots }()
+			counter.serve(config.Handler, req)
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// MirrorStats returns the counters of the request mirrors, by name.
+func (s *Layer) MirrorStats() map[string]MirrorStats {
+	s.statsMutex.Lock()
+	defer s.statsMutex.Unlock()
+
+	stats := make(map[string]MirrorStats, len(s.mirrors))
+	for name, counter := range s.mirrors {
+		stats[name] = MirrorStats{
+			Requests: atomic.LoadUint64(&counter.requests),
+			Errors:   atomic.LoadUint64(&counter.errors),
+			Dropped:  atomic.LoadUint64(&counter.dropped),
+		}
+	}
+	return stats
+}
+
+// mirrorRequest returns a copy of the given request buffering its body,
+// which is restored in the original request. It reports false if the
+// body exceeds the given size or can't be read.
+func mirrorRequest(r *http.Request, maxBodySize int64) (*http.Request, bool) {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = ioutil.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+		// Restore the original request body, including any unread data
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		if err != nil || int64(len(body)) > maxBodySize {
+			return nil, false
+		}
+	}
+
+	req := r.Clone(context.Background())
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	return req, true
+}
+
+// readCloser implements an io.ReadCloser reading from a reader and closing a closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// serve serves the given mirrored request, counting its errors.
+func (m *mirror) serve(h http.Handler, r *http.Request) {
+	w := &mirrorWriter{header: make(http.Header)}
+	defer func() {
+		if recover() != nil || w.code >= 500 {
+			atomic.AddUint64(&m.errors, 1)
+		}
+	}()
+	h.ServeHTTP(w, r)
+}
+
+// mirrorWriter implements a response writer discarding the response,
+// recording its status code.
+type mirrorWriter struct {
+	header http.Header
+	code   int
+}
+
+func (w *mirrorWriter) Header() http.Header { return w.header }
+
+func (w *mirrorWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *mirrorWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return len(b), nil
+}
@@ -0,0 +1,105 @@
+package layer
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+)
+
+func TestUseMirror(t *testing.T) {
+	bodies := make(chan string, 2)
+	mw := New()
+	mw.UseMirror("request", "v2", Mirror{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- string(body)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(502)
+		}
+		w.Write([]byte("discarded"))
+	})})
+
+	for _, path := range []string{"/", "/fail"} {
+		w := httptest.NewRecorder()
+		mw.Run("request", w, httptest.NewRequest("POST", path, strings.NewReader("hello")), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Write(body)
+		}))
+		st.Expect(t, w.Body.String(), "hello")
+	}
+
+	st.Expect(t, <-bodies, "hello")
+	st.Expect(t, <-bodies, "hello")
+	st.Expect(t, waitMirrorStats(mw, "v2", 1), MirrorStats{Requests: 2, Errors: 1})
+}
+
+func TestUseMirrorLimits(t *testing.T) {
+	mw := New()
+	mw.UseMirror("request", "v2", Mirror{
+		MaxBodySize: 3,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("mirror failure")
+		}),
+	})
+
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run("request", w, httptest.NewRequest("POST", "/", strings.NewReader("hello")), final)
+	st.Expect(t, w.Body.String(), "hello")
+
+	w = httptest.NewRecorder()
+	mw.Run("request", w, httptest.NewRequest("POST", "/", strings.NewReader("foo")), final)
+	st.Expect(t, w.Body.String(), "foo")
+
+	st.Expect(t, waitMirrorStats(mw, "v2", 1), MirrorStats{Requests: 1, Errors: 1, Dropped: 1})
+}
+
+func TestUseMirrorConcurrency(t *testing.T) {
+	release := make(chan struct{})
+	mw := New()
+	mw.UseMirror("request", "v2", Mirror{
+		MaxConcurrency: 1,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}),
+	})
+
+	mw.Run("request", httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader("foo")), nil)
+
+	// Dropped requests must not be buffered
+	body := &countingReader{Reader: strings.NewReader("bar")}
+	mw.Run("request", httptest.NewRecorder(), httptest.NewRequest("POST", "/", body), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st.Expect(t, body.reads, 0)
+	}))
+	close(release)
+
+	st.Expect(t, mw.MirrorStats()["v2"], MirrorStats{Requests: 1, Dropped: 1})
+}
+
+// countingReader counts the reads of the wrapped reader.
+type countingReader struct {
+	io.Reader
+	reads int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	r.reads++
+	return r.Reader.Read(p)
+}
+
+// waitMirrorStats waits until the given mirror counts the given errors.
+func waitMirrorStats(mw *Layer, name string, errors uint64) MirrorStats {
+	for i := 0; i < 100 && mw.MirrorStats()[name].Errors < errors; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return mw.MirrorStats()[name]
+}
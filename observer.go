@@ -0,0 +1,89 @@
+package layer
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// HandlerInfo describes an observed middleware handler.
+type HandlerInfo struct {
+	// Phase stores the phase running the handler.
+	Phase string
+	// Name stores the middleware name, if any.
+	Name string
+	// Priority stores the middleware registration priority.
+	Priority Priority
+}
+
+// Observer is implemented by the types watching the layer chains execution,
+// e.g: for metrics, tracing or debugging purposes. See Layer.AddObserver.
+//
+// Hooks are called synchronously from the request goroutine, so they must
+// be safe for concurrent use and return quickly.
+type Observer interface {
+	// OnPhaseStart is called when a phase run starts.
+	OnPhaseStart(r *http.Request, phase string)
+	// OnPhaseEnd is called when a phase run ends, including
+	// the error phase triggered by a panic, if any.
+	OnPhaseEnd(r *http.Request, phase string, elapsed time.Duration)
+	// OnHandlerStart is called before calling a middleware handler.
+	OnHandlerStart(r *http.Request, handler HandlerInfo)
+	// OnHandlerEnd is called once a middleware handler returns or panics.
+	// The elapsed time includes the rest of the chain called by the handler.
+	OnHandlerEnd(r *http.Request, handler HandlerInfo, elapsed time.Duration)
+}
+
+// ContextObserver is implemented by the observers deriving the request
+// context passed to the observed middleware handlers, e.g: to propagate
+// a tracing span per middleware handler.
+type ContextObserver interface {
+	Observer
+	// HandlerContext returns the request context passed to the given
+	// middleware handler, called right before OnHandlerStart.
+	// The derived request is passed to OnHandlerStart and OnHandlerEnd too,
+	// and Run attaches the request storage to the request, see Attach.
+	HandlerContext(r *http.Request, handler HandlerInfo) context.Context
+}
+
+// AddObserver registers a new observer watching the layer chains execution,
+// without wrapping every handler manually. Observers are called
+// in registration order and take effect in subsequent calls to Run.
+func (s *Layer) AddObserver(obs Observer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.mutable()
+
+	s.observers = append(s.observers[:len(s.observers):len(s.observers)], obs)
+	for _, stack := range s.Pool {
+		if stack != nil {
+			stack.observers = s.observers
+		}
+	}
+	s.touch(AllPhases)
+}
+
+// observe wraps the given middleware function notifying the given observers.
+// The running phase is taken from the request chain position.
+func (e *entry) observe(fn MiddlewareFunc, observers []Observer) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		h := fn(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			info := HandlerInfo{Phase: positionFor(r).phase, Name: e.name, Priority: e.priority}
+			for _, obs := range observers {
+				if co, ok := obs.(ContextObserver); ok {
+					r = withContext(r, co.HandlerContext(r, info))
+				}
+				obs.OnHandlerStart(r, info)
+			}
+			start := time.Now()
+			defer func() {
+				elapsed := time.Since(start)
+				for _, obs := range observers {
+					obs.OnHandlerEnd(r, info, elapsed)
+				}
+			}()
+			h.ServeHTTP(w, r)
+		})
+	}
+}
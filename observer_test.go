@@ -0,0 +1,101 @@
+package layer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+)
+
+type recordingObserver struct {
+	mutex  sync.Mutex
+	events []string
+}
+
+func (o *recordingObserver) record(format string, args ...interface{}) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.events = append(o.events, fmt.Sprintf(format, args...))
+}
+
+func (o *recordingObserver) OnPhaseStart(r *http.Request, phase string) {
+	o.record("start %s", phase)
+}
+
+func (o *recordingObserver) OnPhaseEnd(r *http.Request, phase string, elapsed time.Duration) {
+	o.record("end %s", phase)
+}
+
+func (o *recordingObserver) OnHandlerStart(r *http.Request, h HandlerInfo) {
+	o.record("start %s %s %s", h.Phase, h.Name, h.Priority)
+}
+
+func (o *recordingObserver) OnHandlerEnd(r *http.Request, h HandlerInfo, elapsed time.Duration) {
+	o.record("end %s %s", h.Phase, h.Name)
+}
+
+func observedHandler(w http.ResponseWriter, r *http.Request, h http.Handler) {
+	w.Header().Add("X-Order", "all")
+	h.ServeHTTP(w, r)
+}
+
+func TestAddObserver(t *testing.T) {
+	mw := New()
+	mw.UseNamed("request", "foo", orderHandler("foo"))
+	mw.UsePriority(AllPhases, Head, observedHandler)
+	st.Expect(t, runOrder(mw, "request"), []string{"all", "foo", "final"})
+
+	obs := &recordingObserver{}
+	mw.AddObserver(obs)
+	st.Expect(t, runOrder(mw, "request"), []string{"all", "foo", "final"})
+	st.Expect(t, obs.events, []string{
+		"start request",
+		"start request layer.observedHandler head",
+		"start request foo normal",
+		"end request foo",
+		"end request layer.observedHandler",
+		"end request",
+	})
+}
+
+func TestObserverPanic(t *testing.T) {
+	obs := &recordingObserver{}
+	mw := New()
+	mw.AddObserver(obs)
+	mw.UseNamed("foo", "panic", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run("foo", w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 500)
+	st.Expect(t, obs.events, []string{"start foo", "start foo panic normal", "end foo panic", "end foo"})
+}
+
+type contextObserver struct {
+	recordingObserver
+}
+
+type observerKey struct{}
+
+func (o *contextObserver) HandlerContext(r *http.Request, h HandlerInfo) context.Context {
+	return context.WithValue(r.Context(), observerKey{}, h.Name)
+}
+
+func TestContextObserver(t *testing.T) {
+	mw := New()
+	mw.AddObserver(&contextObserver{})
+	mw.UseNamed("request", "foo", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Header().Set("X-Observed", r.Context().Value(observerKey{}).(string))
+		h.ServeHTTP(w, r)
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run("request", w, &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	st.Expect(t, w.Header().Get("X-Observed"), "foo")
+}
@@ -0,0 +1,76 @@
+// Package otelobserver implements OpenTelemetry tracing for the layer chains,
+// starting a child span per middleware handler under the incoming request span.
+//
+// The tracing observer is attached to a layer as observer:
+//
+//	mw.AddObserver(otelobserver.New(nil))
+//
+// Spans are named after the middleware name, so middleware should be
+// registered with meaningful names, e.g: via UseNamed, and annotated with
+// the phase and priority attributes. Every span is propagated via the request
+// context to the handler, so the spans of the handlers called after it,
+// including the final handler ones, are nested under it.
+package otelobserver
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+const (
+	// TracerName defines the name of the tracer used if none is given.
+	TracerName = "gopkg.in/vinxi/layer.v0"
+
+	// DefaultSpanName defines the span name used for unnamed middleware.
+	DefaultSpanName = "middleware"
+)
+
+// Observer implements a layer.ContextObserver starting a span per middleware handler.
+type Observer struct {
+	// tracer stores the tracer used to start the spans.
+	tracer trace.Tracer
+}
+
+// New creates a new tracing observer using the given tracer,
+// or the global tracer provider one if nil.
+func New(tracer trace.Tracer) *Observer {
+	if tracer == nil {
+		tracer = otel.Tracer(TracerName)
+	}
+	return &Observer{tracer: tracer}
+}
+
+// HandlerContext implements the layer.ContextObserver interface,
+// starting a new span for the given middleware handler.
+func (o *Observer) HandlerContext(r *http.Request, handler layer.HandlerInfo) context.Context {
+	name := handler.Name
+	if name == "" {
+		name = DefaultSpanName
+	}
+	ctx, _ := o.tracer.Start(r.Context(), name, trace.WithAttributes(
+		attribute.String("vinxi.phase", handler.Phase),
+		attribute.String("vinxi.priority", handler.Priority.String()),
+	))
+	return ctx
+}
+
+// OnPhaseStart implements the layer.Observer interface.
+func (o *Observer) OnPhaseStart(r *http.Request, phase string) {}
+
+// OnPhaseEnd implements the layer.Observer interface.
+func (o *Observer) OnPhaseEnd(r *http.Request, phase string, elapsed time.Duration) {}
+
+// OnHandlerStart implements the layer.Observer interface.
+func (o *Observer) OnHandlerStart(r *http.Request, handler layer.HandlerInfo) {}
+
+// OnHandlerEnd implements the layer.Observer interface,
+// ending the middleware handler span.
+func (o *Observer) OnHandlerEnd(r *http.Request, handler layer.HandlerInfo, elapsed time.Duration) {
+	trace.SpanFromContext(r.Context()).End()
+}
@@ -0,0 +1,74 @@
+package otelobserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/nbio/st"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+type span struct {
+	trace.Span
+	name   string
+	parent *span
+	attrs  map[string]string
+	ended  bool
+}
+
+func (s *span) End(options ...trace.SpanEndOption) {
+	s.ended = true
+}
+
+type tracer struct {
+	embedded.Tracer
+	mutex sync.Mutex
+	spans []*span
+}
+
+func (t *tracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	s := &span{Span: trace.SpanFromContext(ctx), name: name, attrs: map[string]string{}}
+	s.parent, _ = s.Span.(*span)
+	config := trace.NewSpanStartConfig(opts...)
+	for _, attr := range config.Attributes() {
+		s.attrs[string(attr.Key)] = attr.Value.Emit()
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.spans = append(t.spans, s)
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+func passthrough(w http.ResponseWriter, r *http.Request, h http.Handler) {
+	h.ServeHTTP(w, r)
+}
+
+func TestObserver(t *testing.T) {
+	tr := &tracer{}
+	mw := layer.New()
+	mw.AddObserver(New(tr))
+	mw.UseNamed("request", "foo", passthrough)
+	mw.UsePriority("request", layer.Head, passthrough)
+
+	var final trace.Span
+	mw.Run("request", httptest.NewRecorder(), &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		final = trace.SpanFromContext(r.Context())
+	}))
+
+	st.Expect(t, len(tr.spans), 2)
+	head, foo := tr.spans[0], tr.spans[1]
+	st.Expect(t, head.name, "otelobserver.passthrough")
+	st.Expect(t, head.parent == nil, true)
+	st.Expect(t, head.attrs, map[string]string{"vinxi.phase": "request", "vinxi.priority": "head"})
+	st.Expect(t, foo.name, "foo")
+	st.Expect(t, foo.attrs, map[string]string{"vinxi.phase": "request", "vinxi.priority": "normal"})
+	st.Expect(t, foo.parent, head)
+	st.Expect(t, final, trace.Span(foo))
+	st.Expect(t, head.ended && foo.ended, true)
+}
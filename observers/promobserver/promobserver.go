@@ -0,0 +1,111 @@
+// Package promobserver implements a Prometheus metrics collector
+// for the layer chains, recording the phase runs, the error phase
+// activations and the phase and per-middleware latencies.
+//
+// The collector is attached to a layer as observer and registered
+// in a Prometheus registry:
+//
+//	collector := promobserver.New("gateway")
+//	prometheus.MustRegister(collector)
+//	mw.AddObserver(collector)
+//
+// Middleware latencies are labeled by phase and middleware name, so
+// middleware should be registered with meaningful names, e.g: via UseNamed.
+// Since every middleware calls the rest of the chain, the recorded
+// middleware latency includes the latency of the handlers called after it.
+package promobserver
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+// DefaultNamespace defines the metrics namespace used if none is given.
+const DefaultNamespace = "vinxi"
+
+// Collector implements a Prometheus collector recording the layer chains
+// metrics. It implements both the prometheus.Collector and the layer.Observer
+// interfaces, and can observe multiple layers at once.
+type Collector struct {
+	// runs stores the phase runs counter.
+	runs *prometheus.CounterVec
+	// errors stores the error phase activations counter.
+	errors *prometheus.CounterVec
+	// phases stores the phase latency histogram.
+	phases *prometheus.HistogramVec
+	// handlers stores the middleware latency histogram.
+	handlers *prometheus.HistogramVec
+}
+
+// New creates a new metrics collector using the given metrics namespace,
+// or DefaultNamespace if empty.
+func New(namespace string) *Collector {
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	return &Collector{
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "phase_runs_total",
+			Help:      "Number of middleware phase runs.",
+		}, []string{"phase"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "error_phase_total",
+			Help:      "Number of phase runs triggering the error phase.",
+		}, []string{"phase"}),
+		phases: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "phase_duration_seconds",
+			Help:      "Middleware phase run latency.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"phase"}),
+		handlers: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "middleware_duration_seconds",
+			Help:      "Middleware handler latency, including the handlers called after it.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"phase", "middleware"}),
+	}
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.runs.Describe(ch)
+	c.errors.Describe(ch)
+	c.phases.Describe(ch)
+	c.handlers.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.runs.Collect(ch)
+	c.errors.Collect(ch)
+	c.phases.Collect(ch)
+	c.handlers.Collect(ch)
+}
+
+// OnPhaseStart implements the layer.Observer interface.
+func (c *Collector) OnPhaseStart(r *http.Request, phase string) {}
+
+// OnPhaseEnd implements the layer.Observer interface,
+// recording the phase run and its latency.
+func (c *Collector) OnPhaseEnd(r *http.Request, phase string, elapsed time.Duration) {
+	c.runs.WithLabelValues(phase).Inc()
+	c.phases.WithLabelValues(phase).Observe(elapsed.Seconds())
+	if layer.ErrorOf(r) != nil {
+		c.errors.WithLabelValues(phase).Inc()
+	}
+}
+
+// OnHandlerStart implements the layer.Observer interface.
+func (c *Collector) OnHandlerStart(r *http.Request, handler layer.HandlerInfo) {}
+
+// OnHandlerEnd implements the layer.Observer interface,
+// recording the middleware handler latency.
+func (c *Collector) OnHandlerEnd(r *http.Request, handler layer.HandlerInfo, elapsed time.Duration) {
+	c.handlers.WithLabelValues(handler.Phase, handler.Name).Observe(elapsed.Seconds())
+}
@@ -0,0 +1,47 @@
+package promobserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+func passthrough(w http.ResponseWriter, r *http.Request, h http.Handler) {
+	h.ServeHTTP(w, r)
+}
+
+func TestCollector(t *testing.T) {
+	c := New("")
+	mw := layer.New()
+	mw.AddObserver(c)
+	mw.UseNamed("request", "foo", passthrough)
+	mw.UseNamed("request", "bar", passthrough)
+
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	mw.Run("request", httptest.NewRecorder(), &http.Request{}, final)
+	mw.Run("request", httptest.NewRecorder(), &http.Request{}, final)
+
+	st.Expect(t, testutil.ToFloat64(c.runs), float64(2))
+	st.Expect(t, testutil.CollectAndCount(c.errors), 0)
+	st.Expect(t, testutil.CollectAndCount(c.phases), 1)
+	st.Expect(t, testutil.CollectAndCount(c, "vinxi_middleware_duration_seconds"), 2)
+}
+
+func TestCollectorErrorPhase(t *testing.T) {
+	c := New("gateway")
+	mw := layer.New()
+	mw.AddObserver(c)
+	mw.UseNamed("request", "panic", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run("request", w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 500)
+	st.Expect(t, testutil.ToFloat64(c.errors), float64(1))
+	st.Expect(t, testutil.CollectAndCount(c, "gateway_middleware_duration_seconds"), 1)
+}
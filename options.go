@@ -0,0 +1,61 @@
+package layer
+
+import "net/http"
+
+// Option represents a functional option used to configure a Layer.
+type Option func(*Layer)
+
+// WithSkipCommitted enables or disables skipping the middleware chain
+// and the final handler when the response has already been committed.
+//
+// Committed responses are detected via response writers implementing
+// a Written() bool method, such as status-capturing writers.
+// Every skipped call is recorded and can be retrieved via Layer.SkippedRuns().
+func WithSkipCommitted(skip bool) Option {
+	return func(s *Layer) {
+		s.skipCommitted = skip
+	}
+}
+
+// WithSkipWrittenFinal enables or disables skipping the final handler when
+// a middleware of the chain has already written the response, preventing
+// superfluous WriteHeader calls and duplicated response bodies.
+// Enabled by default.
+//
+// Unlike WithSkipCommitted, responses committed before calling Run
+// don't skip the final handler. Every skipped call is recorded and can be
+// retrieved via Layer.SkippedRuns().
+func WithSkipWrittenFinal(skip bool) Option {
+	return func(s *Layer) {
+		s.keepWrittenFinal = !skip
+	}
+}
+
+// WithFinalHandler defines the layer final handler,
+// instead of the package level FinalHandler.
+func WithFinalHandler(h http.Handler) Option {
+	return func(s *Layer) {
+		s.finalHandler = h
+	}
+}
+
+// WithFinalErrorHandler defines the layer final error handler,
+// instead of the package level FinalErrorHandler.
+func WithFinalErrorHandler(h http.Handler) Option {
+	return func(s *Layer) {
+		s.finalErrorHandler = h
+	}
+}
+
+// WithMemoization enables or disables memoizing the phase middleware chains.
+// Enabled by default.
+//
+// Once disabled, every Run composes the chain from the current phase stack,
+// which avoids keeping stale chains around when stacks change frequently,
+// at the cost of composing the chain on every request.
+// Frozen layers always use the memoized chains, see Freeze.
+func WithMemoization(enabled bool) Option {
+	return func(s *Layer) {
+		s.noMemo = !enabled
+	}
+}
@@ -0,0 +1,193 @@
+package layer
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// PanicInfo describes a panic recovered by the layer.
+type PanicInfo struct {
+	// Phase stores the phase where the panic happened.
+	Phase string
+	// Index stores the position of the panicking middleware in the phase chain,
+	// or -1 if the panic happened in the final handler or in the layer itself.
+	Index int
+	// Value stores the recovered panic value.
+	Value interface{}
+	// Request stores the request being served when the panic happened.
+	Request *http.Request
+}
+
+// Middleware returns the middleware identifier used to count the panic,
+// in the form "phase[index]", or "phase[final]" if not caused by a middleware.
+func (p *PanicInfo) Middleware() string {
+	if p.Index < 0 {
+		return fmt.Sprintf("%s[final]", p.Phase)
+	}
+	return fmt.Sprintf("%s[%d]", p.Phase, p.Index)
+}
+
+// PanicError wraps a value recovered from a middleware panic,
+// exposed to the error phase via the "vinxi.error" context key.
+type PanicError struct {
+	// Phase stores the phase where the panic happened.
+	Phase string
+	// Value stores the recovered panic value.
+	Value interface{}
+	// Stack stores the goroutine stack trace captured when the panic was recovered.
+	Stack []byte
+}
+
+// Error returns the error message.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("vinxi: panic in %s phase: %v", e.Phase, e.Value)
+}
+
+// Unwrap returns the recovered value if it's an error, or nil otherwise.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// panicError wraps the given recovered panic into a *PanicError capturing
+// the current stack trace. Layer errors, such as *PhaseError or *TransitionError,
+// are returned as is.
+func panicError(info *PanicInfo) interface{} {
+	switch info.Value.(type) {
+	case *PhaseError, *TransitionError:
+		return info.Value
+	}
+	return &PanicError{Phase: info.Phase, Value: info.Value, Stack: debug.Stack()}
+}
+
+// RecoverFunc represents the function called with every panic recovered by the layer,
+// deciding how to handle it: it can reply directly and return false, return true
+// to trigger the error phase, or panic again to propagate it to the caller.
+type RecoverFunc func(recovered interface{}, w http.ResponseWriter, r *http.Request) bool
+
+// WithRecovery enables or disables the built-in panic recovery.
+// If disabled, panics propagate to the caller of Run, so they can be recovered
+// by an outer recovery middleware, while errors returned by middleware handlers
+// still trigger the error phase.
+func WithRecovery(enabled bool) Option {
+	return func(s *Layer) {
+		s.noRecover = !enabled
+	}
+}
+
+// WithRecoverFunc defines the function deciding how every recovered panic is handled.
+// Panics handled by the function are still counted and reported to panic hooks.
+func WithRecoverFunc(fn RecoverFunc) Option {
+	return func(s *Layer) {
+		s.recoverFunc = fn
+	}
+}
+
+// PanicFilter represents the predicate reporting whether a panic value
+// must be propagated to the caller of Run instead of being recovered.
+type PanicFilter func(recovered interface{}) bool
+
+// WithPanicFilter defines the predicate selecting the panic values bypassing
+// the error phase, which are propagated to the caller of Run instead.
+// This is useful to crash loudly on programming errors, such as runtime errors,
+// while recoverable faults still trigger the error phase.
+func WithPanicFilter(filter PanicFilter) Option {
+	return func(s *Layer) {
+		s.panicFilter = filter
+	}
+}
+
+// PanicHook represents the function called every time a panic is recovered.
+type PanicHook func(*PanicInfo)
+
+// PanicStats stores the recovered panic counters.
+type PanicStats struct {
+	// Total stores the total number of recovered panics.
+	Total uint64
+	// Phases stores the recovered panic counters per phase.
+	Phases map[string]uint64
+	// Middleware stores the recovered panic counters per middleware.
+	// See PanicInfo.Middleware for the key format.
+	Middleware map[string]uint64
+}
+
+// OnPanic registers a hook called synchronously every time a panic is recovered
+// by the layer, before the error phase is triggered.
+// This is designed to integrate alerting or paging systems.
+func (s *Layer) OnPanic(hook PanicHook) {
+	s.statsMutex.Lock()
+	defer s.statsMutex.Unlock()
+	s.panicHooks = append(s.panicHooks, hook)
+}
+
+// Panics returns a copy of the recovered panic counters.
+func (s *Layer) Panics() PanicStats {
+	s.statsMutex.Lock()
+	defer s.statsMutex.Unlock()
+
+	stats := PanicStats{
+		Total:      s.panics.Total,
+		Phases:     make(map[string]uint64, len(s.panics.Phases)),
+		Middleware: make(map[string]uint64, len(s.panics.Middleware)),
+	}
+	for k, v := range s.panics.Phases {
+		stats.Phases[k] = v
+	}
+	for k, v := range s.panics.Middleware {
+		stats.Middleware[k] = v
+	}
+	return stats
+}
+
+// recordPanic counts the given recovered panic and calls the registered panic hooks.
+func (s *Layer) recordPanic(info *PanicInfo) {
+	s.statsMutex.Lock()
+	if s.panics.Phases == nil {
+		s.panics.Phases = make(map[string]uint64)
+		s.panics.Middleware = make(map[string]uint64)
+	}
+	s.panics.Total++
+	s.panics.Phases[info.Phase]++
+	s.panics.Middleware[info.Middleware()]++
+	hooks := s.panicHooks
+	s.statsMutex.Unlock()
+
+	for _, hook := range hooks {
+		hook(info)
+	}
+}
+
+// position tracks the middleware chain position being executed for a given request,
+// allowing to find out which middleware was running when a panic happened.
+type position struct {
+	// layer stores the layer owning the chain, if known.
+	layer  *Layer
+	phase  string
+	index  int
+	active bool
+}
+
+// positionFor returns the request position tracker, stored in the request storage.
+// Requests with no storage attached get an untracked position.
+func positionFor(r *http.Request) *position {
+	if data := dataOf(r); data != nil {
+		return &data.position
+	}
+	return &position{}
+}
+
+// panicInfo builds the panic information for the given recovered value,
+// resetting the request position tracker. It also returns the layer owning
+// the panicking middleware chain, if known.
+func panicInfo(phase string, re interface{}, r *http.Request) (*PanicInfo, *Layer) {
+	info := &PanicInfo{Phase: phase, Index: -1, Value: re, Request: r}
+	pos := positionFor(r)
+	owner := pos.layer
+	if pos.active {
+		info.Phase = pos.phase
+		info.Index = pos.index
+	}
+	*pos = position{}
+	return info, owner
+}
@@ -0,0 +1,190 @@
+package layer
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/utils.v0"
+)
+
+func TestPanicCounters(t *testing.T) {
+	mw := New()
+
+	var info *PanicInfo
+	mw.OnPanic(func(p *PanicInfo) {
+		info = p
+	})
+
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		h.ServeHTTP(w, r)
+	})
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		h.ServeHTTP(w, r)
+		panic("oops")
+	})
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		h.ServeHTTP(w, r)
+	})
+
+	req := Attach(&http.Request{})
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, req, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	st.Expect(t, w.Code, 500)
+	st.Expect(t, info.Phase, RequestPhase)
+	st.Expect(t, info.Index, 1)
+	st.Expect(t, info.Value, "oops")
+	st.Expect(t, info.Request, req)
+	st.Expect(t, info.Middleware(), "request[1]")
+
+	mw.Run(RequestPhase, utils.NewWriterStub(), &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("final")
+	}))
+	st.Expect(t, info.Index, -1)
+	st.Expect(t, info.Middleware(), "request[final]")
+
+	stats := mw.Panics()
+	st.Expect(t, stats.Total, uint64(2))
+	st.Expect(t, stats.Phases, map[string]uint64{"request": 2})
+	st.Expect(t, stats.Middleware, map[string]uint64{"request[1]": 1, "request[final]": 1})
+}
+
+func TestPanicCountersParentLayer(t *testing.T) {
+	parent := New()
+	mw := New()
+	mw.SetParent(parent)
+
+	parent.Use("foo", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		h.ServeHTTP(w, r)
+	})
+	mw.Use("foo", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		h.ServeHTTP(w, r)
+	})
+	mw.Use("foo", func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+
+	mw.Run("foo", utils.NewWriterStub(), &http.Request{}, nil)
+	st.Expect(t, mw.Panics().Middleware, map[string]uint64{"foo[1]": 1})
+	st.Expect(t, parent.Panics().Total, uint64(0))
+
+	parent.Use("foo", func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+	mw.Run("foo", utils.NewWriterStub(), &http.Request{}, nil)
+	st.Expect(t, parent.Panics().Middleware, map[string]uint64{"foo[1]": 1})
+	st.Expect(t, mw.Panics().Total, uint64(1))
+}
+
+func TestPanicError(t *testing.T) {
+	errFoo := errors.New("foo")
+	var perr *PanicError
+
+	mw := New()
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request) {
+		panic(errFoo)
+	})
+	mw.Use(ErrorPhase, func(w http.ResponseWriter, r *http.Request) {
+		perr, _ = ErrorOf(r).(*PanicError)
+		w.WriteHeader(500)
+	})
+
+	mw.Run(RequestPhase, utils.NewWriterStub(), &http.Request{}, nil)
+	st.Expect(t, perr != nil, true)
+	st.Expect(t, perr.Phase, RequestPhase)
+	st.Expect(t, perr.Value, errFoo)
+	st.Expect(t, perr.Unwrap(), errFoo)
+	st.Expect(t, perr.Error(), "vinxi: panic in request phase: foo")
+	st.Expect(t, strings.Contains(string(perr.Stack), "panic_test.go"), true)
+}
+
+func TestPanicAbortHandler(t *testing.T) {
+	mw := New()
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+	mw.Use(ErrorPhase, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("error phase must not be triggered")
+	})
+
+	defer func() {
+		st.Expect(t, recover(), http.ErrAbortHandler)
+		st.Expect(t, mw.Panics().Total, uint64(0))
+	}()
+	mw.Run(RequestPhase, utils.NewWriterStub(), &http.Request{}, nil)
+}
+
+func TestWithRecoveryDisabled(t *testing.T) {
+	errFoo := errors.New("foo")
+	mw := New(WithRecovery(false))
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+
+	defer func() {
+		st.Expect(t, recover(), "oops")
+		st.Expect(t, mw.Panics().Total, uint64(0))
+
+		// Returned errors still trigger the error phase
+		mw := New(WithRecovery(false))
+		mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request) error {
+			return errFoo
+		})
+		w := utils.NewWriterStub()
+		mw.Run(RequestPhase, w, &http.Request{}, nil)
+		st.Expect(t, w.Code, 500)
+	}()
+	mw.Run(RequestPhase, utils.NewWriterStub(), &http.Request{}, nil)
+}
+
+func TestWithRecoverFunc(t *testing.T) {
+	mw := New(WithRecoverFunc(func(re interface{}, w http.ResponseWriter, r *http.Request) bool {
+		if re == "direct" {
+			w.WriteHeader(418)
+			return false
+		}
+		return true
+	}))
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request) {
+		panic(r.URL.Path)
+	})
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{URL: &url.URL{Path: "direct"}}, nil)
+	st.Expect(t, w.Code, 418)
+
+	w = utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{URL: &url.URL{Path: "error"}}, nil)
+	st.Expect(t, w.Code, 500)
+	st.Expect(t, mw.Panics().Total, uint64(2))
+}
+
+func TestWithPanicFilter(t *testing.T) {
+	mw := New(WithPanicFilter(func(re interface{}) bool {
+		_, ok := re.(runtime.Error)
+		return ok
+	}))
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL == nil {
+			panic("recoverable")
+		}
+		var m map[string]int
+		m["crash"]++
+	})
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 500)
+
+	defer func() {
+		_, ok := recover().(runtime.Error)
+		st.Expect(t, ok, true)
+		st.Expect(t, mw.Panics().Total, uint64(1))
+	}()
+	mw.Run(RequestPhase, utils.NewWriterStub(), &http.Request{URL: &url.URL{}}, nil)
+}
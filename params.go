@@ -0,0 +1,44 @@
+package layer
+
+import (
+	"context"
+	"net/http"
+)
+
+// Param represents a single route parameter, as a key/value pair.
+type Param struct {
+	// Key stores the parameter name.
+	Key string
+	// Value stores the parameter value.
+	Value string
+}
+
+// Params represents the ordered route parameters of a request,
+// as provided by routers such as httprouter.
+type Params []Param
+
+// ByName returns the value of the first parameter with the given name,
+// or an empty string if none.
+func (ps Params) ByName(name string) string {
+	for _, p := range ps {
+		if p.Key == name {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+// paramsKey represents the context.Context key used to store the route parameters.
+type paramsKey struct{}
+
+// WithParams returns a shallow copy of the given request
+// exposing the given route parameters via ParamsOf.
+func WithParams(r *http.Request, ps Params) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), paramsKey{}, ps))
+}
+
+// ParamsOf returns the route parameters exposed by the given request, if any.
+func ParamsOf(r *http.Request) Params {
+	ps, _ := r.Context().Value(paramsKey{}).(Params)
+	return ps
+}
@@ -0,0 +1,203 @@
+package layer
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// reserved stores the phase names reserved for built-in and internal layer features,
+// which cannot be registered as custom phases.
+var reserved = map[string]bool{
+	RequestPhase:       true,
+	ErrorPhase:         true,
+	ResponsePhase:      true,
+	AllPhases:          true,
+	ProxyDirectorPhase: true,
+	ProxyResponsePhase: true,
+	"post":             true,
+	"health":           true,
+}
+
+var (
+	// phasesMutex guards the known phases registry.
+	phasesMutex sync.RWMutex
+	// phases stores the known middleware phases registry.
+	phases = map[string]bool{
+		RequestPhase:       true,
+		ErrorPhase:         true,
+		ResponsePhase:      true,
+		AllPhases:          true,
+		ProxyDirectorPhase: true,
+		ProxyResponsePhase: true,
+	}
+)
+
+// RegisterPhase registers one or multiple custom middleware phases as known phases,
+// allowing them to be used by layers configured in strict phases mode.
+//
+// Returns a *PhaseError if any of the given phases collides with a reserved phase,
+// in which case none of the given phases are registered.
+func RegisterPhase(phase ...string) error {
+	for _, name := range phase {
+		if IsReservedPhase(name) {
+			return &PhaseError{Phase: name, Err: ErrReservedPhase}
+		}
+	}
+
+	phasesMutex.Lock()
+	defer phasesMutex.Unlock()
+	for _, name := range phase {
+		phases[name] = true
+	}
+	return nil
+}
+
+// IsReservedPhase reports whether the given phase name is reserved
+// for built-in or internal layer features, such as the request, error,
+// response, post or health phases.
+//
+// Phase names are matched case-sensitively, as everywhere else:
+// only layers configured via WithPhaseNormalization normalize them.
+func IsReservedPhase(phase string) bool {
+	return reserved[phase]
+}
+
+// IsKnownPhase reports whether the given phase is a built-in phase
+// or a custom phase registered via RegisterPhase.
+func IsKnownPhase(phase string) bool {
+	phasesMutex.RLock()
+	defer phasesMutex.RUnlock()
+	return phases[phase]
+}
+
+// WithPhaseNormalization enables phase names normalization, trimming
+// surrounding whitespace and optionally folding the phase name to lower case.
+func WithPhaseNormalization(foldCase bool) Option {
+	return func(s *Layer) {
+		s.normalize = true
+		s.foldCase = foldCase
+	}
+}
+
+// WithStrictPhases enables or disables strict phases mode, which rejects
+// phase names not known by IsKnownPhase after normalization.
+//
+// In strict mode, registering handlers for an unknown phase panics
+// with a *PhaseError, and running an unknown phase triggers the error phase
+// exposing the *PhaseError via the "vinxi.error" context key.
+func WithStrictPhases(strict bool) Option {
+	return func(s *Layer) {
+		s.strict = strict
+	}
+}
+
+// DefinePhases explicitly defines the set of valid phases for the layer,
+// replacing the known phases registry for it. The wildcard phase is always valid.
+//
+// Handlers registered for undefined phases are reported by Check,
+// while in strict phases mode using an undefined phase panics
+// with a *PhaseError, as with unknown phases.
+func (s *Layer) DefinePhases(phases ...string) {
+	defined := make(map[string]bool, len(phases))
+	for _, phase := range phases {
+		defined[s.normalizePhase(phase)] = true
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.mutable()
+	s.defined = defined
+	s.bump()
+}
+
+// definedPhases returns the explicitly defined valid phases, if any.
+func (s *Layer) definedPhases() map[string]bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.defined
+}
+
+// phase normalizes and validates the given phase name accordingly
+// to the layer configuration, panicking with a *PhaseError if the phase
+// is unknown in strict mode.
+func (s *Layer) phase(name string) string {
+	name = s.normalizePhase(name)
+	if s.strict && !s.isValidPhase(name) {
+		panic(&PhaseError{Phase: name, Err: ErrUnknownPhase})
+	}
+	return name
+}
+
+// normalizePhase normalizes the given phase name accordingly to the layer configuration.
+func (s *Layer) normalizePhase(name string) string {
+	if s.normalize {
+		name = strings.TrimSpace(name)
+		if s.foldCase {
+			name = strings.ToLower(name)
+		}
+	}
+	return name
+}
+
+// isValidPhase reports whether the given phase is defined for the layer,
+// or a known phase if the layer phases are not explicitly defined.
+func (s *Layer) isValidPhase(name string) bool {
+	s.mutex.RLock()
+	defined := s.defined
+	s.mutex.RUnlock()
+	if defined == nil {
+		return IsKnownPhase(name)
+	}
+	return name == AllPhases || defined[name]
+}
+
+// Phases returns the layer phases with a middleware stack in registration order,
+// followed by the phases whose stack was directly set in the Pool, sorted by name.
+func (s *Layer) Phases() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.phases()
+}
+
+// Range calls the given function for every layer phase and its middleware stack
+// in the order returned by Phases, until the function returns false.
+// The function is called without holding the layer lock, so it can safely
+// mutate the layer, but the given stacks must not be mutated.
+func (s *Layer) Range(fn func(phase string, stack *Stack) bool) {
+	s.mutex.RLock()
+	phases := s.phases()
+	stacks := make([]*Stack, len(phases))
+	for i, phase := range phases {
+		stacks[i] = s.Pool[phase]
+	}
+	s.mutex.RUnlock()
+
+	for i, phase := range phases {
+		if !fn(phase, stacks[i]) {
+			return
+		}
+	}
+}
+
+// phases returns the layer phases with a middleware stack in a stable order.
+// The mutex must be held.
+func (s *Layer) phases() []string {
+	phases := make([]string, 0, len(s.Pool))
+	seen := make(map[string]bool, len(s.Pool))
+	for _, phase := range s.order {
+		if _, ok := s.Pool[phase]; ok && !seen[phase] {
+			phases = append(phases, phase)
+			seen[phase] = true
+		}
+	}
+
+	n := len(phases)
+	for phase := range s.Pool {
+		if !seen[phase] {
+			phases = append(phases, phase)
+		}
+	}
+	sort.Strings(phases[n:])
+	return phases
+}
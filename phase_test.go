@@ -0,0 +1,145 @@
+package layer
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/utils.v0"
+)
+
+func TestIsKnownPhase(t *testing.T) {
+	st.Expect(t, IsKnownPhase(RequestPhase), true)
+	st.Expect(t, IsKnownPhase(ErrorPhase), true)
+	st.Expect(t, IsKnownPhase("known"), false)
+
+	st.Expect(t, RegisterPhase("known"), nil)
+	st.Expect(t, IsKnownPhase("known"), true)
+}
+
+func TestRegisterReservedPhase(t *testing.T) {
+	st.Expect(t, IsReservedPhase(ErrorPhase), true)
+	st.Expect(t, IsReservedPhase("health"), true)
+	st.Expect(t, IsReservedPhase(" Health"), false)
+	st.Expect(t, IsReservedPhase("custom"), false)
+
+	err, ok := RegisterPhase("custom", "response").(*PhaseError)
+	st.Expect(t, ok, true)
+	st.Expect(t, err.Err, ErrReservedPhase)
+	st.Expect(t, err.Phase, "response")
+	st.Expect(t, IsKnownPhase("custom"), false)
+}
+
+func TestFlushKeepsErrorTerminator(t *testing.T) {
+	mw := New()
+	mw.Use(ErrorPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		h.ServeHTTP(w, r)
+	})
+	mw.Flush()
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 500)
+	st.Expect(t, string(w.Body), "Proxy Error")
+}
+
+func TestPhaseNormalization(t *testing.T) {
+	mw := New(WithPhaseNormalization(true))
+
+	mw.Use(" Request ", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Header().Set("foo", "bar")
+		h.ServeHTTP(w, r)
+	})
+	st.Expect(t, mw.Pool[RequestPhase].Len(), 1)
+
+	w := utils.NewWriterStub()
+	mw.Run("REQUEST", w, &http.Request{}, nil)
+	st.Expect(t, w.Header().Get("foo"), "bar")
+}
+
+func TestPhaseNormalizationWithoutCaseFolding(t *testing.T) {
+	mw := New(WithPhaseNormalization(false))
+
+	mw.Use(" Request ", FinalHandler)
+	st.Expect(t, mw.Pool["Request"].Len(), 1)
+}
+
+func TestStrictPhasesUse(t *testing.T) {
+	defer func() {
+		err, ok := recover().(*PhaseError)
+		st.Expect(t, ok, true)
+		st.Expect(t, err.Err, ErrUnknownPhase)
+		st.Expect(t, err.Error(), `vinxi: unknown middleware phase: "requests"`)
+	}()
+
+	mw := New(WithStrictPhases(true))
+	mw.Use("requests", FinalHandler)
+}
+
+func TestStrictPhasesRun(t *testing.T) {
+	mw := New(WithStrictPhases(true))
+
+	w := utils.NewWriterStub()
+	req := Attach(&http.Request{})
+	mw.Run("requests", w, req, nil)
+
+	st.Expect(t, w.Code, 500)
+	err, ok := ErrorOf(req).(*PhaseError)
+	st.Expect(t, ok, true)
+	st.Expect(t, err.Phase, "requests")
+}
+
+func TestDefinePhases(t *testing.T) {
+	mw := New()
+	mw.DefinePhases(RequestPhase, ErrorPhase)
+	mw.Use("requests", FinalHandler)
+	mw.Use(RequestPhase, FinalHandler)
+	mw.Use(AllPhases, FinalHandler)
+
+	err, ok := mw.Check().(*CheckError)
+	st.Expect(t, ok, true)
+	st.Expect(t, len(err.Errors), 1)
+	st.Expect(t, err.Error(), `vinxi: unknown middleware phase: "requests"`)
+}
+
+func TestDefinePhasesStrict(t *testing.T) {
+	mw := New(WithStrictPhases(true), WithPhaseNormalization(true))
+	mw.DefinePhases("Custom ", RequestPhase)
+	mw.Use("custom", FinalHandler)
+	st.Expect(t, mw.Pool["custom"].Len(), 1)
+
+	defer func() {
+		err, ok := recover().(*PhaseError)
+		st.Expect(t, ok, true)
+		st.Expect(t, err.Err, ErrUnknownPhase)
+		st.Expect(t, err.Phase, ErrorPhase)
+	}()
+	mw.Use(ErrorPhase, FinalHandler)
+}
+
+func TestPhases(t *testing.T) {
+	mw := New()
+	mw.Use("post", FinalHandler)
+	mw.Use(RequestPhase, FinalHandler)
+	mw.Use("pre", FinalHandler)
+	mw.Use("post", FinalHandler)
+	mw.Pool["zeta"] = &Stack{}
+	mw.Pool["alpha"] = &Stack{}
+	st.Expect(t, mw.Phases(), []string{"post", RequestPhase, "pre", "alpha", "zeta"})
+
+	var phases []string
+	mw.Range(func(phase string, stack *Stack) bool {
+		phases = append(phases, phase)
+		st.Expect(t, stack, mw.Pool[phase])
+		return phase != "pre"
+	})
+	st.Expect(t, phases, []string{"post", RequestPhase, "pre"})
+
+	mw.Flush()
+	st.Expect(t, mw.Phases(), []string{})
+	mw.Use("pre", FinalHandler)
+	st.Expect(t, mw.Phases(), []string{"pre"})
+}
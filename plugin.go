@@ -0,0 +1,137 @@
+package layer
+
+import (
+	"errors"
+	"io"
+	goplugin "plugin"
+)
+
+// PluginSymbol defines the well-known symbol looked up by LoadPlugin,
+// which must implement the Registrable interface.
+const PluginSymbol = "Plugin"
+
+var (
+	// ErrInvalidPlugin is returned when the plugin symbol doesn't implement Registrable.
+	ErrInvalidPlugin = errors.New("vinxi: plugin symbol does not implement Registrable")
+
+	// ErrPluginLoaded is returned when loading an already loaded plugin.
+	ErrPluginLoaded = errors.New("vinxi: plugin already loaded")
+
+	// ErrUnknownPlugin is returned when unloading a plugin not loaded.
+	ErrUnknownPlugin = errors.New("vinxi: unknown plugin")
+)
+
+// loadedPlugin stores a plugin loaded in the layer.
+type loadedPlugin struct {
+	// symbol stores the plugin registrable symbol.
+	symbol Registrable
+	// handlers stores the handlers registered by the plugin.
+	handlers []pluginHandler
+}
+
+// pluginHandler stores a handler registered by a plugin.
+type pluginHandler struct {
+	phase string
+	// entry stores the registered stack entry, removed by reference.
+	entry *entry
+}
+
+// pluginRegistrar records the handlers registered by a plugin in the layer.
+type pluginRegistrar struct {
+	*Layer
+	plugin *loadedPlugin
+}
+
+// Use registers and records new handlers for the given phase.
+func (p *pluginRegistrar) Use(phase string, handler ...interface{}) {
+	p.UsePriority(phase, Normal, handler...)
+}
+
+// UsePriority registers and records new handlers for the given phase with a custom priority.
+func (p *pluginRegistrar) UsePriority(phase string, priority Priority, handler ...interface{}) {
+	for _, e := range p.Layer.use(phase, priority, handler...) {
+		p.plugin.handlers = append(p.plugin.handlers, pluginHandler{phase: p.phase(phase), entry: e})
+	}
+}
+
+// LoadPlugin opens the Go plugin at the given path, looks up its PluginSymbol
+// symbol, which must implement Registrable, and registers it into the layer:
+//
+//	// Plugin source, built via: go build -buildmode=plugin
+//	var Plugin = &MyPlugin{}
+//
+// Go plugins cannot be unloaded from the process, but the handlers registered
+// by a plugin are removed by UnloadPlugin, which also calls the plugin symbol
+// Close method if it implements io.Closer. Flush unloads every plugin too.
+func (s *Layer) LoadPlugin(path string) error {
+	p, err := goplugin.Open(path)
+	if err != nil {
+		return err
+	}
+	symbol, err := p.Lookup(PluginSymbol)
+	if err != nil {
+		return err
+	}
+	return s.usePlugin(path, symbol)
+}
+
+// usePlugin registers the given plugin symbol identified by the given path.
+func (s *Layer) usePlugin(path string, symbol interface{}) error {
+	// Exported plugin variables are looked up as pointers
+	if r, ok := symbol.(*Registrable); ok && r != nil {
+		symbol = *r
+	}
+	r, ok := symbol.(Registrable)
+	if !ok || isNil(r) {
+		return ErrInvalidPlugin
+	}
+
+	loaded := &loadedPlugin{symbol: r}
+	s.mutex.Lock()
+	if s.Frozen() {
+		s.mutex.Unlock()
+		panic(ErrFrozen)
+	}
+	if s.plugins[path] != nil {
+		s.mutex.Unlock()
+		return ErrPluginLoaded
+	}
+	if s.plugins == nil {
+		s.plugins = make(map[string]*loadedPlugin)
+	}
+	s.plugins[path] = loaded
+	s.mutex.Unlock()
+
+	r.Register(&pluginRegistrar{Layer: s, plugin: loaded})
+	return nil
+}
+
+// UnloadPlugin removes the handlers registered by the plugin loaded
+// from the given path, closing it if it implements io.Closer.
+// Returns ErrUnknownPlugin if no plugin was loaded from the path.
+func (s *Layer) UnloadPlugin(path string) error {
+	s.mutex.Lock()
+	if s.Frozen() {
+		s.mutex.Unlock()
+		panic(ErrFrozen)
+	}
+	loaded := s.plugins[path]
+	delete(s.plugins, path)
+	s.mutex.Unlock()
+	if loaded == nil {
+		return ErrUnknownPlugin
+	}
+
+	for _, h := range loaded.handlers {
+		s.removeEntry(h.phase, h.entry)
+	}
+	return loaded.close()
+}
+
+// close closes the plugin symbol, if it implements io.Closer.
+func (p *loadedPlugin) close() error {
+	if c, ok := p.symbol.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
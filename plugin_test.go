@@ -0,0 +1,77 @@
+package layer
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/utils.v0"
+)
+
+type testPlugin struct {
+	closed int
+}
+
+func (p *testPlugin) Register(mw Middleware) {
+	mw.Use("request", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Header().Set("foo", "bar")
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (p *testPlugin) Close() error {
+	p.closed++
+	return nil
+}
+
+func TestUsePlugin(t *testing.T) {
+	mw := New()
+	p := &testPlugin{}
+	st.Expect(t, mw.usePlugin("foo.so", p), nil)
+	st.Expect(t, mw.usePlugin("foo.so", p), ErrPluginLoaded)
+
+	w := utils.NewWriterStub()
+	mw.Run("request", w, &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	st.Expect(t, w.Header().Get("foo"), "bar")
+}
+
+func TestUsePluginPointer(t *testing.T) {
+	var symbol Registrable = &testPlugin{}
+	mw := New()
+	st.Expect(t, mw.usePlugin("foo.so", &symbol), nil)
+	st.Expect(t, mw.Pool["request"].Len(), 1)
+}
+
+func TestUsePluginInvalid(t *testing.T) {
+	mw := New()
+	st.Expect(t, mw.usePlugin("foo.so", "foo"), ErrInvalidPlugin)
+	st.Expect(t, mw.usePlugin("foo.so", (*testPlugin)(nil)), ErrInvalidPlugin)
+}
+
+func TestUnloadPlugin(t *testing.T) {
+	mw := New()
+	mw.Use("request", func(w http.ResponseWriter, r *http.Request) {})
+	p := &testPlugin{}
+	st.Expect(t, mw.usePlugin("foo.so", p), nil)
+	st.Expect(t, mw.Pool["request"].Len(), 2)
+
+	st.Expect(t, mw.UnloadPlugin("foo.so"), nil)
+	st.Expect(t, mw.Pool["request"].Len(), 1)
+	st.Expect(t, p.closed, 1)
+	st.Expect(t, mw.UnloadPlugin("foo.so"), ErrUnknownPlugin)
+}
+
+func TestFlushUnloadsPlugins(t *testing.T) {
+	mw := New()
+	p := &testPlugin{}
+	st.Expect(t, mw.usePlugin("foo.so", p), nil)
+	mw.Flush()
+	st.Expect(t, p.closed, 1)
+	st.Expect(t, mw.UnloadPlugin("foo.so"), ErrUnknownPlugin)
+	st.Expect(t, mw.usePlugin("foo.so", p), nil)
+}
+
+func TestLoadPluginMissing(t *testing.T) {
+	mw := New()
+	st.Reject(t, mw.LoadPlugin("missing.so"), nil)
+}
@@ -0,0 +1,37 @@
+package layer
+
+import (
+	"context"
+	"net/http"
+	"runtime/pprof"
+)
+
+// WithProfilerLabels enables or disables tagging the goroutine running
+// every middleware handler with the "vinxi.phase" and "vinxi.middleware"
+// profiler labels, so CPU profiles attribute the samples to specific
+// middleware instead of one opaque ServeHTTP frame, e.g:
+//
+//	go tool pprof -tagfocus vinxi.middleware=auth cpu.pprof
+//
+// The labels are propagated via the request context to the handler
+// and restored once it returns, so Run attaches the request storage
+// to the request, see Attach. Disabled by default.
+func WithProfilerLabels(enabled bool) Option {
+	return func(s *Layer) {
+		s.profilerLabels = enabled
+	}
+}
+
+// profile wraps the given middleware function tagging its execution with profiler labels.
+// The running phase is taken from the request chain position.
+func (e *entry) profile(fn MiddlewareFunc) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		h := fn(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			labels := pprof.Labels("vinxi.phase", positionFor(r).phase, "vinxi.middleware", e.name)
+			pprof.Do(r.Context(), labels, func(ctx context.Context) {
+				h.ServeHTTP(w, withContext(r, ctx))
+			})
+		})
+	}
+}
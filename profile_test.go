@@ -0,0 +1,38 @@
+package layer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func TestWithProfilerLabels(t *testing.T) {
+	labels := map[string]string{}
+	label := func(name string) func(http.ResponseWriter, *http.Request, http.Handler) {
+		return func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+			phase, _ := pprof.Label(r.Context(), "vinxi.phase")
+			middleware, _ := pprof.Label(r.Context(), "vinxi.middleware")
+			labels[name] = phase + " " + middleware
+			h.ServeHTTP(w, r)
+		}
+	}
+
+	mw := New(WithProfilerLabels(true))
+	mw.UseNamed("request", "foo", label("foo"))
+	mw.UseNamed(AllPhases, "bar", label("bar"))
+	mw.Run("request", httptest.NewRecorder(), &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Labels of the last middleware are kept in the final handler
+		middleware, _ := pprof.Label(r.Context(), "vinxi.middleware")
+		labels["final"] = middleware
+	}))
+	st.Expect(t, labels, map[string]string{"foo": "request foo", "bar": "request bar", "final": "foo"})
+
+	labels = map[string]string{}
+	mw = New()
+	mw.UseNamed("request", "foo", label("foo"))
+	mw.Run("request", httptest.NewRecorder(), &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	st.Expect(t, labels, map[string]string{"foo": " "})
+}
@@ -0,0 +1,122 @@
+package layer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+)
+
+const (
+	// ProxyDirectorPhase defines the middleware phase used to modify
+	// the upstream request of a reverse proxy wired via Proxy.
+	ProxyDirectorPhase = "proxy:director"
+	// ProxyResponsePhase defines the middleware phase used to modify
+	// the upstream response of a reverse proxy wired via Proxy.
+	ProxyResponsePhase = "proxy:response"
+)
+
+// proxyResponseKey represents the context.Context key used to store the upstream response.
+type proxyResponseKey struct{}
+
+// ProxyResponseOf returns the upstream response modified
+// by the proxy response phase for the given request, if any.
+func ProxyResponseOf(r *http.Request) *http.Response {
+	resp, _ := r.Context().Value(proxyResponseKey{}).(*http.Response)
+	return resp
+}
+
+// Proxy wires the layer proxy phases into the given reverse proxy,
+// returning it, so middleware can modify the upstream request and response
+// using the same API as the inbound phases:
+//
+//	mw.Use(layer.ProxyDirectorPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+//	  r.Header.Set("X-Forwarded-By", "vinxi")
+//	  h.ServeHTTP(w, r)
+//	})
+//	http.Handle("/", mw.Proxy(httputil.NewSingleHostReverseProxy(target)))
+//
+// The proxy director phase runs after the proxy Director with the upstream
+// request. Its middleware cannot reply: any written response is discarded.
+//
+// The proxy response phase runs before the proxy ModifyResponse, if any, with
+// a response writer backed by the upstream response, which is also available
+// via ProxyResponseOf: headers, status and body written by its middleware,
+// including the error phase ones, replace the upstream response ones.
+func (s *Layer) Proxy(proxy *httputil.ReverseProxy) *httputil.ReverseProxy {
+	if director := proxy.Director; director != nil {
+		proxy.Director = func(r *http.Request) {
+			director(r)
+			s.Run(ProxyDirectorPhase, discardWriter{header: make(http.Header)}, r, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				// Keep the request replaced by the middleware, if any
+				if req != r {
+					*r = *req
+				}
+			}))
+		}
+	}
+
+	modifyResponse := proxy.ModifyResponse
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		w := &proxyResponseWriter{resp: resp}
+		req := resp.Request.WithContext(context.WithValue(resp.Request.Context(), proxyResponseKey{}, resp))
+		s.Run(ProxyResponsePhase, w, req, responseFinalHandler)
+		w.flush()
+		if modifyResponse != nil {
+			return modifyResponse(resp)
+		}
+		return nil
+	}
+	return proxy
+}
+
+// discardWriter implements a response writer discarding any written response.
+type discardWriter struct {
+	header http.Header
+}
+
+func (w discardWriter) Header() http.Header         { return w.header }
+func (w discardWriter) WriteHeader(int)             {}
+func (w discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+
+// proxyResponseWriter implements a response writer backed by an upstream response.
+type proxyResponseWriter struct {
+	resp *http.Response
+	body *bytes.Buffer
+}
+
+// Header returns the upstream response headers.
+func (w *proxyResponseWriter) Header() http.Header {
+	return w.resp.Header
+}
+
+// WriteHeader replaces the upstream response status.
+func (w *proxyResponseWriter) WriteHeader(code int) {
+	w.resp.StatusCode = code
+	w.resp.Status = fmt.Sprintf("%d %s", code, http.StatusText(code))
+}
+
+// Write writes the given data into the body replacing the upstream response one.
+func (w *proxyResponseWriter) Write(b []byte) (int, error) {
+	if w.body == nil {
+		w.body = &bytes.Buffer{}
+	}
+	return w.body.Write(b)
+}
+
+// flush replaces the upstream response body, if written.
+func (w *proxyResponseWriter) flush() {
+	if w.body == nil {
+		return
+	}
+	if w.resp.Body != nil {
+		w.resp.Body.Close()
+	}
+	w.resp.Body = ioutil.NopCloser(w.body)
+	w.resp.ContentLength = int64(w.body.Len())
+	w.resp.TransferEncoding = nil
+	w.resp.Header.Set("Content-Length", strconv.Itoa(w.body.Len()))
+}
@@ -0,0 +1,73 @@
+package layer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func newUpstream() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Upstream", r.Header.Get("Director")+r.URL.Path)
+		w.WriteHeader(201)
+		w.Write([]byte("upstream"))
+	}))
+}
+
+func newProxy(mw *Layer, upstream *httptest.Server) *httptest.Server {
+	target, _ := url.Parse(upstream.URL)
+	return httptest.NewServer(mw.Proxy(httputil.NewSingleHostReverseProxy(target)))
+}
+
+func TestProxy(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+
+	mw := New(WithStrictPhases(true))
+	mw.Use(ProxyDirectorPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		r.Header.Set("Director", "vinxi")
+		h.ServeHTTP(w, r)
+	})
+	mw.Use(ProxyResponsePhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		st.Expect(t, ProxyResponseOf(r).StatusCode, 201)
+		w.Header().Set("Proxied", "true")
+		h.ServeHTTP(w, r)
+	})
+	proxy := newProxy(mw, upstream)
+	defer proxy.Close()
+
+	res, err := http.Get(proxy.URL + "/foo")
+	st.Expect(t, err, nil)
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	st.Expect(t, res.StatusCode, 201)
+	st.Expect(t, res.Header.Get("Upstream"), "vinxi/foo")
+	st.Expect(t, res.Header.Get("Proxied"), "true")
+	st.Expect(t, string(body), "upstream")
+}
+
+func TestProxyResponseRewrite(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+
+	mw := New()
+	mw.Use(ProxyResponsePhase, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		w.Write([]byte("rewritten"))
+	})
+	proxy := newProxy(mw, upstream)
+	defer proxy.Close()
+
+	res, err := http.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	st.Expect(t, res.StatusCode, 200)
+	st.Expect(t, res.ContentLength, int64(9))
+	st.Expect(t, string(body), "rewritten")
+}
@@ -0,0 +1,286 @@
+package layer
+
+import (
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// Remove deregisters the middleware handlers registered in the given phase
+// matching the given middleware, returning the number of removed handlers.
+//
+// The middleware can be either a string, matched against the handler name,
+// or the same handler value used on registration, matched by reference.
+// Declared functions are matched by their code pointer, while closures,
+// such as the ones returned by middleware constructors, are never matched
+// by reference, since every closure created by the same function literal
+// shares it: register them via UseNamed and remove them by name instead.
+//
+// Removal takes effect in subsequent calls to Run.
+func (s *Layer) Remove(phase string, middleware interface{}) int {
+	phase = s.phase(phase)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.mutable()
+
+	stack := s.Pool[phase]
+	if stack == nil {
+		return 0
+	}
+
+	match := func(e *entry) bool { return sameHandler(e.handler, middleware) }
+	if name, ok := middleware.(string); ok {
+		match = func(e *entry) bool { return e.name == name }
+	}
+
+	removed := stack.remove(match)
+	if removed > 0 {
+		s.touch(phase)
+	}
+	return removed
+}
+
+// removeEntry deregisters the given stack entry registered in the given phase.
+func (s *Layer) removeEntry(phase string, e *entry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.mutable()
+
+	if stack := s.Pool[phase]; stack != nil && stack.remove(func(x *entry) bool { return x == e }) > 0 {
+		s.touch(phase)
+	}
+}
+
+// Disable disables the middleware handlers registered in any phase
+// with the given name without removing them, returning the number
+// of matching handlers. Disabled handlers are skipped until enabled
+// again via Enable.
+//
+// Disabling takes effect in subsequent calls to Run.
+func (s *Layer) Disable(name string) int {
+	return s.setDisabled(name, true)
+}
+
+// Enable enables the middleware handlers registered in any phase
+// with the given name previously disabled via Disable, returning
+// the number of matching handlers.
+//
+// Enabling takes effect in subsequent calls to Run.
+func (s *Layer) Enable(name string) int {
+	return s.setDisabled(name, false)
+}
+
+// setDisabled disables or enables the middleware handlers with the given name.
+func (s *Layer) setDisabled(name string, disabled bool) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.mutable()
+
+	matched, toggled := 0, false
+	for _, stack := range s.Pool {
+		if stack == nil {
+			continue
+		}
+		for _, e := range stack.items {
+			if e.name != name {
+				continue
+			}
+			matched++
+			toggled = toggled || e.disabled != disabled
+			e.disabled = disabled
+		}
+	}
+
+	// Flush every memoized chain, since wildcard handlers are merged in every phase
+	if toggled {
+		s.touch(AllPhases)
+	}
+	return matched
+}
+
+// Replace replaces the middleware handler registered in the given phase
+// with the given name by the given handler, preserving its position and priority.
+// The replaced handler keeps the same name.
+//
+// It returns a *NameError wrapping ErrUnknownMiddleware if no handler
+// is registered with the given name, and panics with a *HandlerError
+// if the given handler is nil.
+// Replacement takes effect in subsequent calls to Run.
+func (s *Layer) Replace(phase, name string, handler interface{}) error {
+	phase = s.phase(phase)
+	if isNil(handler) {
+		panic(&HandlerError{Phase: phase, Index: 0, Err: ErrNilHandler})
+	}
+	mw := AdaptFunc(handler)
+	if mw == nil {
+		panic("vinxi: unsupported middleware interface")
+	}
+
+	e := newEntry(handler, mw)
+	e.name = name
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.mutable()
+
+	stack := s.Pool[phase]
+	if stack == nil || !stack.replace(name, e) {
+		return &NameError{Phase: phase, Name: name, Err: ErrUnknownMiddleware}
+	}
+	s.touch(phase)
+	return nil
+}
+
+// UseBefore registers new handlers for the given phase right before
+// the middleware handler registered with the given name, inheriting its priority.
+//
+// It returns a *NameError wrapping ErrUnknownMiddleware if no handler
+// is registered with the given name, in which case no handler is registered.
+func (s *Layer) UseBefore(phase, name string, handler ...interface{}) error {
+	return s.useAt(phase, name, false, handler...)
+}
+
+// UseAfter registers new handlers for the given phase right after
+// the middleware handler registered with the given name, inheriting its priority.
+//
+// It returns a *NameError wrapping ErrUnknownMiddleware if no handler
+// is registered with the given name, in which case no handler is registered.
+func (s *Layer) UseAfter(phase, name string, handler ...interface{}) error {
+	return s.useAt(phase, name, true, handler...)
+}
+
+// MoveBefore moves the named middleware handler registered in the given phase
+// right before the target middleware handler, taking its priority.
+//
+// It returns a *NameError wrapping ErrUnknownMiddleware if any of the
+// handlers is not registered in the phase.
+func (s *Layer) MoveBefore(phase, name, target string) error {
+	return s.move(phase, name, target, false)
+}
+
+// MoveAfter moves the named middleware handler registered in the given phase
+// right after the target middleware handler, taking its priority.
+//
+// It returns a *NameError wrapping ErrUnknownMiddleware if any of the
+// handlers is not registered in the phase.
+func (s *Layer) MoveAfter(phase, name, target string) error {
+	return s.move(phase, name, target, true)
+}
+
+// move moves the named middleware handler before or after the target one.
+func (s *Layer) move(phase, name, target string, after bool) error {
+	phase = s.phase(phase)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.mutable()
+
+	stack := s.Pool[phase]
+	for _, n := range []string{name, target} {
+		if stack == nil || stack.find(n) == nil {
+			return &NameError{Phase: phase, Name: n, Err: ErrUnknownMiddleware}
+		}
+	}
+	if name == target {
+		return nil
+	}
+
+	e := stack.find(name)
+	stack.remove(func(x *entry) bool { return x == e })
+	stack.insert(target, after, e)
+	s.touch(phase)
+	return nil
+}
+
+// useAt registers the given handlers before or after the named middleware handler.
+// Registrable handlers are not supported.
+func (s *Layer) useAt(phase, name string, after bool, handler ...interface{}) error {
+	phase = s.phase(phase)
+
+	entries := make([]*entry, len(handler))
+	for i, h := range handler {
+		if isNil(h) {
+			panic(&HandlerError{Phase: phase, Index: i, Err: ErrNilHandler})
+		}
+		mw := AdaptFunc(h)
+		if mw == nil {
+			panic("vinxi: unsupported middleware interface")
+		}
+		entries[i] = newEntry(h, mw)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.mutable()
+
+	stack := s.Pool[phase]
+	if stack == nil || !stack.insert(name, after, entries...) {
+		return &NameError{Phase: phase, Name: name, Err: ErrUnknownMiddleware}
+	}
+	s.touch(phase)
+	return nil
+}
+
+// newEntry creates a new stack entry for the given registered handler
+// and its adapted middleware function.
+func newEntry(handler interface{}, fn MiddlewareFunc) *entry {
+	return &entry{name: handlerName(handler), handler: handler, fn: fn, source: callerSource()}
+}
+
+// handlerName infers a human friendly name for the given handler.
+// Functions are named after their declaration, e.g: "layer.Logger",
+// while any other value is named after its type, e.g: "*layer.CORS".
+func handlerName(handler interface{}) string {
+	v := reflect.ValueOf(handler)
+	if v.Kind() != reflect.Func {
+		return v.Type().String()
+	}
+	fn := runtime.FuncForPC(v.Pointer())
+	if fn == nil {
+		return v.Type().String()
+	}
+	name := fn.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, "."); i >= 0 {
+		// Strip the escaped import path suffix, e.g: gopkg.in/vinxi/layer.v0,
+		// escaped twice in closure names
+		if j := strings.Index(name[:i], "%"); j >= 0 {
+			name = name[:j] + name[i:]
+		}
+	}
+	return name
+}
+
+// sameHandler reports whether both handlers are the same by reference.
+// Closures are never considered the same, see isClosure.
+func sameHandler(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Type() != vb.Type() {
+		return false
+	}
+	if va.Kind() == reflect.Func {
+		return va.Pointer() == vb.Pointer() && !isClosure(va)
+	}
+	if !va.Type().Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// closureName matches the function names of closures and method values,
+// e.g: "layer.Logger.func1" or "layer.(*CORS).Register-fm".
+var closureName = regexp.MustCompile(`\.func\d+(\.\d+)*$|-fm$`)
+
+// isClosure reports whether the given function value is a closure or a method value,
+// which can't be told apart from the other ones created by the same code.
+func isClosure(v reflect.Value) bool {
+	fn := runtime.FuncForPC(v.Pointer())
+	return fn == nil || closureName.MatchString(fn.Name())
+}
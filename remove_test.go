@@ -0,0 +1,201 @@
+package layer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/utils.v0"
+)
+
+func removableHandler(w http.ResponseWriter, r *http.Request, h http.Handler) {
+	w.Header().Set("removable", "true")
+	h.ServeHTTP(w, r)
+}
+
+func TestRemoveByReference(t *testing.T) {
+	mw := New()
+	mw.Use(RequestPhase, removableHandler)
+	generation := mw.Generation()
+
+	st.Expect(t, mw.Remove(RequestPhase, removableHandler), 1)
+	st.Expect(t, mw.Generation(), generation+1)
+	st.Expect(t, mw.Pool[RequestPhase].Len(), 0)
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Header().Get("removable"), "")
+}
+
+func TestRemoveClosure(t *testing.T) {
+	mw := New()
+	foo := headerMiddleware("foo", "bar")
+	mw.Use(RequestPhase, foo)
+	mw.UseNamed(RequestPhase, "baz", headerMiddleware("baz", "qux"))
+
+	// Closures of the same function literal can't be told apart by reference
+	st.Expect(t, mw.Remove(RequestPhase, foo), 0)
+	st.Expect(t, mw.Pool[RequestPhase].Len(), 2)
+
+	st.Expect(t, mw.Remove(RequestPhase, "baz"), 1)
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Header().Get("foo"), "bar")
+	st.Expect(t, w.Header().Get("baz"), "")
+}
+
+func TestRemoveByName(t *testing.T) {
+	mw := New()
+	mw.Use(RequestPhase, removableHandler, removableHandler)
+	mw.Use(RequestPhase, headerMiddleware("foo", "bar"))
+
+	st.Expect(t, mw.Remove(RequestPhase, "layer.removableHandler"), 2)
+	st.Expect(t, mw.Pool[RequestPhase].Len(), 1)
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Header().Get("removable"), "")
+	st.Expect(t, w.Header().Get("foo"), "bar")
+}
+
+func TestRemoveInvalidatesMemo(t *testing.T) {
+	mw := New()
+	mw.Use(RequestPhase, removableHandler)
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Header().Get("removable"), "true")
+
+	mw.Remove(RequestPhase, removableHandler)
+	w = utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Header().Get("removable"), "")
+}
+
+func TestRemoveUnknown(t *testing.T) {
+	mw := New()
+	generation := mw.Generation()
+	st.Expect(t, mw.Remove(RequestPhase, "missing"), 0)
+	st.Expect(t, mw.Remove("unknown", removableHandler), 0)
+	st.Expect(t, mw.Generation(), generation)
+}
+
+func TestUseNamed(t *testing.T) {
+	mw := New()
+	mw.UseNamed(RequestPhase, "foo", headerMiddleware("foo", "bar"))
+	mw.UseNamed(RequestPhase, "bar", headerMiddleware("bar", "baz"))
+
+	st.Expect(t, mw.Remove(RequestPhase, "foo"), 1)
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Header().Get("foo"), "")
+	st.Expect(t, w.Header().Get("bar"), "baz")
+}
+
+func TestUseNamedDuplicate(t *testing.T) {
+	mw := New()
+	mw.UseNamed(RequestPhase, "foo", removableHandler)
+
+	defer func() {
+		err, ok := recover().(*HandlerError)
+		st.Expect(t, ok, true)
+		st.Expect(t, err.Err, ErrDuplicateName)
+		st.Expect(t, mw.Pool[RequestPhase].Len(), 1)
+	}()
+	mw.UseNamed(RequestPhase, "foo", removableHandler)
+}
+
+func TestReplace(t *testing.T) {
+	mw := New()
+	mw.UsePriority(RequestPhase, Head, headerMiddleware("order", "head"))
+	mw.UseNamed(RequestPhase, "auth", headerMiddleware("auth", "v1"))
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Header().Set("order", w.Header().Get("order")+","+w.Header().Get("auth"))
+		h.ServeHTTP(w, r)
+	})
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Header().Get("order"), "head,v1")
+
+	st.Expect(t, mw.Replace(RequestPhase, "auth", headerMiddleware("auth", "v2")), nil)
+	st.Expect(t, mw.Pool[RequestPhase].Len(), 3)
+
+	w = utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Header().Get("order"), "head,v2")
+
+	// The replaced handler keeps its name
+	st.Expect(t, mw.Remove(RequestPhase, "auth"), 1)
+}
+
+func TestReplaceUnknown(t *testing.T) {
+	mw := New()
+	err := mw.Replace(RequestPhase, "auth", removableHandler)
+	st.Expect(t, err.(*NameError).Err, ErrUnknownMiddleware)
+	st.Expect(t, err.Error(), `vinxi: unknown middleware name: "auth" (phase "request")`)
+}
+
+func orderMiddleware(name string) func(http.ResponseWriter, *http.Request, http.Handler) {
+	return func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Header().Add("order", name)
+		h.ServeHTTP(w, r)
+	}
+}
+
+func TestUseBeforeAfter(t *testing.T) {
+	mw := New()
+	mw.UseNamed(RequestPhase, "auth", orderMiddleware("auth"))
+	mw.UseNamed(RequestPhase, "proxy", orderMiddleware("proxy"))
+	mw.UsePriority(RequestPhase, Tail, orderMiddleware("tail"))
+
+	st.Expect(t, mw.UseBefore(RequestPhase, "proxy", orderMiddleware("before1"), orderMiddleware("before2")), nil)
+	st.Expect(t, mw.UseAfter(RequestPhase, "proxy", orderMiddleware("after")), nil)
+	st.Expect(t, mw.UseBefore(RequestPhase, "auth", orderMiddleware("first")), nil)
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Header()["Order"], []string{"first", "auth", "before1", "before2", "proxy", "after", "tail"})
+}
+
+func TestUseBeforeUnknown(t *testing.T) {
+	mw := New()
+	mw.UseNamed(RequestPhase, "auth", orderMiddleware("auth"))
+
+	err := mw.UseAfter(RequestPhase, "missing", orderMiddleware("after"))
+	st.Expect(t, err.(*NameError).Err, ErrUnknownMiddleware)
+	st.Expect(t, mw.Pool[RequestPhase].Len(), 1)
+}
+
+func TestDisable(t *testing.T) {
+	mw := New()
+	mw.UseNamed("request", "foo", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Header().Add("X-Order", "foo")
+		h.ServeHTTP(w, r)
+	})
+	mw.UseNamed(AllPhases, "bar", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Header().Add("X-Order", "bar")
+		h.ServeHTTP(w, r)
+	})
+
+	run := func() []string {
+		w := httptest.NewRecorder()
+		mw.Run("request", w, &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		return w.Header()["X-Order"]
+	}
+	st.Expect(t, run(), []string{"bar", "foo"})
+
+	st.Expect(t, mw.Disable("foo"), 1)
+	st.Expect(t, run(), []string{"bar"})
+	st.Expect(t, mw.Disable("bar"), 1)
+	st.Expect(t, run(), []string(nil))
+	st.Expect(t, mw.Pool["request"].Names(), []string{"foo"})
+	st.Expect(t, mw.Describe().Phases[0].Middleware[0].Disabled, true)
+
+	st.Expect(t, mw.Enable("foo"), 1)
+	st.Expect(t, mw.Enable("bar"), 1)
+	st.Expect(t, run(), []string{"bar", "foo"})
+	st.Expect(t, mw.Disable("missing"), 0)
+}
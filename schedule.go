@@ -0,0 +1,184 @@
+package layer
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule represents a middleware activation schedule.
+type Schedule interface {
+	// Active reports whether the schedule is active at the given time.
+	Active(time.Time) bool
+}
+
+// ScheduleFunc adapts a function to the Schedule interface.
+type ScheduleFunc func(time.Time) bool
+
+// Active reports whether the schedule is active at the given time.
+func (fn ScheduleFunc) Active(t time.Time) bool {
+	return fn(t)
+}
+
+// ParseSchedule parses the given schedule spec, which can be either
+// a daily time window in "HH:MM-HH:MM" notation (e.g: "22:00-06:00"),
+// or a cron-like expression with five fields: minute, hour, day of month,
+// month and day of week (e.g: "* 9-17 * * 1-5"), active during every
+// matching minute. Cron fields support "*", lists, ranges and steps.
+// Day of week accepts both 0 and 7 as Sunday, and, as in standard cron,
+// a day matches either day field if both of them are restricted.
+// Times are matched in the time location passed to Active.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if fields := strings.Fields(spec); len(fields) == 5 {
+		return parseCron(fields)
+	}
+	if parts := strings.Split(spec, "-"); len(parts) == 2 {
+		return parseWindow(parts[0], parts[1])
+	}
+	return nil, fmt.Errorf("vinxi: invalid schedule spec %q", spec)
+}
+
+// MustParseSchedule is like ParseSchedule but panics if the spec is invalid.
+func MustParseSchedule(spec string) Schedule {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		panic(err)
+	}
+	return schedule
+}
+
+// UseDuring registers new handlers for the given phase which are only
+// executed while the given schedule is active, and skipped otherwise.
+// The schedule is checked on every request, when the middleware
+// is reached in the chain, so memoized or eagerly built chains
+// honor the schedule changes too.
+func (s *Layer) UseDuring(phase string, schedule Schedule, handler ...interface{}) {
+	if isNil(schedule) {
+		panic(&HandlerError{Phase: phase, Err: ErrNilHandler})
+	}
+	s.useWith(phase, Normal, when(func(r *http.Request) bool {
+		return schedule.Active(time.Now())
+	}), handler...)
+}
+
+// window implements a daily time window schedule, in minutes of the day.
+type window struct {
+	start, end int
+}
+
+// Active reports whether the given time is within the daily window.
+func (w window) Active(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if w.start <= w.end {
+		return minute >= w.start && minute < w.end
+	}
+	// Window wrapping midnight
+	return minute >= w.start || minute < w.end
+}
+
+// parseWindow parses a daily time window.
+func parseWindow(start, end string) (Schedule, error) {
+	from, err := parseClock(start)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseClock(end)
+	if err != nil {
+		return nil, err
+	}
+	return window{start: from, end: to}, nil
+}
+
+// parseClock parses an "HH:MM" clock time as minutes of the day.
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, fmt.Errorf("vinxi: invalid schedule time %q", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// cron implements a cron-like schedule using bit sets per field.
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	// days defines if both day fields are restricted, in which case
+	// either of them must match, as standard cron does.
+	days bool
+}
+
+// Active reports whether the given time matches the cron expression.
+func (c cron) Active(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	day := dom && dow
+	if c.days {
+		day = dom || dow
+	}
+	return c.minute&(1<<uint(t.Minute())) != 0 &&
+		c.hour&(1<<uint(t.Hour())) != 0 &&
+		c.month&(1<<uint(t.Month())) != 0 &&
+		day
+}
+
+// parseCron parses the five cron expression fields.
+func parseCron(fields []string) (Schedule, error) {
+	// Day of week accepts both 0 and 7 as Sunday
+	bounds := [][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	sets := make([]uint64, len(fields))
+	for i, field := range fields {
+		set, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+	if sets[4]&(1<<7) != 0 {
+		sets[4] = sets[4]&^(1<<7) | 1
+	}
+	days := !strings.HasPrefix(fields[2], "*") && !strings.HasPrefix(fields[4], "*")
+	return cron{minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4], days: days}, nil
+}
+
+// parseCronField parses a cron field into a bit set within the given bounds.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		step, stepped := 1, false
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("vinxi: invalid schedule step %q", part)
+			}
+			step, stepped, part = n, true, part[:i]
+		}
+
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("vinxi: invalid schedule field %q", field)
+			}
+			// A single value with step, e.g: "5/15", runs up to the field bound
+			switch {
+			case len(bounds) == 2:
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("vinxi: invalid schedule field %q", field)
+				}
+			case !stepped:
+				to = from
+			}
+		}
+		if from < min || to > max || from > to {
+			return 0, fmt.Errorf("vinxi: schedule field %q out of range", field)
+		}
+
+		for i := from; i <= to; i += step {
+			set |= 1 << uint(i)
+		}
+	}
+	return set, nil
+}
@@ -0,0 +1,145 @@
+package layer
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/utils.v0"
+)
+
+func TestParseScheduleWindow(t *testing.T) {
+	s := MustParseSchedule("22:00-06:00")
+	st.Expect(t, s.Active(time.Date(2016, 3, 19, 23, 0, 0, 0, time.UTC)), true)
+	st.Expect(t, s.Active(time.Date(2016, 3, 19, 5, 59, 0, 0, time.UTC)), true)
+	st.Expect(t, s.Active(time.Date(2016, 3, 19, 6, 0, 0, 0, time.UTC)), false)
+	st.Expect(t, s.Active(time.Date(2016, 3, 19, 12, 0, 0, 0, time.UTC)), false)
+
+	s = MustParseSchedule("09:00-17:30")
+	st.Expect(t, s.Active(time.Date(2016, 3, 19, 17, 29, 0, 0, time.UTC)), true)
+	st.Expect(t, s.Active(time.Date(2016, 3, 19, 8, 59, 0, 0, time.UTC)), false)
+}
+
+func TestParseScheduleCron(t *testing.T) {
+	// Business hours, every other minute, Monday to Friday
+	s := MustParseSchedule("*/2 9-17 * * 1-5")
+	st.Expect(t, s.Active(time.Date(2016, 3, 18, 10, 4, 0, 0, time.UTC)), true)
+	st.Expect(t, s.Active(time.Date(2016, 3, 18, 10, 5, 0, 0, time.UTC)), false)
+	st.Expect(t, s.Active(time.Date(2016, 3, 18, 18, 4, 0, 0, time.UTC)), false)
+	st.Expect(t, s.Active(time.Date(2016, 3, 19, 10, 4, 0, 0, time.UTC)), false)
+
+	s = MustParseSchedule("0,30 * 1 1,6 *")
+	st.Expect(t, s.Active(time.Date(2016, 6, 1, 3, 30, 0, 0, time.UTC)), true)
+	st.Expect(t, s.Active(time.Date(2016, 6, 2, 3, 30, 0, 0, time.UTC)), false)
+}
+
+func TestParseScheduleCronSunday(t *testing.T) {
+	// 2016-03-20 is a Sunday
+	for _, spec := range []string{"* * * * 0", "* * * * 7", "* * * * 5-7"} {
+		s := MustParseSchedule(spec)
+		st.Expect(t, s.Active(time.Date(2016, 3, 20, 10, 0, 0, 0, time.UTC)), true)
+		st.Expect(t, s.Active(time.Date(2016, 3, 16, 10, 0, 0, 0, time.UTC)), false)
+	}
+}
+
+func TestParseScheduleCronStartStep(t *testing.T) {
+	s := MustParseSchedule("5/15 * * * *")
+	for _, minute := range []int{5, 20, 35, 50} {
+		st.Expect(t, s.Active(time.Date(2016, 3, 19, 10, minute, 0, 0, time.UTC)), true)
+	}
+	st.Expect(t, s.Active(time.Date(2016, 3, 19, 10, 0, 0, 0, time.UTC)), false)
+	st.Expect(t, s.Active(time.Date(2016, 3, 19, 10, 6, 0, 0, time.UTC)), false)
+}
+
+func TestParseScheduleCronDays(t *testing.T) {
+	// The 1st day of month or any Monday, as standard cron does
+	s := MustParseSchedule("* * 1 * 1")
+	st.Expect(t, s.Active(time.Date(2016, 3, 1, 10, 0, 0, 0, time.UTC)), true)
+	st.Expect(t, s.Active(time.Date(2016, 3, 14, 10, 0, 0, 0, time.UTC)), true)
+	st.Expect(t, s.Active(time.Date(2016, 3, 15, 10, 0, 0, 0, time.UTC)), false)
+
+	// Unrestricted day fields still match both
+	s = MustParseSchedule("* * */2 * 1")
+	st.Expect(t, s.Active(time.Date(2016, 3, 21, 10, 0, 0, 0, time.UTC)), true)
+	st.Expect(t, s.Active(time.Date(2016, 3, 14, 10, 0, 0, 0, time.UTC)), false)
+	st.Expect(t, s.Active(time.Date(2016, 3, 15, 10, 0, 0, 0, time.UTC)), false)
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, spec := range []string{"", "foo", "25:00-26:00", "60 * * * *", "* * * * 1-9", "* * * * 8", "70/5 * * * *", "*/0 * * * *", "5-1 * * * *"} {
+		_, err := ParseSchedule(spec)
+		st.Reject(t, err, nil)
+	}
+}
+
+func TestUseDuring(t *testing.T) {
+	active := false
+	schedule := ScheduleFunc(func(time.Time) bool { return active })
+
+	mw := New()
+	mw.UseDuring(RequestPhase, schedule, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Header().Set("banner", "maintenance")
+		h.ServeHTTP(w, r)
+	})
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Header().Get("banner"), "")
+	st.Expect(t, w.Code, 502)
+
+	active = true
+	w = utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Header().Get("banner"), "maintenance")
+	st.Expect(t, w.Code, 502)
+}
+
+func TestUseDuringNilSchedule(t *testing.T) {
+	for _, schedule := range []Schedule{nil, ScheduleFunc(nil)} {
+		func() {
+			defer func() {
+				err, ok := recover().(*HandlerError)
+				st.Expect(t, ok, true)
+				st.Expect(t, err.Err, ErrNilHandler)
+			}()
+
+			New().UseDuring(RequestPhase, schedule, FinalHandler)
+		}()
+	}
+}
+
+func TestUseDuringUnsupportedInterface(t *testing.T) {
+	defer func() {
+		st.Expect(t, recover(), "vinxi: unsupported middleware interface")
+	}()
+
+	New().UseDuring(RequestPhase, MustParseSchedule("* * * * *"), newPlugin(FinalHandler))
+}
+
+func TestUseDuringComposedOnce(t *testing.T) {
+	active := false
+	schedule := ScheduleFunc(func(time.Time) bool { return active })
+
+	mw := New()
+	mw.UseDuring(RequestPhase, schedule, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Header().Set("banner", "maintenance")
+		h.ServeHTTP(w, r)
+	})
+
+	// Compose the chain once, as routers do
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	mws := mw.Middlewares(RequestPhase)
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+
+	w := utils.NewWriterStub()
+	h.ServeHTTP(w, &http.Request{})
+	st.Expect(t, w.Header().Get("banner"), "")
+
+	active = true
+	w = utils.NewWriterStub()
+	h.ServeHTTP(w, &http.Request{})
+	st.Expect(t, w.Header().Get("banner"), "maintenance")
+}
@@ -0,0 +1,88 @@
+package layer
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// RunAll runs the middleware chains of the given phases end-to-end
+// as a single composed pipeline, in the given order: the final handler of
+// every phase chain runs the next phase, and the last phase one calls the
+// given final handler, or the layer final handler if nil.
+// For instance, given the custom "auth" and "audit" phases:
+//
+//	mw.RunAll([]string{"auth", "request", "audit"}, w, r, nil)
+//
+// The composed pipeline is memoized per phases list, while every phase chain
+// is memoized by the layer as usual, so layer mutations take effect in
+// subsequent calls. Every phase is run as Run does, so panics are recovered,
+// and observers and timeouts are applied, per phase: once a phase fails,
+// the error phase is triggered and the next phases are not run.
+func (s *Layer) RunAll(phases []string, w http.ResponseWriter, r *http.Request, h http.Handler) {
+	if len(phases) == 0 {
+		if h == nil {
+			s.mutex.RLock()
+			h = finalHandler(s.finalHandler)
+			s.mutex.RUnlock()
+		}
+		h.ServeHTTP(w, r)
+		return
+	}
+
+	key := strings.Join(phases, "\x00")
+	q, ok := s.sequences.Load(key)
+	if !ok {
+		q, _ = s.sequences.LoadOrStore(key, newSequence(s, append([]string(nil), phases...)))
+	}
+	q.(*sequence).run(w, r, h)
+}
+
+// sequence implements the composed pipeline of the phases run by RunAll.
+type sequence struct {
+	// layer stores the layer running the phases.
+	layer Runnable
+	// phases stores the phases to run in order.
+	phases []string
+	// steps stores the sequence steps, one per phase.
+	steps []sequenceStep
+}
+
+// sequenceStep represents a phase position in the sequence,
+// used as final handler by the previous phase.
+type sequenceStep struct {
+	sequence *sequence
+	index    int
+}
+
+// newSequence creates a new phase sequence for the given layer.
+func newSequence(layer Runnable, phases []string) *sequence {
+	q := &sequence{layer: layer, phases: phases, steps: make([]sequenceStep, len(phases))}
+	for i := range q.steps {
+		q.steps[i] = sequenceStep{sequence: q, index: i}
+	}
+	return q
+}
+
+// run runs the sequence starting from the first phase, calling the given
+// final handler once the last phase is completed. Since the sequence is shared
+// by concurrent requests, the final handler is passed via the request context.
+func (q *sequence) run(w http.ResponseWriter, r *http.Request, final http.Handler) {
+	if final != nil {
+		r = r.WithContext(context.WithValue(r.Context(), q, final))
+	}
+	q.steps[0].ServeHTTP(w, r)
+}
+
+// ServeHTTP runs the phase at the current step position,
+// handing off to the next phase once its chain is completed.
+func (s *sequenceStep) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := s.sequence
+	var next http.Handler
+	if s.index+1 < len(q.steps) {
+		next = &q.steps[s.index+1]
+	} else if final, ok := r.Context().Value(q).(http.Handler); ok {
+		next = final
+	}
+	q.layer.Run(q.phases[s.index], w, r, next)
+}
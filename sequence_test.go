@@ -0,0 +1,77 @@
+package layer
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/utils.v0"
+)
+
+func TestRunAll(t *testing.T) {
+	mw := New()
+	mw.Use("audit", orderMiddleware("audit"))
+	mw.Use(RequestPhase, orderMiddleware("request"))
+	mw.Use("pre", orderMiddleware("pre"))
+	mw.Use(ResponsePhase, orderMiddleware("response"))
+
+	w := utils.NewWriterStub()
+	mw.RunAll([]string{"pre", RequestPhase, "audit"}, w, &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("order", "final")
+		w.WriteHeader(204)
+	}))
+	st.Expect(t, w.Code, 204)
+	st.Expect(t, w.Header()["Order"], []string{"pre", "request", "audit", "final", "response"})
+}
+
+func TestRunAllDefaultFinalHandler(t *testing.T) {
+	mw := New()
+	mw.UseFinalHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(202)
+	}))
+
+	w := utils.NewWriterStub()
+	mw.RunAll([]string{"pre", "audit"}, w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 202)
+
+	w = utils.NewWriterStub()
+	mw.RunAll(nil, w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 202)
+}
+
+func TestRunAllStopsOnError(t *testing.T) {
+	mw := New()
+	mw.Use("pre", func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+	mw.Use(RequestPhase, orderMiddleware("request"))
+
+	w := utils.NewWriterStub()
+	mw.RunAll([]string{"pre", RequestPhase}, w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 500)
+	st.Expect(t, w.Header().Get("order"), "")
+}
+
+func TestRunAllMemoized(t *testing.T) {
+	mw := New()
+	mw.Use("pre", orderMiddleware("pre"))
+
+	final := func(code int) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		})
+	}
+	w := utils.NewWriterStub()
+	mw.RunAll([]string{"pre", "audit"}, w, &http.Request{}, final(201))
+	st.Expect(t, w.Code, 201)
+	q, _ := mw.sequences.Load("pre\x00audit")
+
+	// Mutations and per-call final handlers apply to the memoized pipeline
+	mw.Use("audit", orderMiddleware("audit"))
+	w = utils.NewWriterStub()
+	mw.RunAll([]string{"pre", "audit"}, w, &http.Request{}, final(202))
+	st.Expect(t, w.Code, 202)
+	st.Expect(t, w.Header()["Order"], []string{"pre", "audit"})
+	p, _ := mw.sequences.Load("pre\x00audit")
+	st.Expect(t, p, q)
+}
@@ -0,0 +1,68 @@
+package layer
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// Condition represents a request condition used to decide whether a middleware applies.
+type Condition func(*http.Request) bool
+
+// ShadowStats stores the counters of a shadowed middleware condition.
+type ShadowStats struct {
+	// Evaluations stores the number of times the condition was evaluated.
+	Evaluations uint64
+	// Hits stores the number of times the middleware would have fired.
+	Hits uint64
+}
+
+// shadow stores the counters of a shadowed middleware, accessed atomically.
+type shadow struct {
+	evaluations, hits uint64
+}
+
+// UseShadow registers a shadow middleware in the given phase that keeps evaluating
+// the condition of a disabled or deprecated middleware, identified by name,
+// without executing any of its effects, counting how often it would have fired.
+// This provides data to justify a safe middleware removal. See ShadowStats.
+//
+// Registering the same name multiple times accumulates the counters.
+func (s *Layer) UseShadow(phase, name string, condition Condition) {
+	if condition == nil {
+		panic(&HandlerError{Phase: phase, Err: ErrNilHandler})
+	}
+
+	s.statsMutex.Lock()
+	if s.shadows == nil {
+		s.shadows = make(map[string]*shadow)
+	}
+	counter, ok := s.shadows[name]
+	if !ok {
+		counter = &shadow{}
+		s.shadows[name] = counter
+	}
+	s.statsMutex.Unlock()
+
+	s.use(phase, Normal, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		atomic.AddUint64(&counter.evaluations, 1)
+		if condition(r) {
+			atomic.AddUint64(&counter.hits, 1)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// ShadowStats returns the counters of the shadowed middleware, by name.
+func (s *Layer) ShadowStats() map[string]ShadowStats {
+	s.statsMutex.Lock()
+	defer s.statsMutex.Unlock()
+
+	stats := make(map[string]ShadowStats, len(s.shadows))
+	for name, counter := range s.shadows {
+		stats[name] = ShadowStats{
+			Evaluations: atomic.LoadUint64(&counter.evaluations),
+			Hits:        atomic.LoadUint64(&counter.hits),
+		}
+	}
+	return stats
+}
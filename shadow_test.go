@@ -0,0 +1,40 @@
+package layer
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/utils.v0"
+)
+
+func TestUseShadow(t *testing.T) {
+	mw := New()
+	mw.UseShadow(RequestPhase, "legacy-auth", func(r *http.Request) bool {
+		return r.URL.Path == "/admin"
+	})
+
+	calls := 0
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	})
+	for _, path := range []string{"/", "/admin", "/foo", "/admin"} {
+		mw.Run(RequestPhase, utils.NewWriterStub(), &http.Request{URL: &url.URL{Path: path}}, final)
+	}
+
+	st.Expect(t, calls, 4)
+	st.Expect(t, mw.ShadowStats(), map[string]ShadowStats{
+		"legacy-auth": {Evaluations: 4, Hits: 2},
+	})
+}
+
+func TestUseShadowNilCondition(t *testing.T) {
+	defer func() {
+		err, ok := recover().(*HandlerError)
+		st.Expect(t, ok, true)
+		st.Expect(t, err.Err, ErrNilHandler)
+	}()
+
+	New().UseShadow(RequestPhase, "foo", nil)
+}
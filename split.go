@@ -0,0 +1,126 @@
+package layer
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"net"
+	"net/http"
+)
+
+// SplitKey represents a function returning the request key used
+// to consistently route the requests of a traffic split.
+// Requests with an empty key are routed randomly.
+type SplitKey func(*http.Request) string
+
+// SplitByHeader returns a split key using the given request header value,
+// e.g: a user or session identifier.
+func SplitByHeader(name string) SplitKey {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// SplitByCookie returns a split key using the given request cookie value.
+func SplitByCookie(name string) SplitKey {
+	return func(r *http.Request) string {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	}
+}
+
+// SplitByClient is the default split key, using the client IP address.
+func SplitByClient(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// WithSplitKey defines the split key used by the handlers registered via UseSplit.
+// Defaults to SplitByClient.
+//
+// It panics if key is nil.
+func WithSplitKey(key SplitKey) Option {
+	if key == nil {
+		panic(&HandlerError{Err: ErrNilHandler})
+	}
+	return func(s *Layer) {
+		s.splitKey = key
+	}
+}
+
+// split represents a weighted traffic split between two middleware handlers.
+type split struct {
+	key            SplitKey
+	weightA, total uint32
+	a, b           MiddlewareFunc
+}
+
+// UseSplit registers a traffic split in the given phase, routing every request
+// through one of the given handlers accordingly to their weights, e.g:
+// UseSplit(phase, 90, stable, 10, experimental) routes a 10% of the traffic
+// through the experimental handler. Any of the handlers can be nil,
+// in which case its share of the traffic continues the chain untouched,
+// while terminal handlers, such as http.Handler, split the final handler.
+//
+// Requests are routed consistently by hashing the layer split key,
+// so requests with the same key always take the same handler.
+// See WithSplitKey. Registrable handlers are not supported.
+//
+// It panics if any weight is negative or both are zero.
+func (s *Layer) UseSplit(phase string, weightA int, handlerA interface{}, weightB int, handlerB interface{}) {
+	if weightA < 0 || weightB < 0 || weightA+weightB == 0 {
+		panic("vinxi: invalid traffic split weights")
+	}
+
+	s.mutex.RLock()
+	key := s.splitKey
+	s.mutex.RUnlock()
+	if key == nil {
+		key = SplitByClient
+	}
+
+	sp := &split{key: key, weightA: uint32(weightA), total: uint32(weightA + weightB)}
+	phase = s.phase(phase)
+	for i, h := range []interface{}{handlerA, handlerB} {
+		mw := func(h http.Handler) http.Handler { return h }
+		if !isNil(h) {
+			if mw = AdaptFunc(h); mw == nil {
+				panic("vinxi: unsupported middleware interface")
+			}
+		}
+		if i == 0 {
+			sp.a = mw
+		} else {
+			sp.b = mw
+		}
+	}
+	s.push(phase, Normal, newEntry(sp, sp.middleware))
+}
+
+// middleware implements the split middleware function.
+func (sp *split) middleware(h http.Handler) http.Handler {
+	a, b := sp.a(h), sp.b(h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sp.bucket(r) < sp.weightA {
+			a.ServeHTTP(w, r)
+			return
+		}
+		b.ServeHTTP(w, r)
+	})
+}
+
+// bucket returns the request bucket, between zero and the total weight.
+func (sp *split) bucket(r *http.Request) uint32 {
+	key := sp.key(r)
+	if key == "" {
+		return uint32(rand.Int63n(int64(sp.total)))
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return hash.Sum32() % sp.total
+}
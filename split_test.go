@@ -0,0 +1,75 @@
+package layer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func splitHandler(name string) func(http.ResponseWriter, *http.Request, http.Handler) {
+	return func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Header().Set("X-Split", name)
+		h.ServeHTTP(w, r)
+	}
+}
+
+func runSplit(mw *Layer, r *http.Request) string {
+	w := httptest.NewRecorder()
+	mw.Run("request", w, r, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	return w.Header().Get("X-Split")
+}
+
+func TestUseSplit(t *testing.T) {
+	mw := New(WithSplitKey(SplitByHeader("User")))
+	mw.UseSplit("request", 80, splitHandler("a"), 20, splitHandler("b"))
+
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("User", strconv.Itoa(i))
+		split := runSplit(mw, r)
+		counts[split]++
+
+		// Requests with the same key are consistently routed
+		st.Expect(t, runSplit(mw, r), split)
+	}
+	st.Expect(t, counts["a"]+counts["b"], 1000)
+	st.Expect(t, counts["a"] > 700 && counts["a"] < 900, true)
+}
+
+func TestUseSplitWeights(t *testing.T) {
+	mw := New()
+	mw.UseSplit("request", 0, splitHandler("a"), 1, nil)
+	st.Expect(t, runSplit(mw, httptest.NewRequest("GET", "/", nil)), "")
+
+	mw = New()
+	mw.UseSplit("request", 1, splitHandler("a"), 0, splitHandler("b"))
+	st.Expect(t, runSplit(mw, httptest.NewRequest("GET", "/", nil)), "a")
+
+	defer func() {
+		st.Expect(t, recover(), "vinxi: invalid traffic split weights")
+	}()
+	mw.UseSplit("request", 0, nil, 0, nil)
+}
+
+func TestSplitKeys(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.AddCookie(&http.Cookie{Name: "session", Value: "foo"})
+	st.Expect(t, SplitByClient(r), "10.0.0.1")
+	st.Expect(t, SplitByCookie("session")(r), "foo")
+	st.Expect(t, SplitByCookie("missing")(r), "")
+}
+
+func TestWithSplitKeyNil(t *testing.T) {
+	defer func() {
+		err, ok := recover().(*HandlerError)
+		st.Expect(t, ok, true)
+		st.Expect(t, err.Err, ErrNilHandler)
+	}()
+
+	WithSplitKey(nil)
+}
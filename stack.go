@@ -1,6 +1,16 @@
 package layer
 
+import "fmt"
+
 // Priority represents the middleware priority.
+//
+// Middleware handlers are ordered by their priority level, from the lowest
+// to the highest. Handlers with the same level are guaranteed to run in
+// registration order (FIFO), except for the TopHead and TopTail priorities,
+// which place the handler before the ones already registered in its level.
+// Named priorities are sugar over fixed levels, while PriorityAt defines
+// arbitrary ones, e.g: PriorityAt(HeadLevel + 10) runs after Head handlers
+// but before Normal ones.
 type Priority int
 
 const (
@@ -25,51 +35,429 @@ const (
 	Tail
 )
 
+const (
+	// HeadLevel defines the priority level of the Head and TopHead priorities.
+	HeadLevel = -1000
+
+	// NormalLevel defines the priority level of the Normal priority.
+	NormalLevel = 0
+
+	// TailLevel defines the priority level of the Tail and TopTail priorities.
+	TailLevel = 1000
+
+	// maxLevel defines the maximum absolute value of a priority level.
+	maxLevel = 1 << 23
+
+	// levelOffset defines the offset of the arbitrary level priorities,
+	// so they never collide with the named ones.
+	levelOffset Priority = 1 << 24
+)
+
+// PriorityAt returns the priority for the given arbitrary level.
+// Handlers with the same level keep their registration order.
+// Levels are clamped between -(1 << 23) and 1 << 23.
+func PriorityAt(level int) Priority {
+	if level > maxLevel {
+		level = maxLevel
+	}
+	if level < -maxLevel {
+		level = -maxLevel
+	}
+	return levelOffset + Priority(level)
+}
+
+// Level returns the priority level used to order the middleware handlers.
+func (p Priority) Level() int {
+	switch p {
+	case TopHead, Head:
+		return HeadLevel
+	case Normal:
+		return NormalLevel
+	case TopTail, Tail:
+		return TailLevel
+	}
+	return int(p - levelOffset)
+}
+
+// String returns the priority name, as accepted by configuration documents,
+// e.g: "top_head", or "level(-10)" for arbitrary level priorities.
+func (p Priority) String() string {
+	switch p {
+	case TopHead:
+		return "top_head"
+	case Head:
+		return "head"
+	case Normal:
+		return "normal"
+	case TopTail:
+		return "top_tail"
+	case Tail:
+		return "tail"
+	}
+	return fmt.Sprintf("level(%d)", p.Level())
+}
+
+// entry represents a middleware function registered in a stack.
+type entry struct {
+	// calls stores the number of middleware calls, accessed atomically.
+	// See WithMiddlewareStats.
+	calls uint64
+	// name stores the middleware name.
+	name string
+	// handler stores the original registered handler, used to match it by reference.
+	handler interface{}
+	// fn stores the adapted middleware function.
+	fn MiddlewareFunc
+	// priority stores the middleware registration priority.
+	priority Priority
+	// level stores the middleware priority level.
+	level int
+	// source stores the file and line the middleware was registered from, if known.
+	source string
+	// disabled stores if the middleware is disabled. See Disable.
+	disabled bool
+}
+
+// MiddlewareStack represents a middleware stack implementation,
+// which defines the execution order of the middleware handlers.
+// Stack is the default implementation.
+type MiddlewareStack interface {
+	// Push pushes a new middleware handler based on the given priority.
+	Push(Priority, MiddlewareFunc)
+	// Join returns the ordered middleware functions.
+	Join() []MiddlewareFunc
+	// Len returns the middleware stack length.
+	Len() int
+}
+
+// WithStack defines the middleware stack implementation used by the layer
+// phases, allowing to change the ordering semantics, e.g: weighted or
+// dependency-resolved ordering. The factory is called every time a phase
+// chain is rebuilt, pushing its handlers in registration order, wildcard
+// phase handlers first.
+//
+// Phase stacks still keep track of the registered handlers, so Remove,
+// Replace and introspection work as usual: stack accessors return the
+// handlers in registration order, while UseBefore and UseAfter insert
+// the handlers in the registration sequence.
+func WithStack(factory func() MiddlewareStack) Option {
+	return func(s *Layer) {
+		s.stackFactory = factory
+	}
+}
+
+// newStack creates a new phase stack using the layer stack implementation.
+func (s *Layer) newStack() *Stack {
+	return &Stack{factory: s.stackFactory, counted: s.middlewareStats, labeled: s.profilerLabels, traced: s.requestTrace, observers: s.observers}
+}
+
 // Stack stores the data to show.
 type Stack struct {
 	// memo stores the memorized pre-computed merged stack for better performance.
+	// The memo only stores the ordered middleware functions, never the final
+	// handler, which is bound on every Run, so the memo is safely shared by
+	// runs using different final handlers.
 	memo []MiddlewareFunc
 
-	// Head stores the head priority handlers.
+	// items stores the middleware entries ordered by priority level,
+	// or by registration order if a custom stack implementation is used.
+	items []*entry
+
+	// factory stores the custom stack implementation factory, if any.
+	factory func() MiddlewareStack
+
+	// counted defines if the middleware calls are counted. See WithMiddlewareStats.
+	counted bool
+
+	// labeled defines if the middleware calls are tagged with profiler labels.
+	// See WithProfilerLabels.
+	labeled bool
+
+	// traced defines if the middleware calls are recorded in the request trace.
+	// See WithRequestTrace.
+	traced bool
+
+	// observers stores the layer observers notified on middleware calls, if any.
+	observers []Observer
+
+	// Head stores the head priority handlers, including the negative levels.
+	//
+	// Deprecated: kept in sync for reading only, changes are ignored.
+	// Use Handlers or HandlersAt instead.
 	Head []MiddlewareFunc
 
 	// Stack stores the middleware normal priority handlers.
+	//
+	// Deprecated: kept in sync for reading only, changes are ignored.
+	// Use Handlers or HandlersAt instead.
 	Stack []MiddlewareFunc
 
-	// Tail stores the middleware tail priority handlers.
+	// Tail stores the middleware tail priority handlers, including the positive levels.
+	//
+	// Deprecated: kept in sync for reading only, changes are ignored.
+	// Use Handlers or HandlersAt instead.
 	Tail []MiddlewareFunc
 }
 
 // Push pushes a new middleware handler to the stack based on the given priority.
 func (s *Stack) Push(order Priority, h MiddlewareFunc) {
+	s.push(order, &entry{fn: h, source: callerSource()})
+}
+
+// push pushes a new middleware entry to the stack based on the given priority.
+// The entry is placed after the entries with the same priority level,
+// or before them for the TopHead and TopTail priorities.
+func (s *Stack) push(order Priority, e *entry) {
 	s.memo = nil // flush the memoized stack
-	if order == TopHead {
-		s.Head = append([]MiddlewareFunc{h}, s.Head...)
+	e.priority, e.level = order, order.Level()
+	if s.factory != nil {
+		s.items = append(s.items, e)
+		s.update(len(s.items) - 1)
+		return
+	}
+	top := order == TopHead || order == TopTail
+
+	i := len(s.items)
+	for j, item := range s.items {
+		if item.level > e.level || (top && item.level == e.level) {
+			i = j
+			break
+		}
+	}
+	s.items = append(s.items, nil)
+	copy(s.items[i+1:], s.items[i:])
+	s.items[i] = e
+	s.update(i)
+}
+
+// remove removes every middleware entry matching the given function,
+// returning the number of removed entries.
+func (s *Stack) remove(match func(*entry) bool) int {
+	kept := s.items[:0:0]
+	for _, e := range s.items {
+		if !match(e) {
+			kept = append(kept, e)
+		}
+	}
+
+	removed := len(s.items) - len(kept)
+	s.items = kept
+	if removed > 0 {
+		s.memo = nil // flush the memoized stack
+		s.update(-1)
+	}
+	return removed
+}
+
+// replace replaces the first stack entry with the given name by the given entry,
+// preserving its position. It reports whether the entry was replaced.
+func (s *Stack) replace(name string, e *entry) bool {
+	for i, old := range s.items {
+		if old.name == name {
+			e.priority, e.level = old.priority, old.level
+			s.items[i] = e
+			s.memo = nil // flush the memoized stack
+			s.update(-1)
+			return true
+		}
 	}
-	if order == Head {
-		s.Head = append(s.Head, h)
+	return false
+}
+
+// insert inserts the given entries before or after the first stack entry
+// with the given name, within the same priority. It reports whether the
+// named entry was found.
+func (s *Stack) insert(name string, after bool, es ...*entry) bool {
+	for i, e := range s.items {
+		if e.name != name {
+			continue
+		}
+		for _, inserted := range es {
+			inserted.priority, inserted.level = e.priority, e.level
+		}
+		if after {
+			i++
+		}
+		inserted := make([]*entry, 0, len(s.items)+len(es))
+		inserted = append(inserted, s.items[:i]...)
+		inserted = append(inserted, es...)
+		s.items = append(inserted, s.items[i:]...)
+		s.memo = nil // flush the memoized stack
+		s.update(-1)
+		return true
 	}
-	if order == Tail {
-		s.Tail = append(s.Tail, h)
+	return false
+}
+
+// update updates the deprecated Head, Stack and Tail fields once the entry
+// at the given position is pushed, appending it if it's the last entry,
+// or rebuilding them from the stack entries otherwise.
+func (s *Stack) update(pushed int) {
+	if pushed >= 0 && pushed == len(s.items)-1 {
+		e := s.items[pushed]
+		fns := s.levelHandlers(e.level)
+		*fns = append(*fns, e.fn)
+		return
 	}
-	if order == TopTail {
-		s.Tail = append([]MiddlewareFunc{h}, s.Tail...)
+	s.Head, s.Stack, s.Tail = nil, nil, nil
+	for _, e := range s.items {
+		fns := s.levelHandlers(e.level)
+		*fns = append(*fns, e.fn)
 	}
-	if order == Normal {
-		s.Stack = append(s.Stack, h)
+}
+
+// levelHandlers returns the deprecated field storing the handlers of the given priority level.
+func (s *Stack) levelHandlers(level int) *[]MiddlewareFunc {
+	switch {
+	case level < NormalLevel:
+		return &s.Head
+	case level > NormalLevel:
+		return &s.Tail
+	}
+	return &s.Stack
+}
+
+// find returns the first stack entry with the given name, if any.
+func (s *Stack) find(name string) *entry {
+	for _, e := range s.items {
+		if e.name == name {
+			return e
+		}
 	}
+	return nil
+}
+
+// entries returns the ordered stack entries.
+func (s *Stack) entries() []*entry {
+	return append([]*entry(nil), s.items...)
 }
 
 // Join joins the middleware functions into a unique slice.
+// The returned slice is never modified by subsequent pushes,
+// so it can be safely retained as a chain snapshot.
 func (s *Stack) Join() []MiddlewareFunc {
-	if s.memo != nil {
-		return s.memo
+	return s.join(nil)
+}
+
+// join joins the middleware functions into a unique slice, merging the given
+// wildcard stack middleware first within every priority level, if any.
+func (s *Stack) join(wildcard *Stack) []MiddlewareFunc {
+	if s.memo == nil {
+		s.memo = s.compose(wildcard)
 	}
-	s.memo = append(append(s.Head, s.Stack...), s.Tail...)
 	return s.memo
 }
 
+// compose composes the ordered middleware functions like join, without memoizing them.
+func (s *Stack) compose(wildcard *Stack) []MiddlewareFunc {
+	if s.factory != nil {
+		return s.joinWith(s.factory(), wildcard)
+	}
+	entries := s.items
+	if wildcard != nil && wildcard != s {
+		entries = merge(wildcard.items, s.items)
+	}
+	queue := make([]MiddlewareFunc, 0, len(entries))
+	for _, e := range entries {
+		if !e.disabled {
+			queue = append(queue, e.middleware(s))
+		}
+	}
+	return queue
+}
+
+// joinWith composes the middleware functions using the given custom stack
+// implementation, pushing the given wildcard stack middleware first, if any.
+func (s *Stack) joinWith(stack MiddlewareStack, wildcard *Stack) []MiddlewareFunc {
+	if wildcard != nil && wildcard != s {
+		for _, e := range wildcard.items {
+			if !e.disabled {
+				stack.Push(e.priority, e.middleware(s))
+			}
+		}
+	}
+	for _, e := range s.items {
+		if !e.disabled {
+			stack.Push(e.priority, e.middleware(s))
+		}
+	}
+	queue := stack.Join()
+	if queue == nil {
+		queue = []MiddlewareFunc{}
+	}
+	return queue
+}
+
+// merge merges the given ordered entries by priority level,
+// placing the first ones before the second ones within the same level.
+func merge(first, second []*entry) []*entry {
+	merged := make([]*entry, 0, len(first)+len(second))
+	for len(first) > 0 && len(second) > 0 {
+		if first[0].level <= second[0].level {
+			merged, first = append(merged, first[0]), first[1:]
+			continue
+		}
+		merged, second = append(merged, second[0]), second[1:]
+	}
+	merged = append(merged, first...)
+	return append(merged, second...)
+}
+
+// Handlers returns the registered middleware handlers in execution order.
+// Handlers pushed as MiddlewareFunc are returned as such.
+func (s *Stack) Handlers() []interface{} {
+	return handlers(s.items, func(*entry) bool { return true })
+}
+
+// HandlersAt returns the registered middleware handlers
+// with the given priority level in execution order.
+func (s *Stack) HandlersAt(priority Priority) []interface{} {
+	level := priority.Level()
+	return handlers(s.items, func(e *entry) bool { return e.level == level })
+}
+
+// Names returns the registered middleware names in execution order.
+func (s *Stack) Names() []string {
+	names := make([]string, len(s.items))
+	for i, e := range s.items {
+		names[i] = e.name
+	}
+	return names
+}
+
+// Levels returns the priority levels of the registered middleware in execution order.
+func (s *Stack) Levels() []int {
+	levels := make([]int, len(s.items))
+	for i, e := range s.items {
+		levels[i] = e.level
+	}
+	return levels
+}
+
+// handlers returns the handlers of the given entries matching the given function.
+func handlers(entries []*entry, match func(*entry) bool) []interface{} {
+	var handlers []interface{}
+	for _, e := range entries {
+		if !match(e) {
+			continue
+		}
+		if e.handler == nil {
+			handlers = append(handlers, e.fn)
+			continue
+		}
+		handlers = append(handlers, e.handler)
+	}
+	return handlers
+}
+
 // Len returns the middleware stack length.
 func (s *Stack) Len() int {
-	return len(s.Stack) + len(s.Tail) + len(s.Head)
+	return len(s.items)
+}
+
+// clone returns a copy of the stack.
+func (s *Stack) clone() *Stack {
+	c := &Stack{items: s.entries(), factory: s.factory, counted: s.counted, labeled: s.labeled, traced: s.traced, observers: s.observers}
+	c.update(-1)
+	return c
 }
@@ -1,8 +1,12 @@
 package layer
 
 import (
-	"github.com/nbio/st"
+	"net/http"
+	"reflect"
 	"testing"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/utils.v0"
 )
 
 func TestStack(t *testing.T) {
@@ -23,6 +27,21 @@ func TestStack(t *testing.T) {
 	st.Expect(t, s.Join()[2], tail)
 }
 
+func TestStackDeprecatedFields(t *testing.T) {
+	s := &Stack{}
+	fn := MiddlewareFunc(func(h http.Handler) http.Handler { return h })
+	s.Push(Normal, fn)
+	s.Push(Head, fn)
+	s.Push(PriorityAt(-5), fn)
+	s.Push(Tail, fn)
+	s.Push(PriorityAt(5), fn)
+	st.Expect(t, []int{len(s.Head), len(s.Stack), len(s.Tail)}, []int{2, 1, 2})
+
+	s.remove(func(e *entry) bool { return e.level > NormalLevel })
+	st.Expect(t, []int{len(s.Head), len(s.Stack), len(s.Tail)}, []int{2, 1, 0})
+	st.Expect(t, len(s.clone().Head), 2)
+}
+
 func TestStackMemoization(t *testing.T) {
 	s := &Stack{}
 
@@ -51,3 +70,205 @@ func TestStackMemoization(t *testing.T) {
 	st.Expect(t, s.memo, newMemo)
 	st.Expect(t, s.memo, s.Join())
 }
+
+func TestPriorityLevel(t *testing.T) {
+	st.Expect(t, TopHead.Level(), HeadLevel)
+	st.Expect(t, Head.Level(), HeadLevel)
+	st.Expect(t, Normal.Level(), NormalLevel)
+	st.Expect(t, TopTail.Level(), TailLevel)
+	st.Expect(t, Tail.Level(), TailLevel)
+	st.Expect(t, PriorityAt(-5).Level(), -5)
+	st.Expect(t, PriorityAt(0).Level(), 0)
+	st.Expect(t, PriorityAt(1<<30).Level(), 1<<23)
+	st.Expect(t, PriorityAt(-1<<30).Level(), -1<<23)
+}
+
+func TestStackPriorityAt(t *testing.T) {
+	mw := New()
+	mw.UsePriority(RequestPhase, Tail, orderMiddleware("tail"))
+	mw.UsePriority(RequestPhase, PriorityAt(20), orderMiddleware("20"))
+	mw.UsePriority(RequestPhase, Normal, orderMiddleware("normal"))
+	mw.UsePriority(RequestPhase, PriorityAt(-1500), orderMiddleware("-1500"))
+	mw.UsePriority(RequestPhase, PriorityAt(HeadLevel), orderMiddleware("head-level"))
+	mw.UsePriority(RequestPhase, Head, orderMiddleware("head"))
+	mw.UsePriority(RequestPhase, TopHead, orderMiddleware("top-head"))
+	mw.UsePriority(RequestPhase, PriorityAt(10), orderMiddleware("10"))
+	mw.UsePriority(RequestPhase, PriorityAt(20), orderMiddleware("20-b"))
+	mw.UsePriority(RequestPhase, TopTail, orderMiddleware("top-tail"))
+	mw.Use(AllPhases, orderMiddleware("all"))
+	mw.UsePriority(AllPhases, PriorityAt(15), orderMiddleware("all-15"))
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	st.Expect(t, w.Header()["Order"], []string{
+		"-1500", "top-head", "head-level", "head", "all", "normal",
+		"10", "all-15", "20", "20-b", "top-tail", "tail",
+	})
+}
+
+// registration represents a single handlers registration of the ordering suite.
+type registration struct {
+	phase    string
+	priority Priority
+	names    []string
+}
+
+func TestStackOrdering(t *testing.T) {
+	cases := []struct {
+		name          string
+		registrations []registration
+		expected      []string
+	}{
+		{
+			"normal fifo",
+			[]registration{
+				{RequestPhase, Normal, []string{"a"}},
+				{RequestPhase, Normal, []string{"b", "c"}},
+				{RequestPhase, Normal, []string{"d"}},
+			},
+			[]string{"a", "b", "c", "d"},
+		},
+		{
+			"head and tail fifo",
+			[]registration{
+				{RequestPhase, Tail, []string{"t1"}},
+				{RequestPhase, Head, []string{"h1"}},
+				{RequestPhase, Tail, []string{"t2", "t3"}},
+				{RequestPhase, Head, []string{"h2", "h3"}},
+			},
+			[]string{"h1", "h2", "h3", "t1", "t2", "t3"},
+		},
+		{
+			"top priorities",
+			[]registration{
+				{RequestPhase, Head, []string{"h"}},
+				{RequestPhase, TopHead, []string{"th1", "th2"}},
+				{RequestPhase, TopHead, []string{"th3"}},
+				{RequestPhase, Tail, []string{"t"}},
+				{RequestPhase, TopTail, []string{"tt1", "tt2"}},
+			},
+			[]string{"th3", "th1", "th2", "h", "tt1", "tt2", "t"},
+		},
+		{
+			"numeric levels fifo",
+			[]registration{
+				{RequestPhase, PriorityAt(5), []string{"5a"}},
+				{RequestPhase, PriorityAt(1), []string{"1a"}},
+				{RequestPhase, PriorityAt(5), []string{"5b", "5c"}},
+				{RequestPhase, PriorityAt(NormalLevel), []string{"0a"}},
+				{RequestPhase, Normal, []string{"0b"}},
+			},
+			[]string{"0a", "0b", "1a", "5a", "5b", "5c"},
+		},
+		{
+			"wildcard first within level",
+			[]registration{
+				{RequestPhase, Normal, []string{"a"}},
+				{AllPhases, Normal, []string{"all1"}},
+				{RequestPhase, Head, []string{"h"}},
+				{AllPhases, Normal, []string{"all2"}},
+				{RequestPhase, Normal, []string{"b"}},
+			},
+			[]string{"h", "all1", "all2", "a", "b"},
+		},
+	}
+
+	for _, c := range cases {
+		mw := New()
+		for _, reg := range c.registrations {
+			handlers := make([]interface{}, len(reg.names))
+			for i, name := range reg.names {
+				handlers[i] = orderMiddleware(name)
+			}
+			mw.UsePriority(reg.phase, reg.priority, handlers...)
+		}
+
+		// Run twice to cover the memoized chain too
+		for i := 0; i < 2; i++ {
+			w := utils.NewWriterStub()
+			mw.Run(RequestPhase, w, &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			if got := w.Header()["Order"]; !reflect.DeepEqual(got, c.expected) {
+				t.Errorf("%s: expected order %v, got %v", c.name, c.expected, got)
+			}
+		}
+	}
+}
+
+func TestStackOrderingAfterMutations(t *testing.T) {
+	mw := New()
+	mw.UseNamed(RequestPhase, "a", orderMiddleware("a"))
+	mw.UseNamed(RequestPhase, "b", orderMiddleware("b"))
+	mw.UseNamed(RequestPhase, "c", orderMiddleware("c"))
+	mw.Use(RequestPhase, removableHandler)
+	mw.UseNamed(RequestPhase, "d", orderMiddleware("d"))
+
+	st.Expect(t, mw.Remove(RequestPhase, removableHandler), 1)
+	st.Expect(t, mw.Replace(RequestPhase, "b", orderMiddleware("b2")), nil)
+	st.Expect(t, mw.UseAfter(RequestPhase, "c", orderMiddleware("c2")), nil)
+	mw.UseNamed(RequestPhase, "e", orderMiddleware("e"))
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	st.Expect(t, w.Header()["Order"], []string{"a", "b2", "c", "c2", "d", "e"})
+}
+
+func TestStackIntrospection(t *testing.T) {
+	s := &Stack{}
+	fn := MiddlewareFunc(func(h http.Handler) http.Handler { return h })
+	s.Push(Tail, fn)
+	s.push(Normal, newEntry(removableHandler, AdaptFunc(removableHandler)))
+	s.push(PriorityAt(5), &entry{name: "custom", fn: fn})
+
+	st.Expect(t, s.Len(), 3)
+	st.Expect(t, s.Names(), []string{"layer.removableHandler", "custom", ""})
+	st.Expect(t, s.Levels(), []int{NormalLevel, 5, TailLevel})
+
+	handlers := s.Handlers()
+	st.Expect(t, len(handlers), 3)
+	st.Expect(t, sameHandler(handlers[0], removableHandler), true)
+	st.Expect(t, reflect.ValueOf(handlers[2]).Pointer(), reflect.ValueOf(fn).Pointer())
+
+	st.Expect(t, len(s.HandlersAt(Tail)), 1)
+	st.Expect(t, len(s.HandlersAt(TopTail)), 1)
+	st.Expect(t, len(s.HandlersAt(PriorityAt(5))), 1)
+	st.Expect(t, len(s.HandlersAt(Head)), 0)
+}
+
+// reverseStack implements a middleware stack running the handlers in reverse registration order.
+type reverseStack struct {
+	fns []MiddlewareFunc
+}
+
+func (s *reverseStack) Push(order Priority, h MiddlewareFunc) {
+	s.fns = append([]MiddlewareFunc{h}, s.fns...)
+}
+
+func (s *reverseStack) Join() []MiddlewareFunc {
+	return s.fns
+}
+
+func (s *reverseStack) Len() int {
+	return len(s.fns)
+}
+
+func TestWithStack(t *testing.T) {
+	built := 0
+	mw := New(WithStack(func() MiddlewareStack {
+		built++
+		return &reverseStack{}
+	}))
+	mw.Use(AllPhases, orderMiddleware("all"))
+	mw.UsePriority(RequestPhase, Head, orderMiddleware("a"))
+	mw.Use(RequestPhase, removableHandler)
+	mw.UseNamed(RequestPhase, "b", orderMiddleware("b"))
+	st.Expect(t, mw.Remove(RequestPhase, removableHandler), 1)
+	st.Expect(t, mw.UseBefore(RequestPhase, "b", orderMiddleware("c")), nil)
+
+	for i := 0; i < 2; i++ {
+		w := utils.NewWriterStub()
+		mw.Run(RequestPhase, w, &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		st.Expect(t, w.Header()["Order"], []string{"b", "c", "a", "all"})
+	}
+	st.Expect(t, built, 1)
+	st.Expect(t, mw.Pool[RequestPhase].Len(), 3)
+}
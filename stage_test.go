@@ -0,0 +1,67 @@
+package layer
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/utils.v0"
+)
+
+func headerMiddleware(key, value string) func(http.ResponseWriter, *http.Request, http.Handler) {
+	return func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Header().Set(key, value)
+		h.ServeHTTP(w, r)
+	}
+}
+
+func TestStagePromote(t *testing.T) {
+	mw := New()
+	mw.Use(RequestPhase, headerMiddleware("version", "blue"))
+
+	staged := New()
+	staged.Use(RequestPhase, headerMiddleware("version", "green"))
+	staged.UseFinalHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	mw.Stage(staged)
+	st.Expect(t, mw.Staged(), staged)
+
+	// Live layer keeps serving while the staged one is exercised
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Header().Get("version"), "blue")
+	w = utils.NewWriterStub()
+	mw.Staged().Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Header().Get("version"), "green")
+
+	gen := mw.Generation()
+	st.Expect(t, mw.Promote(), nil)
+	st.Expect(t, mw.Generation(), gen+1)
+	st.Expect(t, mw.Staged(), (*Layer)(nil))
+
+	w = utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Header().Get("version"), "green")
+	st.Expect(t, w.Code, 200)
+
+	// Promoted configuration is decoupled from the staged layer
+	staged.Use(RequestPhase, headerMiddleware("version", "red"))
+	st.Expect(t, mw.Pool[RequestPhase].Len(), 1)
+}
+
+func TestStageAbort(t *testing.T) {
+	mw := New()
+	mw.Use(RequestPhase, headerMiddleware("version", "blue"))
+
+	st.Expect(t, mw.Abort(), ErrNoStagedLayer)
+	st.Expect(t, mw.Promote(), ErrNoStagedLayer)
+
+	mw.Stage(New())
+	st.Expect(t, mw.Abort(), nil)
+	st.Expect(t, mw.Promote(), ErrNoStagedLayer)
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, &http.Request{}, nil)
+	st.Expect(t, w.Header().Get("version"), "blue")
+}
@@ -0,0 +1,123 @@
+package layer
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// State represents the lifecycle state of a request passing through the layer phases.
+//
+// A request lifecycle is modeled as the following state machine:
+//
+//	new → request → [response] → [error] → done
+//
+// Custom phases are considered part of the request state, the error state
+// can be reached from any state but done, and done is a terminal state.
+type State int
+
+const (
+	// StateNew defines a request that has not entered any phase yet.
+	StateNew State = iota
+	// StateRequest defines a request passing through the request or custom phases.
+	StateRequest
+	// StateResponse defines a request passing through the response phase.
+	StateResponse
+	// StateError defines a request passing through the error phase.
+	StateError
+	// StateDone defines a request whose lifecycle has been completed.
+	StateDone
+)
+
+// stateNames stores the human friendly state names.
+var stateNames = map[State]string{
+	StateNew:      "new",
+	StateRequest:  "request",
+	StateResponse: "response",
+	StateError:    "error",
+	StateDone:     "done",
+}
+
+// transitions stores the legal state transitions.
+var transitions = map[State]map[State]bool{
+	StateNew:      {StateRequest: true, StateResponse: true, StateError: true, StateDone: true},
+	StateRequest:  {StateRequest: true, StateResponse: true, StateError: true, StateDone: true},
+	StateResponse: {StateResponse: true, StateError: true, StateDone: true},
+	StateError:    {StateError: true, StateDone: true},
+	StateDone:     {},
+}
+
+// String returns the state name.
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("state(%d)", int(s))
+}
+
+// TransitionError represents an illegal request lifecycle state transition.
+type TransitionError struct {
+	// From stores the current lifecycle state.
+	From State
+	// To stores the requested lifecycle state.
+	To State
+}
+
+// Error returns the error message.
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("vinxi: illegal phase transition from %s to %s", e.From, e.To)
+}
+
+// PhaseState returns the lifecycle state associated with the given phase.
+// Custom phases are considered part of the request state.
+func PhaseState(phase string) State {
+	switch phase {
+	case ErrorPhase:
+		return StateError
+	case ResponsePhase:
+		return StateResponse
+	}
+	return StateRequest
+}
+
+// Transition validates the lifecycle state transition between the given states,
+// returning a *TransitionError if the transition is illegal.
+func Transition(from, to State) error {
+	if transitions[from][to] {
+		return nil
+	}
+	return &TransitionError{From: from, To: to}
+}
+
+// StateOf returns the current lifecycle state of the given request.
+func StateOf(r *http.Request) State {
+	if state, ok := getValue(r, "vinxi.state").(State); ok {
+		return state
+	}
+	return StateNew
+}
+
+// Finish marks the given request lifecycle as done,
+// after which no further phases can be run for it in strict transitions mode.
+func Finish(r *http.Request) {
+	setValue(r, "vinxi.state", StateDone)
+}
+
+// WithStrictTransitions enables or disables enforcing legal request lifecycle
+// state transitions when running phases. Illegal transitions, such as running
+// the request phase from the error phase, trigger the error phase exposing
+// the *TransitionError via the "vinxi.error" context key, unless the error
+// phase itself is illegal, in which case Run panics with it.
+func WithStrictTransitions(strict bool) Option {
+	return func(s *Layer) {
+		s.strictTransitions = strict
+	}
+}
+
+// transition moves the request lifecycle to the given state,
+// panicking with a *TransitionError if the transition is illegal.
+func transition(r *http.Request, to State) {
+	if err := Transition(StateOf(r), to); err != nil {
+		panic(err)
+	}
+	setValue(r, "vinxi.state", to)
+}
@@ -0,0 +1,63 @@
+package layer
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/utils.v0"
+)
+
+func TestTransition(t *testing.T) {
+	st.Expect(t, Transition(StateNew, StateRequest), nil)
+	st.Expect(t, Transition(StateRequest, StateResponse), nil)
+	st.Expect(t, Transition(StateResponse, StateError), nil)
+	st.Expect(t, Transition(StateError, StateDone), nil)
+
+	err := Transition(StateError, StateRequest)
+	st.Expect(t, err, &TransitionError{From: StateError, To: StateRequest})
+	st.Expect(t, err.Error(), "vinxi: illegal phase transition from error to request")
+	st.Reject(t, Transition(StateResponse, StateRequest), nil)
+	st.Reject(t, Transition(StateDone, StateError), nil)
+	st.Expect(t, State(10).String(), "state(10)")
+}
+
+func TestPhaseState(t *testing.T) {
+	st.Expect(t, PhaseState(RequestPhase), StateRequest)
+	st.Expect(t, PhaseState(ErrorPhase), StateError)
+	st.Expect(t, PhaseState("response"), StateResponse)
+	st.Expect(t, PhaseState("custom"), StateRequest)
+}
+
+func TestStrictTransitions(t *testing.T) {
+	mw := New(WithStrictTransitions(true))
+
+	var state State
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		state = StateOf(r)
+		h.ServeHTTP(w, r)
+	})
+
+	req := Attach(&http.Request{})
+	mw.Run(RequestPhase, utils.NewWriterStub(), req, nil)
+	st.Expect(t, state, StateRequest)
+
+	mw.Run(ErrorPhase, utils.NewWriterStub(), req, nil)
+	st.Expect(t, StateOf(req), StateError)
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, req, nil)
+	st.Expect(t, w.Code, 500)
+	st.Expect(t, ErrorOf(req), &TransitionError{From: StateError, To: StateRequest})
+}
+
+func TestStrictTransitionsDone(t *testing.T) {
+	defer func() {
+		st.Expect(t, recover(), &TransitionError{From: StateDone, To: StateError})
+	}()
+
+	mw := New(WithStrictTransitions(true))
+	req := Attach(&http.Request{})
+	Finish(req)
+	mw.Run(ErrorPhase, utils.NewWriterStub(), req, nil)
+}
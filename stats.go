@@ -0,0 +1,221 @@
+package layer
+
+import (
+	"expvar"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets stores the chain latency histogram bucket upper bounds.
+var latencyBuckets = [...]time.Duration{
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// counters stores the layer cumulative counters, accessed atomically.
+type counters struct {
+	defaultFinal uint64
+	customFinal  uint64
+	errorPhase   uint64
+	memoRebuilds uint64
+}
+
+// histogram implements a simple fixed buckets latency histogram,
+// safe for concurrent use without locking. Its counters use the atomic
+// types, which are 64-bit aligned on 32-bit platforms too.
+type histogram struct {
+	sum     atomic.Int64
+	max     atomic.Int64
+	buckets [len(latencyBuckets) + 1]atomic.Uint64
+}
+
+// observe records the given latency in the histogram.
+func (h *histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(latencyBuckets) && d > latencyBuckets[i] {
+		i++
+	}
+	h.buckets[i].Add(1)
+	h.sum.Add(int64(d))
+	for {
+		max := h.max.Load()
+		if int64(d) <= max || h.max.CompareAndSwap(max, int64(d)) {
+			return
+		}
+	}
+}
+
+// snapshot returns a point-in-time copy of the histogram,
+// whose count is consistent with its buckets.
+func (h *histogram) snapshot() histogramSnapshot {
+	c := histogramSnapshot{sum: h.sum.Load(), max: h.max.Load()}
+	for i := range h.buckets {
+		c.buckets[i] = h.buckets[i].Load()
+		c.count += c.buckets[i]
+	}
+	return c
+}
+
+// histogramSnapshot stores a point-in-time copy of a latency histogram.
+type histogramSnapshot struct {
+	count   uint64
+	sum     int64
+	max     int64
+	buckets [len(latencyBuckets) + 1]uint64
+}
+
+// percentile returns the estimated latency percentile, between 0 and 1,
+// as the upper bound of the bucket containing it.
+func (h *histogramSnapshot) percentile(p float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := uint64(p*float64(h.count) + 0.5)
+	if rank == 0 {
+		rank = 1
+	}
+	var cumulative uint64
+	for i, n := range h.buckets {
+		cumulative += n
+		if cumulative >= rank {
+			if i < len(latencyBuckets) && latencyBuckets[i] < time.Duration(h.max) {
+				return latencyBuckets[i]
+			}
+			return time.Duration(h.max)
+		}
+	}
+	return time.Duration(h.max)
+}
+
+// LatencyStats stores the chain latency statistics.
+// Percentiles are estimated from a fixed buckets histogram,
+// reporting the upper bound of the bucket containing the percentile.
+type LatencyStats struct {
+	Count uint64
+	Mean  time.Duration
+	Max   time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+}
+
+// Stats stores the layer cumulative statistics since its creation.
+type Stats struct {
+	// Runs stores the number of runs per phase.
+	Runs map[string]uint64
+	// DefaultFinalHandler stores the number of default final handler invocations.
+	DefaultFinalHandler uint64
+	// CustomFinalHandler stores the number of invocations of final handlers passed to Run.
+	CustomFinalHandler uint64
+	// ErrorPhase stores the number of error phase activations.
+	ErrorPhase uint64
+	// MemoRebuilds stores the number of memoized chain rebuilds.
+	MemoRebuilds uint64
+	// SkippedRuns stores the number of runs skipped due to already committed responses.
+	SkippedRuns uint64
+	// Latency stores the Run latency statistics.
+	Latency LatencyStats
+	// Panics stores the recovered panic counters.
+	Panics PanicStats
+}
+
+// Stats returns the layer cumulative statistics since its creation.
+func (s *Layer) Stats() Stats {
+	stats := Stats{
+		DefaultFinalHandler: atomic.LoadUint64(&s.counters.defaultFinal),
+		CustomFinalHandler:  atomic.LoadUint64(&s.counters.customFinal),
+		ErrorPhase:          atomic.LoadUint64(&s.counters.errorPhase),
+		MemoRebuilds:        atomic.LoadUint64(&s.counters.memoRebuilds),
+		SkippedRuns:         s.SkippedRuns(),
+		Panics:              s.Panics(),
+	}
+
+	stats.Runs = make(map[string]uint64)
+	s.runs.Range(func(phase, n interface{}) bool {
+		stats.Runs[phase.(string)] = atomic.LoadUint64(n.(*uint64))
+		return true
+	})
+
+	h := s.latency.snapshot()
+	stats.Latency = LatencyStats{
+		Count: h.count,
+		Max:   time.Duration(h.max),
+		P50:   h.percentile(0.5),
+		P90:   h.percentile(0.9),
+		P99:   h.percentile(0.99),
+	}
+	if h.count > 0 {
+		stats.Latency.Mean = time.Duration(h.sum / int64(h.count))
+	}
+	return stats
+}
+
+// PublishExpvar publishes the layer statistics, including the recovered
+// panic counters, as expvar variable with the given name, exposing them
+// via the expvar debug endpoint.
+// Like expvar.Publish, it panics if the name is already registered.
+func (s *Layer) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return s.Stats()
+	}))
+}
+
+// WithMiddlewareStats enables or disables counting the calls of every
+// registered middleware, exposed via Describe.
+// Counting adds an atomic increment per middleware call, so it's disabled by default.
+func WithMiddlewareStats(enabled bool) Option {
+	return func(s *Layer) {
+		s.middlewareStats = enabled
+	}
+}
+
+// middleware returns the entry middleware function, decorated accordingly
+// to the given stack: traced, tagged with profiler labels, observed and counted, if enabled.
+func (e *entry) middleware(s *Stack) MiddlewareFunc {
+	fn := e.fn
+	if s.traced {
+		fn = e.trace(fn)
+	}
+	if s.labeled {
+		fn = e.profile(fn)
+	}
+	if len(s.observers) > 0 {
+		fn = e.observe(fn, s.observers)
+	}
+	if !s.counted {
+		return fn
+	}
+	return func(next http.Handler) http.Handler {
+		h := fn(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddUint64(&e.calls, 1)
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// recordRun records a phase run and its latency, using atomic counters only,
+// so concurrent runs are never serialized.
+func (s *Layer) recordRun(phase string, latency time.Duration) {
+	n, ok := s.runs.Load(phase)
+	if !ok {
+		n, _ = s.runs.LoadOrStore(phase, new(uint64))
+	}
+	atomic.AddUint64(n.(*uint64), 1)
+	s.latency.observe(latency)
+}
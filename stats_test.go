@@ -0,0 +1,95 @@
+package layer
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/utils.v0"
+)
+
+func TestStats(t *testing.T) {
+	mw := New()
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		h.ServeHTTP(w, r)
+	})
+	mw.Use("panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	mw.Run(RequestPhase, utils.NewWriterStub(), &http.Request{}, nil)
+	mw.Run(RequestPhase, utils.NewWriterStub(), &http.Request{}, final)
+	mw.Run(RequestPhase, utils.NewWriterStub(), &http.Request{}, final)
+	mw.Run("panic", utils.NewWriterStub(), &http.Request{}, nil)
+
+	stats := mw.Stats()
+	st.Expect(t, stats.Runs, map[string]uint64{"request": 3, "panic": 1})
+	st.Expect(t, stats.DefaultFinalHandler, uint64(1))
+	st.Expect(t, stats.CustomFinalHandler, uint64(2))
+	st.Expect(t, stats.ErrorPhase, uint64(1))
+	st.Expect(t, stats.MemoRebuilds, uint64(2))
+	st.Expect(t, stats.Panics.Total, uint64(1))
+	st.Expect(t, stats.Latency.Count, uint64(4))
+	st.Expect(t, stats.Latency.P50 <= stats.Latency.P99, true)
+}
+
+func TestStatsConcurrentRuns(t *testing.T) {
+	mw := New()
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				mw.Run(RequestPhase, utils.NewWriterStub(), &http.Request{}, final)
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := mw.Stats()
+	st.Expect(t, stats.Runs, map[string]uint64{"request": 400})
+	st.Expect(t, stats.Latency.Count, uint64(400))
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	h := &histogram{}
+	empty := h.snapshot()
+	st.Expect(t, empty.percentile(0.5), time.Duration(0))
+
+	for i := 0; i < 90; i++ {
+		h.observe(time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		h.observe(time.Minute)
+	}
+
+	snap := h.snapshot()
+	st.Expect(t, snap.percentile(0.5), time.Millisecond)
+	st.Expect(t, snap.percentile(0.9), time.Millisecond)
+	st.Expect(t, snap.percentile(0.99), time.Minute)
+	st.Expect(t, time.Duration(snap.max), time.Minute)
+	st.Expect(t, snap.count, uint64(100))
+}
+
+func TestPublishExpvar(t *testing.T) {
+	mw := New()
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+	mw.Run(RequestPhase, utils.NewWriterStub(), &http.Request{}, nil)
+
+	mw.PublishExpvar("layer_test_stats")
+
+	var stats Stats
+	st.Expect(t, json.Unmarshal([]byte(expvar.Get("layer_test_stats").String()), &stats), nil)
+	st.Expect(t, stats.Runs, map[string]uint64{"request": 1})
+	st.Expect(t, stats.Panics.Middleware, map[string]uint64{"request[0]": 1})
+}
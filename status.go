@@ -0,0 +1,135 @@
+package layer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+// StatusError represents a server error response written by a request phase handler,
+// which is intercepted and exposed to the error phase via ErrorOf
+// when the layer is configured via WithStatusErrors.
+//
+// If no error phase middleware replies, the intercepted response is written to the client.
+type StatusError struct {
+	// Code stores the intercepted response status code.
+	Code int
+	// Header stores the intercepted response headers.
+	Header http.Header
+	// Body stores the intercepted response body.
+	Body []byte
+}
+
+// Error returns the error message.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("vinxi: server error response with status %d", e.Code)
+}
+
+// writeTo writes the intercepted response to the given writer.
+func (e *StatusError) writeTo(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+	for k, v := range e.Header {
+		header[k] = append([]string(nil), v...)
+	}
+	w.WriteHeader(e.Code)
+	w.Write(e.Body)
+}
+
+// WithStatusErrors enables or disables triggering the error phase when a request
+// phase handler, such as the final handler, replies with a 5xx status code.
+// The response is intercepted and exposed as *StatusError via ErrorOf,
+// so the error phase can reply with a custom error page instead.
+func WithStatusErrors(enabled bool) Option {
+	return func(s *Layer) {
+		s.statusErrors = enabled
+	}
+}
+
+// statusInterceptor implements an http.ResponseWriter intercepting 5xx responses.
+type statusInterceptor struct {
+	http.ResponseWriter
+	response *ResponseBuffer
+}
+
+// Unwrap returns the wrapped response writer.
+func (i *statusInterceptor) Unwrap() http.ResponseWriter {
+	return i.ResponseWriter
+}
+
+// Header returns the response headers, or the intercepted ones.
+func (i *statusInterceptor) Header() http.Header {
+	if i.response != nil {
+		return i.response.header
+	}
+	return i.ResponseWriter.Header()
+}
+
+// WriteHeader writes the response status code, intercepting 5xx ones.
+func (i *statusInterceptor) WriteHeader(code int) {
+	if i.response != nil {
+		return
+	}
+	if code < 500 {
+		i.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	// Move the headers written so far to the intercepted response
+	i.response = NewResponseBuffer()
+	i.response.code = code
+	header := i.ResponseWriter.Header()
+	for k, v := range header {
+		i.response.header[k] = v
+		delete(header, k)
+	}
+}
+
+// Write writes the response body, buffering it if intercepted.
+func (i *statusInterceptor) Write(b []byte) (int, error) {
+	if i.response != nil {
+		return i.response.body.Write(b)
+	}
+	return i.ResponseWriter.Write(b)
+}
+
+// Flush sends any buffered data to the client, unless intercepted.
+func (i *statusInterceptor) Flush() {
+	if i.response == nil {
+		flush(i.ResponseWriter)
+	}
+}
+
+// Hijack lets the caller take over the connection, if supported by the underlying writer.
+func (i *statusInterceptor) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hijack(i.ResponseWriter)
+}
+
+// Push initiates an HTTP/2 server push, if supported by the underlying writer.
+func (i *statusInterceptor) Push(target string, opts *http.PushOptions) error {
+	return push(i.ResponseWriter, target, opts)
+}
+
+// CloseNotify returns a channel notifying when the client connection has gone away,
+// if supported by the underlying writer.
+func (i *statusInterceptor) CloseNotify() <-chan bool {
+	return closeNotify(i.ResponseWriter)
+}
+
+// ReadFrom reads data from the given reader and writes it to the response body,
+// buffering it if intercepted.
+func (i *statusInterceptor) ReadFrom(r io.Reader) (int64, error) {
+	if i.response != nil {
+		return i.response.body.ReadFrom(r)
+	}
+	return readFrom(i.ResponseWriter, r)
+}
+
+// err returns the intercepted response as *StatusError, if any.
+func (i *statusInterceptor) err() error {
+	if i.response == nil {
+		return nil
+	}
+	return &StatusError{Code: i.response.code, Header: i.response.header, Body: i.response.body.Bytes()}
+}
@@ -0,0 +1,61 @@
+package layer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func failingHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(503)
+	w.Write([]byte("unavailable"))
+}
+
+func TestStatusErrors(t *testing.T) {
+	var serr *StatusError
+	mw := New(WithStatusErrors(true))
+	mw.Use(ErrorPhase, func(w http.ResponseWriter, r *http.Request) {
+		serr = ErrorOf(r).(*StatusError)
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(serr.Code)
+		w.Write([]byte("<h1>Service Unavailable</h1>"))
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run(RequestPhase, w, httptest.NewRequest("GET", "/", nil), http.HandlerFunc(failingHandler))
+	st.Expect(t, w.Code, 503)
+	st.Expect(t, w.Header().Get("Content-Type"), "text/html")
+	st.Expect(t, w.Body.String(), "<h1>Service Unavailable</h1>")
+	st.Expect(t, serr.Header.Get("Content-Type"), "text/plain")
+	st.Expect(t, string(serr.Body), "unavailable")
+}
+
+func TestStatusErrorsReplay(t *testing.T) {
+	var alerted bool
+	mw := New(WithStatusErrors(true))
+	mw.Use(ErrorPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		alerted = true
+		h.ServeHTTP(w, r)
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run(RequestPhase, w, httptest.NewRequest("GET", "/", nil), http.HandlerFunc(failingHandler))
+	st.Expect(t, alerted, true)
+	st.Expect(t, w.Code, 503)
+	st.Expect(t, w.Header().Get("Content-Type"), "text/plain")
+	st.Expect(t, w.Body.String(), "unavailable")
+}
+
+func TestStatusErrorsDisabled(t *testing.T) {
+	mw := New()
+	mw.Use(ErrorPhase, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("error phase must not be triggered")
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run(RequestPhase, w, httptest.NewRequest("GET", "/", nil), http.HandlerFunc(failingHandler))
+	st.Expect(t, w.Code, 503)
+}
@@ -0,0 +1,55 @@
+package layer
+
+import "net/http"
+
+// SetSubLayer attaches the given layer to the request as sub-layer override.
+// This allows upstream components, such as routers or tenant resolvers,
+// to define per-route or per-tenant middleware without the outer layer
+// knowing about routing.
+//
+// When a layer runs a phase for the request, the sub-layer is consulted
+// once the outer phase chain has completed, right before the final handler,
+// following these precedence rules:
+//
+//   - The outer layer middleware run first, then the sub-layer middleware
+//     registered for the same phase, then the final handler passed to Run.
+//   - The sub-layer final handler and parent layer are ignored.
+//   - The sub-layer can be attached by a middleware of the outer phase chain,
+//     since it is looked up when the end of the outer chain is reached.
+//   - Panics in the sub-layer chain are handled by the outer layer.
+//   - A layer never delegates to itself.
+//
+// The sub-layer is stored in the request storage, so requests attached
+// outside of the layer must be attached beforehand, see Attach.
+func SetSubLayer(r *http.Request, sub *Layer) {
+	setLocal(r, "vinxi.sublayer", sub)
+}
+
+// SubLayer returns the sub-layer attached to the given request, if any.
+func SubLayer(r *http.Request) *Layer {
+	sub, _ := getValue(r, "vinxi.sublayer").(*Layer)
+	return sub
+}
+
+// delegate wraps the given final handler to run the request sub-layer chain
+// for the current phase, if any, before calling the final handler.
+// It's called by the dispatcher once the end of the chain is reached.
+func (c *chain) delegate(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sub := SubLayer(r)
+		if sub == nil || sub == c.layer {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		snap, _ := sub.snapshot(c.phase)
+		if len(snap.queue) == 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		d := newDispatcher(snap.queue, h)
+		d.phase, d.position = c.phase, positionFor(r)
+		d.ServeHTTP(w, r)
+	})
+}
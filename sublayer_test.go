@@ -0,0 +1,91 @@
+package layer
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/utils.v0"
+)
+
+func TestSubLayer(t *testing.T) {
+	var order []string
+	record := func(name string) interface{} {
+		return func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+			order = append(order, name)
+			h.ServeHTTP(w, r)
+		}
+	}
+
+	route := New()
+	route.Use(RequestPhase, record("route"))
+	route.UseFinalHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("sub-layer final handler must not be called")
+	}))
+
+	mw := New()
+	mw.Use(RequestPhase, record("outer"))
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		// Router-like middleware attaching the sub-layer late
+		SetSubLayer(r, route)
+		h.ServeHTTP(w, r)
+	})
+	mw.Use(RequestPhase, record("outer-tail"))
+
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "final")
+	})
+	mw.Run(RequestPhase, utils.NewWriterStub(), &http.Request{}, final)
+
+	st.Expect(t, order, []string{"outer", "outer-tail", "route", "final"})
+	st.Expect(t, SubLayer(&http.Request{}), (*Layer)(nil))
+}
+
+func TestSubLayerUndefinedPhase(t *testing.T) {
+	route := New()
+	route.Use("other", func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("undefined phase must not be delegated")
+	})
+
+	req := Attach(&http.Request{})
+	SetSubLayer(req, route)
+
+	w := utils.NewWriterStub()
+	New().Run(RequestPhase, w, req, nil)
+	st.Expect(t, w.Code, 502)
+}
+
+func TestSubLayerPanic(t *testing.T) {
+	route := New()
+	route.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+
+	mw := New()
+	mw.Use(ErrorPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Header().Set("error", "outer")
+		h.ServeHTTP(w, r)
+	})
+
+	req := Attach(&http.Request{})
+	SetSubLayer(req, route)
+
+	w := utils.NewWriterStub()
+	mw.Run(RequestPhase, w, req, nil)
+	st.Expect(t, w.Code, 500)
+	st.Expect(t, w.Header().Get("error"), "outer")
+}
+
+func TestSubLayerSelf(t *testing.T) {
+	calls := 0
+	mw := New()
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		calls++
+		h.ServeHTTP(w, r)
+	})
+
+	req := Attach(&http.Request{})
+	SetSubLayer(req, mw)
+	mw.Run(RequestPhase, utils.NewWriterStub(), req, nil)
+	st.Expect(t, calls, 1)
+}
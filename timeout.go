@@ -0,0 +1,309 @@
+package layer
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WithPhaseTimeout defines the maximum duration of the middleware chain of the given phase,
+// excluding the final handler. Once exceeded, the request context is cancelled,
+// the remaining chain is skipped and the error phase is triggered, exposing
+// context.DeadlineExceeded via ErrorOf.
+//
+// The deadline is enforced on the running middleware handler, even if it ignores
+// the request context: the chain runs in its own goroutine and, once exceeded,
+// the error phase replies while the abandoned handler keeps running in background,
+// its subsequent writes being discarded. Handlers should still honor the request
+// context to release their resources early.
+//
+// The deadline is no longer enforced once a middleware handler writes the response
+// or the final handler is reached, which runs with the request context prior to
+// the phase deadline. The error phase cannot be limited.
+func WithPhaseTimeout(phase string, timeout time.Duration) Option {
+	return func(s *Layer) {
+		if s.timeouts == nil {
+			s.timeouts = make(map[string]time.Duration)
+		}
+		s.timeouts[phase] = timeout
+	}
+}
+
+// WithFinalTimeout defines the maximum duration of the final handler of every phase,
+// except the error phase. Once exceeded, the request context is cancelled and, once
+// the final handler returns, the error phase is triggered, exposing
+// context.DeadlineExceeded via ErrorOf.
+func WithFinalTimeout(timeout time.Duration) Option {
+	return func(s *Layer) {
+		s.finalTimeout = timeout
+	}
+}
+
+// deadline wraps the given final handler to run it with the request context
+// prior to the phase deadline, limited by the final handler timeout, if any.
+func (c *chain) deadline(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if c.base != nil {
+			ctx = c.base
+		}
+		if c.finalTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, c.finalTimeout)
+			defer cancel()
+		}
+
+		h.ServeHTTP(w, withContext(r, ctx))
+		if err := ctx.Err(); err == context.DeadlineExceeded {
+			panic(returnedError{err})
+		}
+	})
+}
+
+// passTimeout wraps the given final handler to pass the given timeout writer
+// before calling it, so the phase deadline is no longer enforced.
+func passTimeout(tw *timeoutWriter, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tw.pass() {
+			h.ServeHTTP(w, r)
+		}
+	})
+}
+
+// enforce dispatches the given chain in its own goroutine, writing the response
+// via the given timeout writer, and triggers the error phase once the phase
+// deadline is exceeded, unless the writer already passed.
+func (c *chain) enforce(d *dispatcher, tw *timeoutWriter, r *http.Request) {
+	// The abandoned goroutine must not race on the shared chain position
+	shared := d.position
+	if shared != nil {
+		local := *shared
+		d.position = &local
+	}
+
+	done := make(chan interface{}, 1)
+	go func() {
+		defer func() { done <- recover() }()
+		d.ServeHTTP(NewResponseWriter(tw), r)
+	}()
+
+	select {
+	case re := <-done:
+		if shared != nil {
+			*shared = *d.position
+		}
+		if re != nil {
+			panic(re)
+		}
+		return
+	case <-c.ctx.Done():
+	}
+
+	// The handler already passed, so the chain must be completed by it
+	if !tw.expire() {
+		re := <-done
+		if shared != nil {
+			*shared = *d.position
+		}
+		if re != nil {
+			panic(re)
+		}
+		return
+	}
+	panic(returnedError{c.ctx.Err()})
+}
+
+// UseWithTimeout registers a new handler for the given phase limited to the given timeout.
+//
+// The handler runs in its own goroutine with a cancellable request context, and
+// its budget only covers the time until it calls the next handler or writes the
+// response. Once exceeded, the request context passed to the handler is cancelled,
+// its subsequent writes are discarded and the chain continues without it,
+// calling the given fallback middleware instead, if not nil.
+//
+// Registrable handlers are not supported.
+func (s *Layer) UseWithTimeout(phase string, timeout time.Duration, handler interface{}, fallback interface{}) {
+	var fb MiddlewareFunc
+	if !isNil(fallback) {
+		if fb = AdaptFunc(fallback); fb == nil {
+			panic("vinxi: unsupported middleware interface")
+		}
+	}
+	s.useWith(phase, Normal, func(mw MiddlewareFunc) MiddlewareFunc {
+		return func(h http.Handler) http.Handler {
+			return &timeoutHandler{mw: mw, next: h, fallback: fb, timeout: timeout}
+		}
+	}, handler)
+}
+
+// timeoutHandler runs a middleware handler limited to a timeout.
+type timeoutHandler struct {
+	mw       MiddlewareFunc
+	next     http.Handler
+	fallback MiddlewareFunc
+	timeout  time.Duration
+}
+
+// ServeHTTP runs the middleware handler, continuing the chain if it times out.
+func (t *timeoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	tw := newTimeoutWriter(w)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tw.pass() {
+			t.next.ServeHTTP(w, r)
+		}
+	})
+
+	done := make(chan interface{}, 1)
+	go func() {
+		defer func() { done <- recover() }()
+		t.mw(next).ServeHTTP(NewResponseWriter(tw), withContext(r, ctx))
+	}()
+
+	timer := time.NewTimer(t.timeout)
+	defer timer.Stop()
+
+	select {
+	case re := <-done:
+		if re != nil {
+			panic(re)
+		}
+		return
+	case <-timer.C:
+	}
+
+	// The handler already passed, so the chain must be completed by it
+	if !tw.expire() {
+		if re := <-done; re != nil {
+			panic(re)
+		}
+		return
+	}
+
+	cancel()
+	if t.fallback != nil {
+		t.fallback(t.next).ServeHTTP(w, r)
+		return
+	}
+	t.next.ServeHTTP(w, r)
+}
+
+// timeoutWriter isolates the response writer used by a middleware handler limited
+// to a timeout until it passes, which happens when it calls the next handler or
+// writes the response. Writes after expiration are discarded.
+// It cannot be unwrapped, since it would break the isolation.
+type timeoutWriter struct {
+	mutex   sync.Mutex
+	w       http.ResponseWriter
+	header  http.Header
+	passed  bool
+	expired bool
+}
+
+// newTimeoutWriter creates a new timeout writer for the given response writer.
+func newTimeoutWriter(w http.ResponseWriter) *timeoutWriter {
+	header := make(http.Header, len(w.Header()))
+	for k, v := range w.Header() {
+		header[k] = append([]string(nil), v...)
+	}
+	return &timeoutWriter{w: w, header: header}
+}
+
+// pass marks the writer as passed, flushing the isolated headers into
+// the response writer, unless it's already expired.
+func (t *timeoutWriter) pass() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.expired {
+		return false
+	}
+	if !t.passed {
+		t.passed = true
+		header := t.w.Header()
+		for k := range header {
+			delete(header, k)
+		}
+		for k, v := range t.header {
+			header[k] = v
+		}
+	}
+	return true
+}
+
+// expire marks the writer as expired, unless it's already passed.
+func (t *timeoutWriter) expire() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.passed {
+		return false
+	}
+	t.expired = true
+	return true
+}
+
+// Header returns the isolated headers, or the response writer ones once passed.
+func (t *timeoutWriter) Header() http.Header {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.passed {
+		return t.w.Header()
+	}
+	return t.header
+}
+
+// Write writes the response body, unless the writer is expired.
+func (t *timeoutWriter) Write(b []byte) (int, error) {
+	if !t.pass() {
+		return 0, http.ErrHandlerTimeout
+	}
+	return t.w.Write(b)
+}
+
+// WriteHeader writes the response status code, unless the writer is expired.
+func (t *timeoutWriter) WriteHeader(code int) {
+	if t.pass() {
+		t.w.WriteHeader(code)
+	}
+}
+
+// Flush sends any buffered data to the client, if supported by the underlying writer.
+func (t *timeoutWriter) Flush() {
+	if t.pass() {
+		flush(t.w)
+	}
+}
+
+// Hijack lets the caller take over the connection, if supported by the underlying writer,
+// unless the writer is expired.
+func (t *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if !t.pass() {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	return hijack(t.w)
+}
+
+// Push initiates an HTTP/2 server push, if supported by the underlying writer.
+func (t *timeoutWriter) Push(target string, opts *http.PushOptions) error {
+	return push(t.w, target, opts)
+}
+
+// CloseNotify returns a channel notifying when the client connection has gone away,
+// if supported by the underlying writer.
+func (t *timeoutWriter) CloseNotify() <-chan bool {
+	return closeNotify(t.w)
+}
+
+// ReadFrom reads data from the given reader and writes it to the response body,
+// unless the writer is expired.
+func (t *timeoutWriter) ReadFrom(r io.Reader) (int64, error) {
+	if !t.pass() {
+		return 0, http.ErrHandlerTimeout
+	}
+	return readFrom(t.w, r)
+}
@@ -0,0 +1,141 @@
+package layer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+)
+
+func TestPhaseTimeout(t *testing.T) {
+	var calls int32
+	mw := New(WithPhaseTimeout(RequestPhase, 10*time.Millisecond))
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		atomic.AddInt32(&calls, 1)
+		<-r.Context().Done()
+		h.ServeHTTP(w, r)
+	})
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		atomic.AddInt32(&calls, 1)
+		h.ServeHTTP(w, r)
+	})
+	mw.Use(ErrorPhase, func(w http.ResponseWriter, r *http.Request) {
+		st.Expect(t, ErrorOf(r), context.DeadlineExceeded)
+		st.Expect(t, r.Context().Err(), nil)
+		w.WriteHeader(504)
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run(RequestPhase, w, httptest.NewRequest("GET", "/", nil), nil)
+	st.Expect(t, atomic.LoadInt32(&calls), int32(1))
+	st.Expect(t, w.Code, 504)
+}
+
+func TestPhaseTimeoutIgnoredContext(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	mw := New(WithPhaseTimeout(RequestPhase, 10*time.Millisecond))
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Header().Set("X-Foo", "foo")
+		<-release
+		w.WriteHeader(200)
+	})
+	mw.Use(ErrorPhase, func(w http.ResponseWriter, r *http.Request) {
+		st.Expect(t, ErrorOf(r), context.DeadlineExceeded)
+		w.WriteHeader(504)
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run(RequestPhase, w, httptest.NewRequest("GET", "/", nil), nil)
+	st.Expect(t, w.Code, 504)
+	st.Expect(t, w.Header().Get("X-Foo"), "")
+}
+
+func TestPhaseTimeoutFinalHandler(t *testing.T) {
+	mw := New(WithPhaseTimeout(RequestPhase, 10*time.Millisecond))
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		h.ServeHTTP(w, r)
+	})
+
+	// The final handler is not limited by the phase timeout
+	w := httptest.NewRecorder()
+	mw.Run(RequestPhase, w, httptest.NewRequest("GET", "/", nil), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		st.Expect(t, r.Context().Err(), nil)
+		w.WriteHeader(204)
+	}))
+	st.Expect(t, w.Code, 204)
+}
+
+func TestFinalTimeout(t *testing.T) {
+	mw := New(WithFinalTimeout(10 * time.Millisecond))
+	mw.Use(ErrorPhase, func(w http.ResponseWriter, r *http.Request) {
+		st.Expect(t, ErrorOf(r), context.DeadlineExceeded)
+		w.WriteHeader(504)
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run(RequestPhase, w, httptest.NewRequest("GET", "/", nil), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	st.Expect(t, w.Code, 504)
+}
+
+func TestUseWithTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	mw := New()
+	mw.UseWithTimeout(RequestPhase, 10*time.Millisecond, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Header().Set("slow", "true")
+		<-r.Context().Done()
+		<-release
+		h.ServeHTTP(w, r)
+	}, nil)
+	mw.Use(RequestPhase, headerMiddleware("next", "true"))
+
+	w := httptest.NewRecorder()
+	mw.Run(RequestPhase, w, httptest.NewRequest("GET", "/", nil), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	}))
+	st.Expect(t, w.Code, 204)
+	st.Expect(t, w.Header().Get("slow"), "")
+	st.Expect(t, w.Header().Get("next"), "true")
+}
+
+func TestUseWithTimeoutFallback(t *testing.T) {
+	mw := New()
+	mw.UseWithTimeout(RequestPhase, 10*time.Millisecond, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		w.WriteHeader(200)
+	}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(503)
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run(RequestPhase, w, httptest.NewRequest("GET", "/", nil), nil)
+	st.Expect(t, w.Code, 503)
+}
+
+func TestUseWithTimeoutInBudget(t *testing.T) {
+	mw := New()
+	mw.UseWithTimeout(RequestPhase, 10*time.Millisecond, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.Header().Set("fast", "true")
+		h.ServeHTTP(w, r)
+	}, nil)
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request) {
+		// Downstream handlers are not limited by the timeout
+		time.Sleep(30 * time.Millisecond)
+		panic("oops")
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run(RequestPhase, w, httptest.NewRequest("GET", "/", nil), nil)
+	st.Expect(t, w.Code, 500)
+	st.Expect(t, w.Header().Get("fast"), "true")
+	st.Expect(t, mw.Panics().Middleware["request[1]"], uint64(1))
+}
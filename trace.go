@@ -0,0 +1,137 @@
+package layer
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TraceEntry represents a middleware handler execution recorded
+// in the request execution trace. See WithRequestTrace.
+type TraceEntry struct {
+	// Phase stores the phase running the handler.
+	Phase string
+	// Name stores the middleware name, if any.
+	Name string
+	// Start stores the time the handler was called.
+	Start time.Time
+	// Duration stores the handler execution time, including the handlers
+	// called after it, or zero if the handler is still running.
+	Duration time.Duration
+	// Wrote reports whether the handler wrote the response,
+	// excluding the writes of the handlers called after it.
+	Wrote bool
+}
+
+// requestTrace stores the request execution trace.
+type requestTrace struct {
+	mutex   sync.Mutex
+	entries []TraceEntry
+	// states stores the recording state of every trace entry.
+	states []traceState
+}
+
+// traceState stores the recording state of a trace entry.
+type traceState struct {
+	// running defines if the handler is still running.
+	running bool
+	// committed defines if the response was committed before calling the handler.
+	committed bool
+	// forwarded defines if the handler called the next one.
+	forwarded bool
+}
+
+// WithRequestTrace enables or disables recording an ordered trace of the
+// middleware handlers executed for every request, retrievable via
+// TraceFromRequest, so error middleware and access logs can report
+// exactly which middleware ran for the request.
+//
+// The trace is kept in the request storage only, never exposed via the vinxi
+// context storage, so the request must be attached beforehand to retrieve it
+// once Run returns, see Attach. Disabled by default.
+func WithRequestTrace(enabled bool) Option {
+	return func(s *Layer) {
+		s.requestTrace = enabled
+	}
+}
+
+// TraceFromRequest returns the ordered execution trace recorded for the given
+// request, or nil if none. See WithRequestTrace.
+func TraceFromRequest(r *http.Request) []TraceEntry {
+	t, ok := getValue(r, "vinxi.trace").(*requestTrace)
+	if !ok {
+		return nil
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]TraceEntry(nil), t.entries...)
+}
+
+// traceFor returns the request execution trace, creating it if necessary.
+func traceFor(r *http.Request) *requestTrace {
+	if t, ok := getValue(r, "vinxi.trace").(*requestTrace); ok {
+		return t
+	}
+	t := &requestTrace{}
+	setLocal(r, "vinxi.trace", t)
+	return t
+}
+
+// start records the given trace entry, returning its position.
+func (t *requestTrace) start(e TraceEntry, committed bool) int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.entries = append(t.entries, e)
+	t.states = append(t.states, traceState{running: true, committed: committed})
+	return len(t.entries) - 1
+}
+
+// forward records the innermost running handler calling the next one,
+// reporting whether the response is committed until then.
+func (t *requestTrace) forward(committed bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for i := len(t.states) - 1; i >= 0; i-- {
+		state := &t.states[i]
+		if !state.running {
+			continue
+		}
+		if !state.forwarded {
+			state.forwarded = true
+			t.entries[i].Wrote = !state.committed && committed
+		}
+		return
+	}
+}
+
+// end completes the trace entry at the given position,
+// reporting whether the response is committed once the handler returned.
+func (t *requestTrace) end(index int, committed bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	state := &t.states[index]
+	state.running = false
+	t.entries[index].Duration = time.Since(t.entries[index].Start)
+	if !state.forwarded {
+		t.entries[index].Wrote = !state.committed && committed
+	}
+}
+
+// trace wraps the given middleware function recording its execution in the request trace.
+// The running phase is taken from the request chain position.
+func (e *entry) trace(fn MiddlewareFunc) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		h := fn(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			traceFor(r).forward(committed(w))
+			next.ServeHTTP(w, r)
+		}))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t := traceFor(r)
+			index := t.start(TraceEntry{Phase: positionFor(r).phase, Name: e.name, Start: time.Now()}, committed(w))
+			defer func() {
+				t.end(index, committed(w))
+			}()
+			h.ServeHTTP(w, r)
+		})
+	}
+}
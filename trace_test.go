@@ -0,0 +1,74 @@
+package layer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/context.v0"
+)
+
+func traceNames(trace []TraceEntry) []string {
+	names := make([]string, len(trace))
+	for i, e := range trace {
+		names[i] = e.Phase + ":" + e.Name
+	}
+	return names
+}
+
+func TestWithRequestTrace(t *testing.T) {
+	var trace []TraceEntry
+	mw := New(WithRequestTrace(true))
+	mw.UseNamed("request", "foo", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		time.Sleep(time.Millisecond)
+		h.ServeHTTP(w, r)
+	})
+	mw.UseNamed("request", "deny", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.WriteHeader(401)
+	})
+	mw.UseNamed("request", "unreached", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		h.ServeHTTP(w, r)
+	})
+	mw.UseNamed("response", "log", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		trace = TraceFromRequest(r)
+		h.ServeHTTP(w, r)
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run("request", w, &http.Request{}, nil)
+	st.Expect(t, w.Code, 401)
+	st.Expect(t, traceNames(trace), []string{"request:foo", "request:deny", "response:log"})
+	st.Expect(t, trace[0].Duration >= time.Millisecond, true)
+	st.Expect(t, trace[0].Wrote, false)
+	st.Expect(t, trace[1].Wrote, true)
+	st.Expect(t, trace[2].Duration, time.Duration(0))
+}
+
+func TestRequestTraceStorage(t *testing.T) {
+	defer func(legacy bool) { LegacyContext = legacy }(LegacyContext)
+	LegacyContext = true
+
+	mw := New(WithRequestTrace(true))
+	mw.UseNamed("request", "foo", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		h.ServeHTTP(w, r)
+	})
+
+	req := &http.Request{}
+	defer context.Clear(req)
+	attached := Attach(req)
+	mw.Run("request", httptest.NewRecorder(), attached, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	st.Expect(t, traceNames(TraceFromRequest(attached)), []string{"request:foo"})
+	st.Expect(t, context.Get(req, "vinxi.trace"), nil)
+	st.Expect(t, TraceFromRequest(req), []TraceEntry(nil))
+}
+
+func TestRequestTraceDisabled(t *testing.T) {
+	mw := New()
+	mw.UseNamed("request", "foo", func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		st.Expect(t, TraceFromRequest(r), []TraceEntry(nil))
+		h.ServeHTTP(w, r)
+	})
+	mw.Run("request", httptest.NewRecorder(), &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+}
@@ -0,0 +1,58 @@
+// Package kafkatransport implements a layer.Transport receiving the layer
+// commands published on a Kafka topic, kept apart from the layer package
+// so its dependency is only required when used:
+//
+//	reader := kafka.NewReader(kafka.ReaderConfig{
+//		Brokers: []string{"localhost:9092"},
+//		Topic:   "gateway.layer",
+//	})
+//	transport := kafkatransport.New(reader)
+//	defer transport.Close()
+//	go mw.Subscribe(ctx, transport)
+//
+// Every replica must receive every command in order to converge to the same
+// pipeline, so replicas must not share a consumer group. Reading a compacted
+// topic from its first offset, the default without consumer group, replays
+// the latest commands on start up, while versioned commands already applied
+// are ignored, see layer.Command.
+package kafkatransport
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Reader represents a Kafka topic reader, implemented by *kafka.Reader.
+type Reader interface {
+	// ReadMessage reads the next topic message, committing its offset
+	// if the reader is part of a consumer group.
+	ReadMessage(ctx context.Context) (kafka.Message, error)
+	// Close closes the reader.
+	Close() error
+}
+
+// Transport implements a layer.Transport receiving messages from a Kafka topic.
+type Transport struct {
+	// reader stores the topic reader.
+	reader Reader
+}
+
+// New creates a new transport receiving the messages read by the given reader.
+func New(reader Reader) *Transport {
+	return &Transport{reader: reader}
+}
+
+// Receive blocks until the next topic message is read, returning its value.
+func (t *Transport) Receive(ctx context.Context) ([]byte, error) {
+	msg, err := t.reader.ReadMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Value, nil
+}
+
+// Close closes the topic reader.
+func (t *Transport) Close() error {
+	return t.reader.Close()
+}
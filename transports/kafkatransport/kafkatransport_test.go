@@ -0,0 +1,60 @@
+package kafkatransport
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/nbio/st"
+	"github.com/segmentio/kafka-go"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+// reader implements a Reader reading the given messages.
+type reader struct {
+	messages []kafka.Message
+	closed   bool
+}
+
+func (r *reader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	if len(r.messages) == 0 {
+		<-ctx.Done()
+		return kafka.Message{}, ctx.Err()
+	}
+	msg := r.messages[0]
+	r.messages = r.messages[1:]
+	return msg, nil
+}
+
+func (r *reader) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestTransport(t *testing.T) {
+	mw := layer.New()
+	mw.UseNamed("request", "foo", func(w http.ResponseWriter, r *http.Request, h http.Handler) {})
+
+	r := &reader{messages: []kafka.Message{
+		{Value: []byte(`{"type": "disable", "version": 1, "name": "foo"}`)},
+	}}
+	transport := New(r)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- mw.Subscribe(ctx, transport)
+	}()
+	for {
+		changes := mw.Changes()
+		if mw.Describe().Phases[0].Middleware[0].Disabled {
+			break
+		}
+		<-changes
+	}
+	cancel()
+	st.Expect(t, <-done, context.Canceled)
+
+	st.Expect(t, transport.Close(), nil)
+	st.Expect(t, r.closed, true)
+}
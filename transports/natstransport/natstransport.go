@@ -0,0 +1,50 @@
+// Package natstransport implements a layer.Transport receiving the layer
+// commands published on a NATS subject, kept apart from the layer package
+// so its dependency is only required when used:
+//
+//	conn, err := nats.Connect(nats.DefaultURL)
+//	transport, err := natstransport.New(conn, "gateway.layer")
+//	defer transport.Close()
+//	go mw.Subscribe(ctx, transport)
+//
+// Every replica must receive every command in order to converge to the same
+// pipeline, so the subject is subscribed without queue group. Since NATS core
+// doesn't persist messages, replicas starting up must be configured first,
+// e.g: via layer.NewFromConfig, while versioned commands keep them consistent.
+package natstransport
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Transport implements a layer.Transport receiving messages from a NATS subject.
+type Transport struct {
+	// sub stores the synchronous subject subscription.
+	sub *nats.Subscription
+}
+
+// New subscribes to the given NATS subject, returning a transport
+// receiving its messages.
+func New(conn *nats.Conn, subject string) (*Transport, error) {
+	sub, err := conn.SubscribeSync(subject)
+	if err != nil {
+		return nil, err
+	}
+	return &Transport{sub: sub}, nil
+}
+
+// Receive blocks until the next subject message is delivered, returning its payload.
+func (t *Transport) Receive(ctx context.Context) ([]byte, error) {
+	msg, err := t.sub.NextMsgWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Data, nil
+}
+
+// Close unsubscribes from the subject.
+func (t *Transport) Close() error {
+	return t.sub.Unsubscribe()
+}
@@ -0,0 +1,81 @@
+package natstransport
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/layer.v0"
+)
+
+// serve implements a minimal NATS server, publishing the given
+// messages on every subscribed subject.
+func serve(t *testing.T, messages ...string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	st.Expect(t, err, nil)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "INFO {\"server_id\":\"test\",\"version\":\"2.10.0\",\"proto\":1,\"max_payload\":1048576}\r\n")
+
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			switch fields[0] {
+			case "PING":
+				fmt.Fprint(conn, "PONG\r\n")
+			case "SUB":
+				subject, sid := fields[1], fields[len(fields)-1]
+				for _, msg := range messages {
+					fmt.Fprintf(conn, "MSG %s %s %d\r\n%s\r\n", subject, sid, len(msg), msg)
+				}
+			}
+		}
+	}()
+	return "nats://" + listener.Addr().String()
+}
+
+func TestTransport(t *testing.T) {
+	mw := layer.New()
+	mw.UseNamed("request", "foo", func(w http.ResponseWriter, r *http.Request, h http.Handler) {})
+
+	conn, err := nats.Connect(serve(t, `{"type": "disable", "version": 1, "name": "foo"}`))
+	st.Expect(t, err, nil)
+	defer conn.Close()
+	transport, err := New(conn, "gateway.layer")
+	st.Expect(t, err, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- mw.Subscribe(ctx, transport)
+	}()
+	for {
+		changes := mw.Changes()
+		if mw.Describe().Phases[0].Middleware[0].Disabled {
+			break
+		}
+		<-changes
+	}
+	cancel()
+	st.Expect(t, <-done, context.Canceled)
+	st.Expect(t, transport.Close(), nil)
+}
@@ -0,0 +1,479 @@
+package layer
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+)
+
+// committer is implemented by response writers capable of reporting
+// whether the response has been already written.
+type committer interface {
+	Written() bool
+}
+
+// committed reports whether the given response writer has been already written.
+// Writers not implementing the committer interface are never considered committed.
+func committed(w http.ResponseWriter) bool {
+	c, ok := w.(committer)
+	return ok && c.Written()
+}
+
+// wrapper is implemented by the response writers wrapping another one.
+// This is the same interface used by http.ResponseController.
+type wrapper interface {
+	Unwrap() http.ResponseWriter
+}
+
+// Unwrap returns the original response writer wrapped by the given one,
+// unwrapping every writer implementing an Unwrap() http.ResponseWriter method,
+// such as the writers introduced by the layer.
+func Unwrap(w http.ResponseWriter) http.ResponseWriter {
+	for {
+		u, ok := w.(wrapper)
+		if !ok {
+			return w
+		}
+		next := u.Unwrap()
+		if next == nil {
+			return w
+		}
+		w = next
+	}
+}
+
+// ResponseWriter represents the response writer passed through the middleware chain,
+// allowing middleware to inspect what has been written downstream.
+//
+// The layer response writer implements http.Flusher, http.Hijacker, http.Pusher,
+// http.CloseNotifier and io.ReaderFrom only when the underlying writer does,
+// so type assertions on it are reliable, and can be unwrapped via Unwrap.
+type ResponseWriter interface {
+	http.ResponseWriter
+	// Status returns the written response status code, or 0 if not written yet.
+	Status() int
+	// BytesWritten returns the number of response body bytes written.
+	BytesWritten() int
+	// Written reports whether the response status has been already written.
+	Written() bool
+}
+
+// NewResponseWriter wraps the given response writer into a layer ResponseWriter.
+// If the given writer already is a ResponseWriter, it's returned as is.
+func NewResponseWriter(w http.ResponseWriter) ResponseWriter {
+	if rw, ok := w.(ResponseWriter); ok {
+		return rw
+	}
+	return newResponseWriter(w)
+}
+
+// layerWriter represents the methods exposed by every layer response writer,
+// regardless of the optional interfaces implemented by the underlying writer.
+type layerWriter interface {
+	ResponseWriter
+	wrapper
+}
+
+// Optional response writer interfaces, as reported by optionalInterfaces.
+const (
+	supportsFlush = 1 << iota
+	supportsHijack
+	supportsPush
+	supportsCloseNotify
+	supportsReadFrom
+)
+
+// newResponseWriter wraps the given response writer into a layer ResponseWriter,
+// exposing only the optional interfaces implemented by the given writer,
+// the same way github.com/felixge/httpsnoop does.
+func newResponseWriter(w http.ResponseWriter) ResponseWriter {
+	rw := &responseWriter{ResponseWriter: w}
+	switch optionalInterfaces(w) {
+	case 0:
+		return struct{ layerWriter }{rw}
+	case supportsFlush:
+		return struct {
+			layerWriter
+			http.Flusher
+		}{rw, rw}
+	case supportsHijack:
+		return struct {
+			layerWriter
+			http.Hijacker
+		}{rw, rw}
+	case supportsFlush | supportsHijack:
+		return struct {
+			layerWriter
+			http.Flusher
+			http.Hijacker
+		}{rw, rw, rw}
+	case supportsPush:
+		return struct {
+			layerWriter
+			http.Pusher
+		}{rw, rw}
+	case supportsFlush | supportsPush:
+		return struct {
+			layerWriter
+			http.Flusher
+			http.Pusher
+		}{rw, rw, rw}
+	case supportsHijack | supportsPush:
+		return struct {
+			layerWriter
+			http.Hijacker
+			http.Pusher
+		}{rw, rw, rw}
+	case supportsFlush | supportsHijack | supportsPush:
+		return struct {
+			layerWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{rw, rw, rw, rw}
+	case supportsCloseNotify:
+		return struct {
+			layerWriter
+			http.CloseNotifier
+		}{rw, rw}
+	case supportsFlush | supportsCloseNotify:
+		return struct {
+			layerWriter
+			http.Flusher
+			http.CloseNotifier
+		}{rw, rw, rw}
+	case supportsHijack | supportsCloseNotify:
+		return struct {
+			layerWriter
+			http.Hijacker
+			http.CloseNotifier
+		}{rw, rw, rw}
+	case supportsFlush | supportsHijack | supportsCloseNotify:
+		return struct {
+			layerWriter
+			http.Flusher
+			http.Hijacker
+			http.CloseNotifier
+		}{rw, rw, rw, rw}
+	case supportsPush | supportsCloseNotify:
+		return struct {
+			layerWriter
+			http.Pusher
+			http.CloseNotifier
+		}{rw, rw, rw}
+	case supportsFlush | supportsPush | supportsCloseNotify:
+		return struct {
+			layerWriter
+			http.Flusher
+			http.Pusher
+			http.CloseNotifier
+		}{rw, rw, rw, rw}
+	case supportsHijack | supportsPush | supportsCloseNotify:
+		return struct {
+			layerWriter
+			http.Hijacker
+			http.Pusher
+			http.CloseNotifier
+		}{rw, rw, rw, rw}
+	case supportsFlush | supportsHijack | supportsPush | supportsCloseNotify:
+		return struct {
+			layerWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+			http.CloseNotifier
+		}{rw, rw, rw, rw, rw}
+	case supportsReadFrom:
+		return struct {
+			layerWriter
+			io.ReaderFrom
+		}{rw, rw}
+	case supportsFlush | supportsReadFrom:
+		return struct {
+			layerWriter
+			http.Flusher
+			io.ReaderFrom
+		}{rw, rw, rw}
+	case supportsHijack | supportsReadFrom:
+		return struct {
+			layerWriter
+			http.Hijacker
+			io.ReaderFrom
+		}{rw, rw, rw}
+	case supportsFlush | supportsHijack | supportsReadFrom:
+		return struct {
+			layerWriter
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{rw, rw, rw, rw}
+	case supportsPush | supportsReadFrom:
+		return struct {
+			layerWriter
+			http.Pusher
+			io.ReaderFrom
+		}{rw, rw, rw}
+	case supportsFlush | supportsPush | supportsReadFrom:
+		return struct {
+			layerWriter
+			http.Flusher
+			http.Pusher
+			io.ReaderFrom
+		}{rw, rw, rw, rw}
+	case supportsHijack | supportsPush | supportsReadFrom:
+		return struct {
+			layerWriter
+			http.Hijacker
+			http.Pusher
+			io.ReaderFrom
+		}{rw, rw, rw, rw}
+	case supportsFlush | supportsHijack | supportsPush | supportsReadFrom:
+		return struct {
+			layerWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+			io.ReaderFrom
+		}{rw, rw, rw, rw, rw}
+	case supportsCloseNotify | supportsReadFrom:
+		return struct {
+			layerWriter
+			http.CloseNotifier
+			io.ReaderFrom
+		}{rw, rw, rw}
+	case supportsFlush | supportsCloseNotify | supportsReadFrom:
+		return struct {
+			layerWriter
+			http.Flusher
+			http.CloseNotifier
+			io.ReaderFrom
+		}{rw, rw, rw, rw}
+	case supportsHijack | supportsCloseNotify | supportsReadFrom:
+		return struct {
+			layerWriter
+			http.Hijacker
+			http.CloseNotifier
+			io.ReaderFrom
+		}{rw, rw, rw, rw}
+	case supportsFlush | supportsHijack | supportsCloseNotify | supportsReadFrom:
+		return struct {
+			layerWriter
+			http.Flusher
+			http.Hijacker
+			http.CloseNotifier
+			io.ReaderFrom
+		}{rw, rw, rw, rw, rw}
+	case supportsPush | supportsCloseNotify | supportsReadFrom:
+		return struct {
+			layerWriter
+			http.Pusher
+			http.CloseNotifier
+			io.ReaderFrom
+		}{rw, rw, rw, rw}
+	case supportsFlush | supportsPush | supportsCloseNotify | supportsReadFrom:
+		return struct {
+			layerWriter
+			http.Flusher
+			http.Pusher
+			http.CloseNotifier
+			io.ReaderFrom
+		}{rw, rw, rw, rw, rw}
+	case supportsHijack | supportsPush | supportsCloseNotify | supportsReadFrom:
+		return struct {
+			layerWriter
+			http.Hijacker
+			http.Pusher
+			http.CloseNotifier
+			io.ReaderFrom
+		}{rw, rw, rw, rw, rw}
+	case supportsFlush | supportsHijack | supportsPush | supportsCloseNotify | supportsReadFrom:
+		return struct {
+			layerWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+			http.CloseNotifier
+			io.ReaderFrom
+		}{rw, rw, rw, rw, rw, rw}
+	}
+	panic("unreachable")
+}
+
+// optionalInterfaces returns the optional interfaces implemented by the given writer.
+// The layer internal writers forward all of them, so the writer they wrap is inspected instead.
+func optionalInterfaces(w http.ResponseWriter) int {
+	for {
+		switch iw := w.(type) {
+		case *statusInterceptor:
+			w = iw.ResponseWriter
+			continue
+		case *compressWriter:
+			w = iw.ResponseWriter
+			continue
+		case *timeoutWriter:
+			w = iw.w
+			continue
+		case *corsWriter:
+			w = iw.ResponseWriter
+			continue
+		case *cacheRecorder:
+			w = iw.ResponseWriter
+			continue
+		}
+		break
+	}
+
+	var supported int
+	if _, ok := w.(http.Flusher); ok {
+		supported |= supportsFlush
+	}
+	if _, ok := w.(http.Hijacker); ok {
+		supported |= supportsHijack
+	}
+	if _, ok := w.(http.Pusher); ok {
+		supported |= supportsPush
+	}
+	if _, ok := w.(http.CloseNotifier); ok {
+		supported |= supportsCloseNotify
+	}
+	if _, ok := w.(io.ReaderFrom); ok {
+		supported |= supportsReadFrom
+	}
+	return supported
+}
+
+// responseWriter implements the layer ResponseWriter.
+// It implements every optional interface, so it must be only exposed
+// via newResponseWriter, which hides the unsupported ones.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+// WriteHeader writes the response status code.
+// Informational status codes are written but not recorded as the response status.
+func (w *responseWriter) WriteHeader(code int) {
+	if w.status == 0 && code >= 200 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes the response body, implicitly writing a 200 status code if not written yet.
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Unwrap returns the wrapped response writer.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status returns the written response status code, or 0 if not written yet.
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+// BytesWritten returns the number of response body bytes written.
+func (w *responseWriter) BytesWritten() int {
+	return w.bytes
+}
+
+// Written reports whether the response status has been already written,
+// either via the layer writer or the underlying one.
+func (w *responseWriter) Written() bool {
+	return w.status != 0 || committed(w.ResponseWriter)
+}
+
+// Flush sends any buffered data to the client, if supported by the underlying writer.
+func (w *responseWriter) Flush() {
+	if flush(w.ResponseWriter) && w.status == 0 {
+		w.status = http.StatusOK
+	}
+}
+
+// Hijack lets the caller take over the connection, if supported by the underlying writer.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hijack(w.ResponseWriter)
+}
+
+// Push initiates an HTTP/2 server push, if supported by the underlying writer.
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	return push(w.ResponseWriter, target, opts)
+}
+
+// CloseNotify returns a channel notifying when the client connection has gone away,
+// if supported by the underlying writer.
+func (w *responseWriter) CloseNotify() <-chan bool {
+	return closeNotify(w.ResponseWriter)
+}
+
+// ReadFrom reads data from the given reader and writes it to the response body,
+// using the underlying writer implementation, if supported.
+func (w *responseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := readFrom(w.ResponseWriter, r)
+	w.bytes += int(n)
+	return n, err
+}
+
+// flush flushes the given writer, if supported, reporting whether it was flushed.
+func flush(w http.ResponseWriter) bool {
+	f, ok := w.(http.Flusher)
+	if ok {
+		f.Flush()
+	}
+	return ok
+}
+
+// hijack hijacks the given writer connection, if supported.
+func hijack(w http.ResponseWriter) (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("vinxi: response writer does not implement http.Hijacker")
+	}
+	return h.Hijack()
+}
+
+// push initiates an HTTP/2 server push via the given writer, if supported.
+func push(w http.ResponseWriter, target string, opts *http.PushOptions) error {
+	p, ok := w.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return p.Push(target, opts)
+}
+
+// closeNotify returns the given writer close notification channel, if supported,
+// or a channel that never receives otherwise.
+func closeNotify(w http.ResponseWriter) <-chan bool {
+	if c, ok := w.(http.CloseNotifier); ok {
+		return c.CloseNotify()
+	}
+	return make(chan bool)
+}
+
+// readFrom copies the given reader into the given writer,
+// using its io.ReaderFrom implementation, if supported.
+func readFrom(w http.ResponseWriter, r io.Reader) (int64, error) {
+	if rf, ok := w.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+	return io.Copy(writerOnly{w}, r)
+}
+
+// writerOnly hides every method of the given writer but Write,
+// preventing io.Copy from calling back the ReadFrom implementation.
+type writerOnly struct {
+	io.Writer
+}
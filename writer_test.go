@@ -0,0 +1,188 @@
+package layer
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func TestResponseWriter(t *testing.T) {
+	var rw ResponseWriter
+	mw := New()
+	mw.Use(RequestPhase, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		rw = w.(ResponseWriter)
+		st.Expect(t, rw.Written(), false)
+		h.ServeHTTP(w, r)
+		st.Expect(t, rw.Written(), true)
+		st.Expect(t, rw.Status(), 201)
+		st.Expect(t, rw.BytesWritten(), 11)
+	})
+
+	w := httptest.NewRecorder()
+	mw.Run(RequestPhase, w, &http.Request{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(201)
+		w.Write([]byte("hello"))
+		w.(http.Flusher).Flush()
+		io.Copy(w, bytes.NewBufferString(" world"))
+	}))
+	st.Expect(t, rw != nil, true)
+	st.Expect(t, w.Code, 201)
+	st.Expect(t, w.Flushed, true)
+	st.Expect(t, w.Body.String(), "hello world")
+}
+
+func TestResponseWriterImplicitStatus(t *testing.T) {
+	w := NewResponseWriter(httptest.NewRecorder())
+	w.Write([]byte("foo"))
+	st.Expect(t, w.Status(), 200)
+	st.Expect(t, NewResponseWriter(w), w)
+}
+
+func TestResponseWriterUnsupported(t *testing.T) {
+	w := NewResponseWriter(httptest.NewRecorder())
+	_, ok := w.(http.Hijacker)
+	st.Expect(t, ok, false)
+	_, ok = w.(http.Pusher)
+	st.Expect(t, ok, false)
+	_, ok = w.(http.Flusher)
+	st.Expect(t, ok, true)
+}
+
+// fullWriter implements every optional response writer interface, recording calls.
+type fullWriter struct {
+	*httptest.ResponseRecorder
+	calls []string
+}
+
+func (w *fullWriter) Flush() {
+	w.calls = append(w.calls, "flush")
+}
+
+func (w *fullWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.calls = append(w.calls, "hijack")
+	return nil, nil, nil
+}
+
+func (w *fullWriter) Push(target string, opts *http.PushOptions) error {
+	w.calls = append(w.calls, "push")
+	return nil
+}
+
+func (w *fullWriter) CloseNotify() <-chan bool {
+	w.calls = append(w.calls, "closenotify")
+	return nil
+}
+
+func (w *fullWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.calls = append(w.calls, "readfrom")
+	return io.Copy(w.ResponseRecorder, r)
+}
+
+// basicWriter implements no optional response writer interface.
+type basicWriter struct {
+	http.ResponseWriter
+}
+
+func newIdentityWriter(w http.ResponseWriter) http.ResponseWriter {
+	return &compressWriter{ResponseWriter: w, encoding: "identity-test", encoder: func(w io.Writer) io.WriteCloser {
+		return nopCloser{w}
+	}}
+}
+
+var writerWrappers = map[string]func(http.ResponseWriter) http.ResponseWriter{
+	"response": func(w http.ResponseWriter) http.ResponseWriter {
+		return NewResponseWriter(w)
+	},
+	"status": func(w http.ResponseWriter) http.ResponseWriter {
+		return NewResponseWriter(&statusInterceptor{ResponseWriter: w})
+	},
+	"compress": func(w http.ResponseWriter) http.ResponseWriter {
+		return NewResponseWriter(newIdentityWriter(w))
+	},
+	"timeout": func(w http.ResponseWriter) http.ResponseWriter {
+		return NewResponseWriter(newTimeoutWriter(w))
+	},
+	"cors": func(w http.ResponseWriter) http.ResponseWriter {
+		return NewResponseWriter(&corsWriter{ResponseWriter: w, cors: &CORS{}})
+	},
+	"nested": func(w http.ResponseWriter) http.ResponseWriter {
+		return NewResponseWriter(&statusInterceptor{ResponseWriter: newIdentityWriter(w)})
+	},
+}
+
+func TestWriterInterfacesPassThrough(t *testing.T) {
+	for name, wrap := range writerWrappers {
+		fw := &fullWriter{ResponseRecorder: httptest.NewRecorder()}
+		w := wrap(fw)
+
+		w.(http.Flusher).Flush()
+		w.(http.Hijacker).Hijack()
+		w.(http.Pusher).Push("/foo", nil)
+		w.(http.CloseNotifier).CloseNotify()
+		w.(io.ReaderFrom).ReadFrom(bytes.NewBufferString("foo"))
+
+		calls := []string{"flush", "hijack", "push", "closenotify", "readfrom"}
+		if name == "compress" || name == "nested" {
+			// Compressed bodies are written via Write
+			calls = calls[:4]
+		}
+		st.Expect(t, fw.calls, calls)
+		st.Expect(t, fw.Body.String(), "foo")
+	}
+}
+
+func TestWriterInterfacesUnsupported(t *testing.T) {
+	for _, wrap := range writerWrappers {
+		rec := httptest.NewRecorder()
+		w := wrap(basicWriter{rec})
+
+		_, ok := w.(http.Flusher)
+		st.Expect(t, ok, false)
+		_, ok = w.(http.Hijacker)
+		st.Expect(t, ok, false)
+		_, ok = w.(http.Pusher)
+		st.Expect(t, ok, false)
+		_, ok = w.(http.CloseNotifier)
+		st.Expect(t, ok, false)
+		_, ok = w.(io.ReaderFrom)
+		st.Expect(t, ok, false)
+
+		n, err := io.Copy(w, bytes.NewBufferString("foo"))
+		st.Expect(t, n, int64(3))
+		st.Expect(t, err, nil)
+		st.Expect(t, rec.Body.String(), "foo")
+		st.Expect(t, rec.Flushed, false)
+	}
+}
+
+func TestWriterInterfacesPartial(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := NewResponseWriter(struct {
+		http.ResponseWriter
+		http.Flusher
+	}{rec, rec})
+
+	_, ok := w.(http.Hijacker)
+	st.Expect(t, ok, false)
+	w.(http.Flusher).Flush()
+	st.Expect(t, rec.Flushed, true)
+	st.Expect(t, w.Status(), 200)
+	st.Expect(t, Unwrap(w), http.ResponseWriter(struct {
+		http.ResponseWriter
+		http.Flusher
+	}{rec, rec}))
+}
+
+func TestUnwrap(t *testing.T) {
+	rec := httptest.NewRecorder()
+	st.Expect(t, Unwrap(rec), http.ResponseWriter(rec))
+	st.Expect(t, Unwrap(writerWrappers["nested"](rec)), http.ResponseWriter(rec))
+	buf := NewResponseBuffer()
+	st.Expect(t, Unwrap(buf), http.ResponseWriter(buf))
+}